@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const DEFAULT_POOL_SIZE = 64 // 默认缓冲池页数
+
+var ErrBufferPoolFull = errors.New("b+tree: all buffer pool frames are pinned")
+
+// BufferPool 页缓冲池: 固定数量的页帧，按时钟(CLOCK)算法置换未固定的页，
+// 脏页在被置换或 Flush 时写回数据文件。file 为 nil 时为纯内存模式，不做置换。
+// 写回前先把日志刷到该页的LSN(先写日志原则)，本次操作尚未提交的页不会被置换。
+// 池本身由 mu 保护，页内容由各页的闩锁保护，调用方先固定页再加闩锁，解锁后再解除固定。
+type BufferPool[K, V any] struct {
+	mu        sync.Mutex
+	codec     *codecs[K, V]
+	file      *PageFile
+	wal       *WAL
+	capacity  int
+	frames    []*Page[K, V] // 页帧(时钟环)
+	index     map[int]int   // 页ID -> 帧下标
+	hand      int           // 时钟指针
+	pageCount int           // 已分配页数(含元数据页)
+	freeList  int           // 空闲页链表头，释放的页优先复用
+	buf       []byte        // 读写页用的临时缓冲区
+
+	hits   int
+	misses int
+}
+
+// NewBufferPool 创建缓冲池
+func NewBufferPool[K, V any](c *codecs[K, V], file *PageFile, capacity, pageCount int) *BufferPool[K, V] {
+	if capacity < 8 {
+		capacity = 8
+	}
+	if pageCount < 1 {
+		pageCount = 1
+	}
+	return &BufferPool[K, V]{
+		codec:     c,
+		file:      file,
+		capacity:  capacity,
+		index:     make(map[int]int),
+		pageCount: pageCount,
+		buf:       make([]byte, PAGE_SIZE),
+	}
+}
+
+// FetchPage 取出并固定一页，不在池中时从文件读入
+func (bp *BufferPool[K, V]) FetchPage(id int) (*Page[K, V], error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return bp.fetch(id)
+}
+
+func (bp *BufferPool[K, V]) fetch(id int) (*Page[K, V], error) {
+	if id == META_PAGE_ID || id >= bp.pageCount {
+		return nil, fmt.Errorf("%w: invalid page id %d", ErrCorruptPage, id)
+	}
+	if i, ok := bp.index[id]; ok {
+		p := bp.frames[i]
+		p.pinCount++
+		p.ref = true
+		bp.hits++
+		return p, nil
+	}
+	bp.misses++
+	if bp.file == nil {
+		return nil, fmt.Errorf("%w: page %d not resident", ErrCorruptPage, id)
+	}
+
+	slot, err := bp.freeFrame()
+	if err != nil {
+		return nil, err
+	}
+	if err := bp.file.readPage(id, bp.buf); err != nil {
+		return nil, err
+	}
+	p, err := decodePage(bp.codec, id, bp.buf)
+	if err != nil {
+		return nil, err
+	}
+	bp.install(slot, p)
+	return p, nil
+}
+
+// NewPage 分配一个新页并固定在池中，优先复用空闲页。
+// 返回的页已加写闩锁: 复用的空闲页可能还被过时的游标读着，要等它们放开后才能重置
+func (bp *BufferPool[K, V]) NewPage(isLeaf bool) (*Page[K, V], error) {
+	bp.mu.Lock()
+	p, reused, err := bp.allocate()
+	bp.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	p.latch.Lock()
+	if reused {
+		p.isFree = false
+		p.keys = nil
+		p.records = nil
+		p.children = nil
+		p.next = META_PAGE_ID
+		p.prev = META_PAGE_ID
+	}
+	p.isLeaf = isLeaf
+	p.updateFreeSpace()
+	return p, nil
+}
+
+// allocate 取出空闲链表头的页，或者在文件末尾分配一页
+func (bp *BufferPool[K, V]) allocate() (*Page[K, V], bool, error) {
+	if bp.freeList != META_PAGE_ID {
+		p, err := bp.fetch(bp.freeList)
+		if err != nil {
+			return nil, false, err
+		}
+		if !p.isFree {
+			p.pinCount--
+			return nil, false, fmt.Errorf("%w: free list points at in-use page %d", ErrCorruptPage, p.id)
+		}
+		bp.freeList = p.next
+		return p, true, nil
+	}
+
+	slot, err := bp.freeFrame()
+	if err != nil {
+		return nil, false, err
+	}
+	p := &Page[K, V]{id: bp.pageCount, codec: bp.codec}
+	bp.pageCount++
+	bp.install(slot, p)
+	return p, false, nil
+}
+
+// FreePage 把页放回空闲链表，调用方需持有该页的写闩锁并保持固定直到本次操作提交
+func (bp *BufferPool[K, V]) FreePage(p *Page[K, V]) {
+	p.isFree = true
+	p.isLeaf = false
+	p.keys = nil
+	p.records = nil
+	p.children = nil
+	p.prev = META_PAGE_ID
+	bp.mu.Lock()
+	p.next = bp.freeList
+	bp.freeList = p.id
+	bp.mu.Unlock()
+	p.updateFreeSpace()
+}
+
+// UnpinPage 解除一次固定
+func (bp *BufferPool[K, V]) UnpinPage(p *Page[K, V]) {
+	bp.mu.Lock()
+	if p.pinCount > 0 {
+		p.pinCount--
+	}
+	bp.mu.Unlock()
+}
+
+// state 已分配页数和空闲页链表头
+func (bp *BufferPool[K, V]) state() (pageCount, freeList int) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return bp.pageCount, bp.freeList
+}
+
+// adopt 接管批量装载在文件末尾构建的页: 已分配页数增加到 pageCount，
+// 纯内存模式下把构建好的页放进池中(不固定)，否则这些页已直接写入数据文件
+func (bp *BufferPool[K, V]) adopt(pages []*Page[K, V], pageCount int) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for _, p := range pages {
+		bp.install(len(bp.frames), p)
+		p.pinCount = 0
+	}
+	bp.pageCount = pageCount
+}
+
+// install 把页放进指定帧并固定
+func (bp *BufferPool[K, V]) install(slot int, p *Page[K, V]) {
+	p.pinCount = 1
+	p.ref = true
+	if slot == len(bp.frames) {
+		bp.frames = append(bp.frames, p)
+	} else {
+		bp.frames[slot] = p
+	}
+	bp.index[p.id] = slot
+}
+
+// freeFrame 返回一个可用的帧下标，必要时置换
+func (bp *BufferPool[K, V]) freeFrame() (int, error) {
+	if bp.file == nil || len(bp.frames) < bp.capacity {
+		return len(bp.frames), nil
+	}
+
+	// 时钟算法: 转两圈仍找不到未固定的页说明池已满
+	for n := 0; n < 2*len(bp.frames); n++ {
+		slot := bp.hand
+		bp.hand = (bp.hand + 1) % len(bp.frames)
+
+		p := bp.frames[slot]
+		if p.pinCount > 0 || p.pending {
+			continue
+		}
+		if p.ref {
+			p.ref = false
+			continue
+		}
+		if err := bp.writeBack(p); err != nil {
+			return 0, err
+		}
+		delete(bp.index, p.id)
+		return slot, nil
+	}
+	return 0, ErrBufferPoolFull
+}
+
+// writeBack 把脏页写回文件
+func (bp *BufferPool[K, V]) writeBack(p *Page[K, V]) error {
+	if !p.dirty || bp.file == nil {
+		return nil
+	}
+	if bp.wal != nil {
+		if err := bp.wal.flush(p.lsn); err != nil {
+			return err
+		}
+	}
+	if err := encodePage(p, bp.buf); err != nil {
+		return err
+	}
+	if err := bp.file.writePage(p.id, bp.buf); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// FlushAll 把所有脏页写回文件，调用方需保证没有并发的写操作
+func (bp *BufferPool[K, V]) FlushAll() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for _, p := range bp.frames {
+		if err := bp.writeBack(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
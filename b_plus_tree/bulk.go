@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 批量装载:
+//
+// 按键严格递增的记录从左到右填满叶子页，每写完一页就把它的最小键和页ID交给上一层，
+// 内部页以同样的方式自底向上构建，每层只在内存中保留最后两页。
+// 每页按填充因子装到目标键数或目标字节数为止，最后一页不足半满时与前一页重新分配或合并。
+//
+// 新页在文件末尾分配，绕过缓冲池和日志直接写入数据文件并 fsync，
+// 之后以一次写操作释放原来的空根页并换上新的根页。提交前崩溃时元数据中的页数不变，
+// 文件末尾写了一半的页不属于任何页，重新打开后会被覆盖。
+
+const DEFAULT_FILL_FACTOR = 0.9 // 批量装载时默认的页填充因子
+
+var (
+	ErrNotEmpty  = errors.New("b+tree: bulk load requires an empty tree")
+	ErrNotSorted = errors.New("b+tree: bulk load keys must be strictly ascending")
+)
+
+// BatchInsert 批量插入，同一个键出现多次时以最后一次为准。
+// 记录先按键排序: 空树直接自底向上装载，否则按键序逐条插入
+func (t *BPlusTree[K, V]) BatchInsert(records iter.Seq2[K, V]) error {
+	var batch []*Record[K, V]
+	for key, value := range records {
+		batch = append(batch, &Record[K, V]{key: key, value: value})
+	}
+	slices.SortStableFunc(batch, func(a, b *Record[K, V]) int {
+		return t.codec.cmp(a.key, b.key)
+	})
+	// 去重，保留最后一次出现的值
+	n := 0
+	for _, rec := range batch {
+		if n > 0 && t.codec.cmp(batch[n-1].key, rec.key) == 0 {
+			batch[n-1] = rec
+			continue
+		}
+		batch[n] = rec
+		n++
+	}
+	batch = batch[:n]
+
+	sorted := func(yield func(K, V) bool) {
+		for _, rec := range batch {
+			if !yield(rec.key, rec.value) {
+				return
+			}
+		}
+	}
+	if _, err := t.BulkLoad(sorted, DEFAULT_FILL_FACTOR); !errors.Is(err, ErrNotEmpty) {
+		return err
+	}
+	for _, rec := range batch {
+		if err := t.Insert(rec.key, rec.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BulkLoad 把按键严格递增的记录一趟装入空树，返回装载的记录数。
+// fill 是每页的填充因子，限制在 [0.5, 1] 内，为 0 时使用 DEFAULT_FILL_FACTOR。
+// 装载期间独占整棵树；出错时树保持不变
+func (t *BPlusTree[K, V]) BulkLoad(records iter.Seq2[K, V], fill float64) (int, error) {
+	return t.bulkLoad(records, fill, nil)
+}
+
+// LoadCSV 从 r 逐行读取按键升序排列的 "key,value" 记录并一趟装入空树，返回装载的记录数。
+// 值中含逗号时按CSV规则加引号，# 开头的行是注释。读取或解析出错时树保持不变
+func LoadCSV(t *BPlusTree[int, string], r io.Reader, fill float64) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.Comment = '#'
+	cr.ReuseRecord = true
+	var readErr error
+	records := func(yield func(int, string) bool) {
+		for {
+			row, err := cr.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+			key, err := strconv.Atoi(strings.TrimSpace(row[0]))
+			if err != nil {
+				line, _ := cr.FieldPos(0)
+				readErr = fmt.Errorf("csv line %d: invalid key %q", line, row[0])
+				return
+			}
+			if !yield(key, row[1]) {
+				return
+			}
+		}
+	}
+	return t.bulkLoad(records, fill, func() error { return readErr })
+}
+
+// bulkLoad 同 BulkLoad，records 遍历结束后 srcErr 返回数据源的错误
+func (t *BPlusTree[K, V]) bulkLoad(records iter.Seq2[K, V], fill float64, srcErr func() error) (int, error) {
+	if fill == 0 {
+		fill = DEFAULT_FILL_FACTOR
+	}
+	fill = min(max(fill, 0.5), 1)
+	n := 0
+	err := t.exclusive(func(o *op[K, V]) error {
+		old, err := o.fetch(t.root)
+		if err != nil {
+			return err
+		}
+		if !old.isLeaf || len(old.keys) > 0 {
+			return ErrNotEmpty
+		}
+
+		pageCount, _ := t.pool.state()
+		b := &bulkLoader[K, V]{
+			t:     t,
+			keys:  max(int(math.Ceil(fill*float64(t.order))), t.minKeys(true)),
+			bytes: PAGE_HEADER_SIZE + int(fill*float64(PAGE_SIZE-PAGE_HEADER_SIZE)),
+			next:  pageCount,
+			buf:   make([]byte, PAGE_SIZE),
+		}
+		// Begin 要等本操作结束，没有活跃事务时不会有键被事务锁住
+		idle := t.txns.idle()
+		ts := o.stamp()
+		var last K
+		for key, value := range records {
+			if n > 0 && t.codec.cmp(key, last) <= 0 {
+				return fmt.Errorf("%w: %v after %v", ErrNotSorted, key, last)
+			}
+			if err := t.checkSize(key, value); err != nil {
+				return err
+			}
+			if !idle && t.txns.locked(t.codec.encodeKey(key)) {
+				return ErrWriteConflict
+			}
+			if err := b.add(0, key, &Record[K, V]{key: key, value: value, txID: ts}, 0); err != nil {
+				return err
+			}
+			last = key
+			n++
+		}
+		if srcErr != nil {
+			if err := srcErr(); err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+
+		root, err := b.finish()
+		if err != nil {
+			return err
+		}
+		if t.file != nil {
+			// 新页不经过日志，提交换根之前必须已经落盘
+			if err := t.file.sync(); err != nil {
+				return err
+			}
+		}
+		t.pool.adopt(b.pages, b.next)
+		t.pool.FreePage(old)
+		o.setRoot(root)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// bulkLevel 批量装载时正在构建的一层: cur 还在填充，prev 已填满但要等到这一层结束
+// 才能确定最后两页是否需要重新分配，因此 cur 开始填充时才把 prev 交给上一层
+type bulkLevel[K, V any] struct {
+	prev, cur       *Page[K, V]
+	prevLow, curLow K   // 页内子树的最小键，交给上一层作分隔键
+	used            int // cur 序列化后的字节数
+}
+
+type bulkLoader[K, V any] struct {
+	t      *BPlusTree[K, V]
+	keys   int // 每页的目标键数
+	bytes  int // 每页的目标字节数
+	next   int // 下一个新页ID
+	levels []*bulkLevel[K, V]
+	pages  []*Page[K, V] // 纯内存模式下构建好的页
+	buf    []byte
+}
+
+// add 向第 lv 层追加一项: 叶子层是记录 rec，内部层是最小键为 key 的子页 child
+func (b *bulkLoader[K, V]) add(lv int, key K, rec *Record[K, V], child int) error {
+	if lv == len(b.levels) {
+		b.levels = append(b.levels, &bulkLevel[K, V]{})
+	}
+	l := b.levels[lv]
+	isLeaf := lv == 0
+	size := KEY_LEN_SIZE + b.t.codec.key.Size(key) + POINTER_SIZE
+	if isLeaf {
+		size = RECORD_HEADER + b.t.codec.key.Size(key) + b.t.codec.value.Size(rec.value)
+	}
+
+	if l.cur != nil && b.full(l, size) {
+		if l.prev != nil {
+			if err := b.emit(lv, l.prev, l.prevLow); err != nil {
+				return err
+			}
+		}
+		l.prev, l.prevLow = l.cur, l.curLow
+		l.cur = nil
+	}
+	if l.cur == nil {
+		l.cur = &Page[K, V]{isLeaf: isLeaf, codec: b.t.codec}
+		l.curLow = key
+		l.used = PAGE_HEADER_SIZE
+		if isLeaf {
+			// 叶子页要互相链接，创建时就分配页ID
+			l.cur.id = b.next
+			b.next++
+			if l.prev != nil {
+				l.prev.next = l.cur.id
+				l.cur.prev = l.prev.id
+			}
+		} else {
+			l.used += POINTER_SIZE
+		}
+	}
+
+	p := l.cur
+	if isLeaf {
+		p.keys = append(p.keys, key)
+		p.records = append(p.records, rec)
+		l.used += size
+		return nil
+	}
+	if len(p.children) > 0 {
+		p.keys = append(p.keys, key)
+		l.used += size
+	}
+	p.children = append(p.children, child)
+	return nil
+}
+
+// full 判断 cur 能否再放下大小为 size 的一项: 超过阶数或一页时必须换页，
+// 达到填充目标且自身不下溢时换页
+func (b *bulkLoader[K, V]) full(l *bulkLevel[K, V], size int) bool {
+	p := l.cur
+	if len(p.keys)+1 > b.t.order || l.used+size > PAGE_SIZE {
+		return true
+	}
+	return (len(p.keys) >= b.keys || l.used+size > b.bytes) && !b.t.underflow(p)
+}
+
+// emit 第 lv 层的页 p 构建完成: 写出并交给上一层
+func (b *bulkLoader[K, V]) emit(lv int, p *Page[K, V], low K) error {
+	if err := b.store(p); err != nil {
+		return err
+	}
+	return b.add(lv+1, low, nil, p.id)
+}
+
+// store 写出构建好的页，内部页此时才分配页ID
+func (b *bulkLoader[K, V]) store(p *Page[K, V]) error {
+	if !p.isLeaf {
+		p.id = b.next
+		b.next++
+	}
+	p.freeSpace = PAGE_SIZE - p.usedSpace()
+	if b.t.file == nil {
+		b.pages = append(b.pages, p)
+		return nil
+	}
+	if err := encodePage(p, b.buf); err != nil {
+		return err
+	}
+	return b.t.file.writePage(p.id, b.buf)
+}
+
+// finish 自底向上结束各层，返回根页ID。只剩一页的最高层就是根页
+func (b *bulkLoader[K, V]) finish() (int, error) {
+	for lv := 0; ; lv++ {
+		l := b.levels[lv]
+		if l.prev != nil && b.t.underflow(l.cur) {
+			b.balance(l)
+		}
+		if l.prev == nil && lv == len(b.levels)-1 {
+			err := b.store(l.cur)
+			return l.cur.id, err
+		}
+		if l.prev != nil {
+			if err := b.emit(lv, l.prev, l.prevLow); err != nil {
+				return 0, err
+			}
+		}
+		if err := b.emit(lv, l.cur, l.curLow); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// balance 最后一页下溢: 与前一页合计放得进一页时合并，否则按分裂的规则重新分成两页。
+// 内部页还没有页ID；叶子层结束时 cur 是最后分配的页，合并后直接收回它的页ID
+func (b *bulkLoader[K, V]) balance(l *bulkLevel[K, V]) {
+	t := b.t
+	prev, cur := l.prev, l.cur
+	all := &Page[K, V]{isLeaf: prev.isLeaf, codec: t.codec}
+	if prev.isLeaf {
+		all.keys = slices.Concat(prev.keys, cur.keys)
+		all.records = slices.Concat(prev.records, cur.records)
+	} else {
+		all.keys = slices.Concat(prev.keys, []K{l.curLow}, cur.keys)
+		all.children = slices.Concat(prev.children, cur.children)
+	}
+
+	if !t.overflow(all) {
+		prev.keys, prev.records, prev.children = all.keys, all.records, all.children
+		if prev.isLeaf {
+			prev.next = META_PAGE_ID
+			b.next--
+		}
+		l.cur, l.curLow = prev, l.prevLow
+		l.prev = nil
+		return
+	}
+
+	// 两页共用同一个底层数组，截断容量以免之后插入时互相覆盖
+	s := t.splitIndex(all)
+	if prev.isLeaf {
+		prev.keys, cur.keys = all.keys[:s:s], all.keys[s:]
+		prev.records, cur.records = all.records[:s:s], all.records[s:]
+		l.curLow = cur.keys[0]
+		return
+	}
+	prev.keys, prev.children = all.keys[:s:s], all.children[:s+1:s+1]
+	l.curLow = all.keys[s]
+	cur.keys, cur.children = all.keys[s+1:], all.children[s+1:]
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// seqRecords 键为 0..n-1 的有序记录，值长度由 valueLen 决定
+func seqRecords(n int, valueLen func(i int) int) func(yield func(int, string) bool) {
+	return func(yield func(int, string) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(i, fmt.Sprint(i, strings.Repeat("v", valueLen(i)))) {
+				return
+			}
+		}
+	}
+}
+
+// checkLoaded 校验装载后的树恰好含有 seqRecords 产生的记录，且之后还能正常增删
+func checkLoaded(t *testing.T, tree *BPlusTree[int, string], n int, valueLen func(i int) int) {
+	t.Helper()
+	got := checkTree(t, tree)
+	if len(got) != n {
+		t.Fatalf("got %d records, want %d", len(got), n)
+	}
+	want := make(map[int]string, n)
+	for i := 0; i < n; i++ {
+		want[i] = fmt.Sprint(i, strings.Repeat("v", valueLen(i)))
+		if got[i] != want[i] {
+			t.Fatalf("key %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	rng := rand.New(rand.NewSource(int64(n)))
+	applyRandomOps(t, tree, rng, 200, n+10, want)
+}
+
+func TestBulkLoad(t *testing.T) {
+	short := func(int) int { return 0 }
+	mixed := func(i int) int { return (i * 37) % 300 }
+	for _, order := range []int{3, 4, 7, 64} {
+		for _, fill := range []float64{0.5, 0.7, 1} {
+			for _, n := range []int{1, 2, 3, 5, 10, 100, 1000} {
+				for name, valueLen := range map[string]func(int) int{"short": short, "mixed": mixed} {
+					t.Run(fmt.Sprintf("order%d/fill%v/n%d/%s", order, fill, n, name), func(t *testing.T) {
+						tree := NewBPlusTree(order)
+						loaded, err := tree.BulkLoad(seqRecords(n, valueLen), fill)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if loaded != n {
+							t.Fatalf("loaded %d records, want %d", loaded, n)
+						}
+						checkLoaded(t, tree, n, valueLen)
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestBulkLoadFillFactor 填充因子决定叶子页数
+func TestBulkLoadFillFactor(t *testing.T) {
+	const n = 10000
+	for _, tc := range []struct {
+		fill   float64
+		leaves int
+	}{
+		{1, n / 64},
+		{0.5, n / 32},
+	} {
+		tree := NewBPlusTree(64)
+		if _, err := tree.BulkLoad(seqRecords(n, func(int) int { return 0 }), tc.fill); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		leaves := 0
+		first, err := tree.edgeLeaf(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id := first.id; id != META_PAGE_ID; leaves++ {
+			p, err := tree.pool.FetchPage(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree.pool.UnpinPage(p)
+			id = p.next
+		}
+		// 最后两页可能重新分配
+		if leaves < tc.leaves || leaves > tc.leaves+2 {
+			t.Errorf("fill %v: %d leaves, want about %d", tc.fill, leaves, tc.leaves)
+		}
+	}
+}
+
+// TestBulkLoadRejects 乱序输入、非空树时报错，树保持不变
+func TestBulkLoadRejects(t *testing.T) {
+	tree := NewBPlusTree(4)
+	unsorted := func(yield func(int, string) bool) {
+		for _, k := range []int{1, 2, 3, 5, 4} {
+			if !yield(k, "v") {
+				return
+			}
+		}
+	}
+	if _, err := tree.BulkLoad(unsorted, 1); !errors.Is(err, ErrNotSorted) {
+		t.Fatalf("unsorted: got %v, want ErrNotSorted", err)
+	}
+	if got := checkTree(t, tree); len(got) != 0 {
+		t.Fatalf("failed load left %d records", len(got))
+	}
+
+	if err := tree.Insert(1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.BulkLoad(seqRecords(10, func(int) int { return 0 }), 1); !errors.Is(err, ErrNotEmpty) {
+		t.Fatalf("non-empty: got %v, want ErrNotEmpty", err)
+	}
+	if got := checkTree(t, tree); len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+}
+
+func TestBatchInsert(t *testing.T) {
+	tree := NewBPlusTree(4)
+	records := make(map[int]string)
+	for i := 0; i < 500; i++ {
+		records[i*2] = fmt.Sprint("a", i)
+	}
+	if err := tree.BatchInsert(maps.All(records)); err != nil {
+		t.Fatal(err)
+	}
+	// 非空树上逐条插入，重复的键以最后一次为准
+	more := func(yield func(int, string) bool) {
+		for i := 0; i < 100; i++ {
+			if !yield(i, "b") || !yield(i, fmt.Sprint("c", i)) {
+				return
+			}
+		}
+	}
+	if err := tree.BatchInsert(more); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		records[i] = fmt.Sprint("c", i)
+	}
+	got := checkTree(t, tree)
+	if !maps.Equal(got, records) {
+		t.Fatalf("got %d records, want %d", len(got), len(records))
+	}
+}
+
+func TestLoadCSV(t *testing.T) {
+	tree := NewBPlusTree(4)
+	_, err := LoadCSV(tree, strings.NewReader("1,a\n2,b\nx,c\n"), 1)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("bad key: got %v", err)
+	}
+	if got := checkTree(t, tree); len(got) != 0 {
+		t.Fatalf("failed load left %d records", len(got))
+	}
+
+	n, err := LoadCSV(tree, strings.NewReader("# id,name\n1,a\n2,\"b, c\"\n10, d\n"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{1: "a", 2: "b, c", 10: " d"}
+	if got := checkTree(t, tree); n != 3 || !maps.Equal(got, want) {
+		t.Fatalf("loaded %d: got %v, want %v", n, got, want)
+	}
+}
+
+// TestBulkLoadOnDisk 装载的页不经过日志: 提交后崩溃不丢数据，提交前崩溃树仍为空
+func TestBulkLoadOnDisk(t *testing.T) {
+	const n = 20000
+	valueLen := func(i int) int { return i % 50 }
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithOrder(16), WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var csv strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&csv, "%d,%d%s\n", i, i, strings.Repeat("v", valueLen(i)))
+	}
+	// 数据源中途出错: 已写出的页留在文件末尾，但不属于树
+	if _, err := LoadCSV(tree, strings.NewReader(csv.String()+"oops\n"), 0.8); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	crash(tree)
+	if tree, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkTree(t, tree); len(got) != 0 {
+		t.Fatalf("failed load left %d records", len(got))
+	}
+
+	loaded, err := LoadCSV(tree, strings.NewReader(csv.String()), 0.8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != n {
+		t.Fatalf("loaded %d records, want %d", loaded, n)
+	}
+	crash(tree)
+	if tree, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	checkLoaded(t, tree, n, valueLen)
+}
+
+// BenchmarkBatchInsert 比较逐条随机插入与排序后自底向上装载
+func BenchmarkBatchInsert(b *testing.B) {
+	const n = 100000
+	records := make(map[int]string, n)
+	for i := 0; i < n; i++ {
+		records[i] = fmt.Sprint("v", i)
+	}
+	insert := func(tree *BPlusTree[int, string]) error {
+		for k, v := range records {
+			if err := tree.Insert(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	bulk := func(tree *BPlusTree[int, string]) error {
+		return tree.BatchInsert(maps.All(records))
+	}
+	for _, disk := range []bool{false, true} {
+		for name, load := range map[string]func(*BPlusTree[int, string]) error{"insert": insert, "bulk": bulk} {
+			b.Run(fmt.Sprintf("%s/disk=%v", name, disk), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					tree := NewBPlusTree(64)
+					if disk {
+						var err error
+						tree, err = Open(filepath.Join(b.TempDir(), "tree.db"), WithOrder(64), WithSync(false))
+						if err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.StartTimer()
+					if err := load(tree); err != nil {
+						b.Fatal(err)
+					}
+					b.StopTimer()
+					tree.Close()
+				}
+				b.ReportMetric(float64(n)*float64(b.N)/b.Elapsed().Seconds(), "records/s")
+			})
+		}
+	}
+}
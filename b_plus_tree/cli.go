@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cg917658910/go-study/lib/repl"
+)
+
+// session 命令行会话的状态
+type session struct {
+	tree *BPlusTree[int, string]
+	tx   *Txn[int, string] // 当前事务，为 nil 时每条命令立即提交
+	fill float64           // load 命令默认的填充因子
+}
+
+// entry JSON输出中的一条记录
+type entry struct {
+	Key   int    `json:"key"`
+	Value string `json:"value"`
+}
+
+// lookup JSON输出中 search 的结果
+type lookup struct {
+	Key     int    `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Found   bool   `json:"found"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// interpreter 创建会话的命令解释器
+func (s *session) interpreter() *repl.Interpreter {
+	in := repl.New("MySQL风格B+树实现（完整版）",
+		repl.Command{Name: "insert", Usage: "<key> [value]", Help: "插入记录，省略值时为 v<key>", Args: 1, Run: s.insert},
+		repl.Command{Name: "delete", Usage: "<key>", Help: "删除记录", Args: 1, Run: s.delete},
+		repl.Command{Name: "batch_insert", Usage: "<key1:value1,key2:value2,...>", Help: "批量插入", Args: 1, Run: s.batchInsert},
+		repl.Command{Name: "batch_delete", Usage: "<key1,key2,...>", Help: "批量删除", Args: 1, Run: s.batchDelete},
+		repl.Command{Name: "load", Usage: "<file> [fill]", Help: "把按键升序的 key,value CSV 文件批量装入空树", Args: 1, Run: s.load},
+		repl.Command{Name: "search", Usage: "<key>", Help: "搜索记录", Args: 1, Run: s.search},
+		repl.Command{Name: "range", Usage: "<lo> <hi>", Help: "按键序输出 [lo, hi] 内的记录", Args: 2, Run: s.rangeScan},
+		repl.Command{Name: "scan", Usage: "[from]", Help: "从 from(默认最小键)开始按键序输出所有记录", Run: s.scan},
+		repl.Command{Name: "print", Help: "打印树结构", Run: func(c *repl.Context, _ []string) error {
+			return s.tree.Print(c.Writer())
+		}},
+		repl.Command{Name: "stats", Help: "输出树高、页数、填充率、碎片率等统计信息", Run: s.stats},
+		repl.Command{Name: "dot", Usage: "<file>", Help: "把页图导出为 Graphviz DOT 文件", Args: 1, Run: s.dot},
+		repl.Command{Name: "check", Help: "校验树的不变式", Run: s.check},
+		repl.Command{Name: "checkpoint", Help: "脏页写回数据文件并清空日志", Run: s.checkpoint},
+		repl.Command{Name: "vacuum", Help: "清理已标记删除的记录", Run: s.vacuum},
+		repl.Command{Name: "begin", Help: "开始事务，之后的 insert/delete/search 在事务快照中执行", Run: s.begin},
+		repl.Command{Name: "commit", Help: "提交事务", Run: s.commit},
+		repl.Command{Name: "rollback", Help: "回滚事务", Run: s.rollback},
+	)
+	in.Prompt = func() string {
+		if s.tx != nil {
+			return fmt.Sprintf("tx%d> ", s.tx.ID())
+		}
+		return "> "
+	}
+	return in
+}
+
+// parseKey 解析整数键
+func parseKey(arg string) (int, error) {
+	key, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("无效键: %s", arg)
+	}
+	return key, nil
+}
+
+func (s *session) insert(c *repl.Context, args []string) error {
+	key, err := parseKey(args[0])
+	if err != nil {
+		return err
+	}
+	value := "v" + args[0]
+	if len(args) > 1 {
+		value = strings.Join(args[1:], " ")
+	}
+	if s.tx != nil {
+		if err := s.tx.Put(key, value); err != nil {
+			return fmt.Errorf("插入失败: %w", err)
+		}
+		c.Infof("已插入记录(未提交): %d -> %s\n", key, value)
+		return nil
+	}
+	if err := s.tree.Insert(key, value); err != nil {
+		return fmt.Errorf("插入失败: %w", err)
+	}
+	c.Infof("已插入记录: %d -> %s\n", key, value)
+	return nil
+}
+
+func (s *session) delete(c *repl.Context, args []string) error {
+	key, err := parseKey(args[0])
+	if err != nil {
+		return err
+	}
+	var found bool
+	if s.tx != nil {
+		found, err = s.tx.Delete(key)
+	} else {
+		found, err = s.tree.Delete(key)
+	}
+	if err != nil {
+		return fmt.Errorf("删除失败: %w", err)
+	}
+	if found {
+		c.Infof("已删除键 %d\n", key)
+	} else {
+		c.Printf("键 %d 未找到\n", key)
+	}
+	return nil
+}
+
+func (s *session) batchInsert(c *repl.Context, args []string) error {
+	records := make(map[int]string)
+	for _, pair := range strings.Split(args[0], ",") {
+		k, v, ok := strings.Cut(pair, ":")
+		if !ok {
+			c.Printf("无效键值对: %s\n", pair)
+			continue
+		}
+		key, err := strconv.Atoi(k)
+		if err != nil {
+			c.Printf("无效键: %s\n", k)
+			continue
+		}
+		records[key] = v
+	}
+	if s.tx != nil {
+		// 事务中逐条写入事务，提交时一起生效
+		for key, value := range records {
+			if err := s.tx.Put(key, value); err != nil {
+				return fmt.Errorf("批量插入失败: %w", err)
+			}
+		}
+		c.Infof("已批量插入 %d 条记录(未提交)\n", len(records))
+		return nil
+	}
+	if err := s.tree.BatchInsert(maps.All(records)); err != nil {
+		return fmt.Errorf("批量插入失败: %w", err)
+	}
+	c.Infof("已批量插入 %d 条记录\n", len(records))
+	return nil
+}
+
+func (s *session) batchDelete(c *repl.Context, args []string) error {
+	var keys []int
+	for _, k := range strings.Split(args[0], ",") {
+		key, err := strconv.Atoi(k)
+		if err != nil {
+			c.Printf("无效键: %s\n", k)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if s.tx != nil {
+		for _, key := range keys {
+			if _, err := s.tx.Delete(key); err != nil {
+				return fmt.Errorf("批量删除失败: %w", err)
+			}
+		}
+		c.Infof("已批量删除 %d 个键(未提交)\n", len(keys))
+		return nil
+	}
+	if err := s.tree.BatchDelete(keys); err != nil {
+		return fmt.Errorf("批量删除失败: %w", err)
+	}
+	c.Infof("已批量删除 %d 个键\n", len(keys))
+	return nil
+}
+
+func (s *session) load(c *repl.Context, args []string) error {
+	if err := s.noTxn("load"); err != nil {
+		return err
+	}
+	fill := s.fill
+	if len(args) > 1 {
+		var err error
+		if fill, err = strconv.ParseFloat(args[1], 64); err != nil {
+			return fmt.Errorf("无效填充因子: %s", args[1])
+		}
+	}
+	n, err := loadFile(s.tree, args[0], fill)
+	if err != nil {
+		return fmt.Errorf("批量装载失败: %w", err)
+	}
+	c.Infof("已批量装载 %d 条记录\n", n)
+	return nil
+}
+
+func (s *session) search(c *repl.Context, args []string) error {
+	key, err := parseKey(args[0])
+	if err != nil {
+		return err
+	}
+	res := lookup{Key: key}
+	if s.tx != nil {
+		if res.Value, res.Found, err = s.tx.Get(key); err != nil {
+			return fmt.Errorf("搜索失败: %w", err)
+		}
+	} else {
+		record, err := s.tree.Search(key)
+		if err != nil {
+			return fmt.Errorf("搜索失败: %w", err)
+		}
+		if record != nil {
+			res.Value, res.Found, res.Deleted = record.value, record.status == 0, record.status != 0
+		}
+	}
+	switch {
+	case res.Found:
+		c.Printf("找到记录: %d -> %s\n", key, res.Value)
+	case res.Deleted:
+		res.Value = ""
+		c.Printf("键 %d 已被删除\n", key)
+	default:
+		c.Printf("键 %d 未找到\n", key)
+	}
+	c.Result(res)
+	return nil
+}
+
+// noTxn 事务进行中时拒绝直接读写树的命令，它们看不到事务快照，写入也不经过事务
+func (s *session) noTxn(name string) error {
+	if s.tx != nil {
+		return fmt.Errorf("事务 %d 进行中，%s 不在事务中执行，请先提交或回滚", s.tx.ID(), name)
+	}
+	return nil
+}
+
+func (s *session) rangeScan(c *repl.Context, args []string) error {
+	if err := s.noTxn("range"); err != nil {
+		return err
+	}
+	lo, err := parseKey(args[0])
+	if err != nil {
+		return err
+	}
+	hi, err := parseKey(args[1])
+	if err != nil {
+		return err
+	}
+	records, err := s.tree.Range(lo, hi)
+	if err != nil {
+		return fmt.Errorf("范围查询失败: %w", err)
+	}
+	entries := make([]entry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, entry{record.key, record.value})
+	}
+	printEntries(c, entries)
+	return nil
+}
+
+func (s *session) scan(c *repl.Context, args []string) error {
+	if err := s.noTxn("scan"); err != nil {
+		return err
+	}
+	cursor := s.tree.NewCursor()
+	if len(args) == 0 {
+		cursor.First()
+	} else {
+		from, err := parseKey(args[0])
+		if err != nil {
+			return err
+		}
+		cursor.Seek(from)
+	}
+	entries := []entry{}
+	for ; cursor.Valid(); cursor.Next() {
+		entries = append(entries, entry{cursor.Key(), cursor.Value()})
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("扫描失败: %w", err)
+	}
+	printEntries(c, entries)
+	return nil
+}
+
+// printEntries 逐条输出记录和总数
+func printEntries(c *repl.Context, entries []entry) {
+	for _, e := range entries {
+		c.Printf("%d -> %s\n", e.Key, e.Value)
+	}
+	c.Printf("共 %d 条记录\n", len(entries))
+	c.Result(entries)
+}
+
+func (s *session) stats(c *repl.Context, _ []string) error {
+	stats, err := s.tree.Stats()
+	if err != nil {
+		return fmt.Errorf("统计失败: %w", err)
+	}
+	c.Println(stats)
+	c.Result(stats)
+	return nil
+}
+
+func (s *session) dot(c *repl.Context, args []string) error {
+	if err := writeDOTFile(s.tree, args[0]); err != nil {
+		return fmt.Errorf("导出失败: %w", err)
+	}
+	c.Infof("已导出到 %s，可用 dot -Tsvg %s -o tree.svg 查看\n", args[0], args[0])
+	return nil
+}
+
+func (s *session) check(c *repl.Context, _ []string) error {
+	if err := s.tree.Validate(); err != nil {
+		return fmt.Errorf("校验失败: %w", err)
+	}
+	c.Println("校验通过")
+	return nil
+}
+
+func (s *session) checkpoint(c *repl.Context, _ []string) error {
+	if err := s.tree.Checkpoint(); err != nil {
+		return fmt.Errorf("检查点失败: %w", err)
+	}
+	c.Infof("检查点完成\n")
+	return nil
+}
+
+func (s *session) vacuum(c *repl.Context, _ []string) error {
+	n, err := s.tree.Vacuum()
+	if err != nil {
+		return fmt.Errorf("清理失败: %w", err)
+	}
+	c.Infof("已清理 %d 条已删除记录\n", n)
+	return nil
+}
+
+func (s *session) begin(c *repl.Context, _ []string) error {
+	if s.tx != nil {
+		return fmt.Errorf("事务 %d 尚未结束", s.tx.ID())
+	}
+	s.tx = s.tree.Begin()
+	c.Infof("事务 %d 已开始\n", s.tx.ID())
+	return nil
+}
+
+func (s *session) commit(c *repl.Context, _ []string) error {
+	if s.tx == nil {
+		return fmt.Errorf("没有进行中的事务")
+	}
+	tx := s.tx
+	s.tx = nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交失败: %w", err)
+	}
+	c.Infof("事务 %d 已提交\n", tx.ID())
+	return nil
+}
+
+func (s *session) rollback(c *repl.Context, _ []string) error {
+	if s.tx == nil {
+		return fmt.Errorf("没有进行中的事务")
+	}
+	tx := s.tx
+	s.tx = nil
+	if err := tx.Rollback(); err != nil {
+		return fmt.Errorf("回滚失败: %w", err)
+	}
+	c.Infof("事务 %d 已回滚\n", tx.ID())
+	return nil
+}
+
+// loadFile 把CSV文件批量装入树，path 为 "-" 时读标准输入
+func loadFile(tree *BPlusTree[int, string], path string, fill float64) (int, error) {
+	if path == "-" {
+		return LoadCSV(tree, os.Stdin, fill)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return LoadCSV(tree, bufio.NewReaderSize(f, 1<<16), fill)
+}
+
+// writeDOTFile 把页图导出到 DOT 文件
+func writeDOTFile(tree *BPlusTree[int, string], path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tree.WriteDOT(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
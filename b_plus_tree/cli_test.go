@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cg917658910/go-study/lib/repl"
+	"github.com/cg917658910/go-study/lib/repl/repltest"
+)
+
+// TestScripts 执行 testdata 下的命令脚本，与 *.golden 对照输出
+func TestScripts(t *testing.T) {
+	repltest.Golden(t, "testdata", func(t *testing.T) *repl.Interpreter {
+		s := &session{tree: NewBPlusTree(3), fill: DEFAULT_FILL_FACTOR}
+		return s.interpreter()
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Codec 把键或值编码成页中的字节。页中每个键值都单独记录长度，
+// 因此 Decode 收到的 src 恰好是一次 Encode 的结果
+type Codec[T any] interface {
+	Size(v T) int                 // 编码后的字节数
+	Encode(dst []byte, v T)       // 编码到 dst[:Size(v)]
+	Decode(src []byte) (T, error) // 解码，src 在返回后会被复用
+}
+
+// IntCodec 按8字节小端编码 int
+type IntCodec struct{}
+
+func (IntCodec) Size(int) int { return 8 }
+
+func (IntCodec) Encode(dst []byte, v int) {
+	binary.LittleEndian.PutUint64(dst, uint64(v))
+}
+
+func (IntCodec) Decode(src []byte) (int, error) {
+	if len(src) != 8 {
+		return 0, fmt.Errorf("%w: int of %d bytes", ErrCorruptPage, len(src))
+	}
+	return int(int64(binary.LittleEndian.Uint64(src))), nil
+}
+
+// StringCodec 原样编码字符串
+type StringCodec struct{}
+
+func (StringCodec) Size(v string) int { return len(v) }
+
+func (StringCodec) Encode(dst []byte, v string) { copy(dst, v) }
+
+func (StringCodec) Decode(src []byte) (string, error) { return string(src), nil }
+
+// BytesCodec 原样编码字节切片，解码时复制一份
+type BytesCodec struct{}
+
+func (BytesCodec) Size(v []byte) int { return len(v) }
+
+func (BytesCodec) Encode(dst []byte, v []byte) { copy(dst, v) }
+
+func (BytesCodec) Decode(src []byte) ([]byte, error) { return append([]byte{}, src...), nil }
+
+// Pair 由两部分组成的复合键，例如 (租户, ID)
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// ComparePair 先比较 First，相等时再比较 Second
+func ComparePair[A, B any](first func(a, b A) int, second func(a, b B) int) func(x, y Pair[A, B]) int {
+	return func(x, y Pair[A, B]) int {
+		if c := first(x.First, y.First); c != 0 {
+			return c
+		}
+		return second(x.Second, y.Second)
+	}
+}
+
+// PairCodec 编码复合键: First 的长度(uvarint) + First + Second
+func PairCodec[A, B any](first Codec[A], second Codec[B]) Codec[Pair[A, B]] {
+	return pairCodec[A, B]{first: first, second: second}
+}
+
+type pairCodec[A, B any] struct {
+	first  Codec[A]
+	second Codec[B]
+}
+
+func (c pairCodec[A, B]) Size(v Pair[A, B]) int {
+	n := c.first.Size(v.First)
+	return uvarintLen(uint64(n)) + n + c.second.Size(v.Second)
+}
+
+func (c pairCodec[A, B]) Encode(dst []byte, v Pair[A, B]) {
+	n := c.first.Size(v.First)
+	off := binary.PutUvarint(dst, uint64(n))
+	c.first.Encode(dst[off:off+n], v.First)
+	c.second.Encode(dst[off+n:], v.Second)
+}
+
+func (c pairCodec[A, B]) Decode(src []byte) (Pair[A, B], error) {
+	var v Pair[A, B]
+	n, off := binary.Uvarint(src)
+	if off <= 0 || uint64(len(src)-off) < n {
+		return v, fmt.Errorf("%w: bad pair encoding", ErrCorruptPage)
+	}
+	var err error
+	end := off + int(n)
+	if v.First, err = c.first.Decode(src[off:end]); err != nil {
+		return v, err
+	}
+	v.Second, err = c.second.Decode(src[end:])
+	return v, err
+}
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
+// codecs 树的键比较函数与键值编码
+type codecs[K, V any] struct {
+	cmp   func(a, b K) int
+	key   Codec[K]
+	value Codec[V]
+}
+
+// encodeKey 把键编码成可作为 map 键的字符串
+func (c *codecs[K, V]) encodeKey(key K) string {
+	buf := make([]byte, c.key.Size(key))
+	c.key.Encode(buf, key)
+	return string(buf)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStringKeys(t *testing.T) {
+	// 阶数取最大值，内部页只能按字节分裂
+	tree := New(strings.Compare, StringCodec{}, StringCodec{}, maxOrder())
+	rng := rand.New(rand.NewSource(3))
+	want := make(map[string]string)
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("%s-%d", strings.Repeat("k", rng.Intn(MAX_KEY_SIZE-16)), rng.Intn(1000))
+		if rng.Intn(3) == 0 {
+			if _, err := tree.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, key)
+		} else {
+			if err := tree.Insert(key, key[len(key)-3:]); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = key[len(key)-3:]
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after op %d: %v", i, err)
+		}
+	}
+
+	var keys []string
+	for k, v := range tree.All() {
+		if want[k] != v {
+			t.Fatalf("key %q: %q, want %q", k, v, want[k])
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) != len(want) || !slices.IsSorted(keys) {
+		t.Fatalf("All() returned %d keys (sorted: %v), want %d", len(keys), slices.IsSorted(keys), len(want))
+	}
+
+	if err := tree.Insert(strings.Repeat("x", MAX_KEY_SIZE+1), ""); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("oversized key: %v, want ErrKeyTooLarge", err)
+	}
+}
+
+func TestCompositeKeys(t *testing.T) {
+	type key = Pair[string, int]
+	compare := ComparePair(strings.Compare, cmp.Compare[int])
+	path := filepath.Join(t.TempDir(), "tenants.db")
+	open := func() *BPlusTree[key, string] {
+		tree, err := OpenTree(path, compare, PairCodec[string, int](StringCodec{}, IntCodec{}), StringCodec{},
+			WithOrder(5), WithPoolSize(8), WithSync(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+
+	tree := open()
+	for _, tenant := range []string{"acme", "globex", "initech"} {
+		for id := 0; id < 100; id++ {
+			if err := tree.Insert(key{tenant, id}, fmt.Sprintf("%s/%d", tenant, id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree = open()
+	defer tree.Close()
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// 同一租户的记录在键序上连续
+	records, err := tree.Range(key{"globex", 10}, key{"globex", 19})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 {
+		t.Fatalf("Range returned %d records, want 10", len(records))
+	}
+	for i, rec := range records {
+		if rec.key != (key{"globex", 10 + i}) || rec.value != fmt.Sprintf("globex/%d", 10+i) {
+			t.Errorf("record %d: %v -> %q", i, rec.key, rec.value)
+		}
+	}
+	c, err := tree.Scan(key{"globex", 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Key() != (key{"initech", 0}) {
+		t.Errorf("Scan past the last globex id at %v, want {initech 0}", c.Key())
+	}
+}
+
+func TestBytesKeys(t *testing.T) {
+	tree := New(bytes.Compare, BytesCodec{}, BytesCodec{}, 4)
+	rng := rand.New(rand.NewSource(5))
+	var want [][]byte
+	for i := 0; i < 1000; i++ {
+		k := make([]byte, 1+rng.Intn(20))
+		rng.Read(k)
+		if err := tree.Insert(k, k); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, k)
+	}
+	slices.SortFunc(want, bytes.Compare)
+	want = slices.CompactFunc(want, bytes.Equal)
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	i := 0
+	for k, v := range tree.All() {
+		if !bytes.Equal(k, want[i]) || !bytes.Equal(v, want[i]) {
+			t.Fatalf("key %d: %x -> %x, want %x", i, k, v, want[i])
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Fatalf("All() returned %d keys, want %d", i, len(want))
+	}
+
+	// 不可比较的键也支持事务
+	tx := tree.Begin()
+	if _, err := tx.Delete(want[0]); err != nil {
+		t.Fatal(err)
+	}
+	other := tree.Begin()
+	if err := other.Put(want[0], nil); !errors.Is(err, ErrWriteConflict) {
+		t.Errorf("concurrent write: %v, want ErrWriteConflict", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := other.Get(want[0]); !found {
+		t.Errorf("deleted key missing from an older snapshot")
+	}
+	other.Rollback()
+	if rec, _ := tree.Search(want[0]); rec != nil {
+		t.Errorf("deleted key still in the tree: %v", rec)
+	}
+}
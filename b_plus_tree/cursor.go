@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+)
+
+// Cursor 沿双向叶子链表移动的游标，自动跳过已标记删除的记录。
+// 游标不长期固定页: 每次移动时按记下的键重新定位，
+// 因此在两次移动之间修改树也是安全的，游标会停在修改后的相邻记录上。
+// 同一个游标不能在多个goroutine中使用，不同游标可以与其他操作并发。
+type Cursor[K, V any] struct {
+	tree   *BPlusTree[K, V]
+	pageID int // 当前叶子页ID
+	idx    int // 页内位置
+	key    K
+	value  V
+	valid  bool
+	err    error
+}
+
+// NewCursor 创建一个尚未定位的游标
+func (t *BPlusTree[K, V]) NewCursor() *Cursor[K, V] {
+	return &Cursor[K, V]{tree: t}
+}
+
+// Scan 返回定位在第一条键不小于 from 的记录上的游标
+func (t *BPlusTree[K, V]) Scan(from K) (*Cursor[K, V], error) {
+	c := t.NewCursor()
+	c.Seek(from)
+	return c, c.err
+}
+
+// ScanReverse 返回定位在最后一条键不大于 from 的记录上的游标，配合 Prev 逆序遍历
+func (t *BPlusTree[K, V]) ScanReverse(from K) (*Cursor[K, V], error) {
+	c := t.NewCursor()
+	c.SeekReverse(from)
+	return c, c.err
+}
+
+// Range 返回键在 [lo, hi] 内的全部记录
+func (t *BPlusTree[K, V]) Range(lo, hi K) ([]*Record[K, V], error) {
+	c, err := t.Scan(lo)
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record[K, V]
+	for ; c.Valid() && t.codec.cmp(c.key, hi) <= 0; c.Next() {
+		records = append(records, &Record[K, V]{key: c.key, value: c.value})
+	}
+	return records, c.Err()
+}
+
+// All 按键升序遍历所有记录，读页出错时提前结束(需要错误信息时使用 Cursor)
+func (t *BPlusTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c := t.NewCursor()
+		for c.First(); c.Valid(); c.Next() {
+			if !yield(c.key, c.value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward 按键降序遍历所有记录，读页出错时提前结束
+func (t *BPlusTree[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c := t.NewCursor()
+		for c.Last(); c.Valid(); c.Prev() {
+			if !yield(c.key, c.value) {
+				return
+			}
+		}
+	}
+}
+
+// Valid 游标是否停在一条记录上
+func (c *Cursor[K, V]) Valid() bool {
+	return c.valid
+}
+
+// Key 当前记录的键
+func (c *Cursor[K, V]) Key() K {
+	return c.key
+}
+
+// Value 当前记录的值
+func (c *Cursor[K, V]) Value() V {
+	return c.value
+}
+
+// Err 返回移动游标时遇到的错误
+func (c *Cursor[K, V]) Err() error {
+	return c.err
+}
+
+// First 定位到第一条记录
+func (c *Cursor[K, V]) First() bool {
+	o, err := c.begin()
+	if err != nil {
+		return c.fail(err)
+	}
+	defer c.end(o)
+	p, err := o.edgeLeaf(false)
+	if err != nil {
+		return c.fail(err)
+	}
+	return c.forward(o, p, 0)
+}
+
+// Last 定位到最后一条记录
+func (c *Cursor[K, V]) Last() bool {
+	o, err := c.begin()
+	if err != nil {
+		return c.fail(err)
+	}
+	defer c.end(o)
+	p, err := o.edgeLeaf(true)
+	if err != nil {
+		return c.fail(err)
+	}
+	return c.backward(o, p, len(p.keys)-1)
+}
+
+// Seek 定位到第一条键不小于 key 的记录
+func (c *Cursor[K, V]) Seek(key K) bool {
+	o, err := c.begin()
+	if err != nil {
+		return c.fail(err)
+	}
+	defer c.end(o)
+	p, i, _, err := c.locate(o, key)
+	if err != nil {
+		return c.fail(err)
+	}
+	return c.forward(o, p, i)
+}
+
+// SeekReverse 定位到最后一条键不大于 key 的记录
+func (c *Cursor[K, V]) SeekReverse(key K) bool {
+	o, err := c.begin()
+	if err != nil {
+		return c.fail(err)
+	}
+	defer c.end(o)
+	p, i, exact, err := c.locate(o, key)
+	if err != nil {
+		return c.fail(err)
+	}
+	if exact {
+		return c.backward(o, p, i)
+	}
+	return c.backward(o, p, i-1)
+}
+
+// Next 移动到下一条记录
+func (c *Cursor[K, V]) Next() bool {
+	if !c.valid {
+		return false
+	}
+	o, err := c.begin()
+	if err != nil {
+		return c.fail(err)
+	}
+	defer c.end(o)
+	p, i, exact, err := c.reposition(o)
+	if err != nil {
+		return c.fail(err)
+	}
+	if exact {
+		i++
+	}
+	return c.forward(o, p, i)
+}
+
+// Prev 移动到上一条记录
+func (c *Cursor[K, V]) Prev() bool {
+	if !c.valid {
+		return false
+	}
+	o, err := c.begin()
+	if err != nil {
+		return c.fail(err)
+	}
+	defer c.end(o)
+	p, i, _, err := c.reposition(o)
+	if err != nil {
+		return c.fail(err)
+	}
+	return c.backward(o, p, i-1)
+}
+
+func (c *Cursor[K, V]) fail(err error) bool {
+	c.err = err
+	c.valid = false
+	return false
+}
+
+// begin 开始一次移动: 共享持有整棵树，移动结束时放开途经的全部闩锁
+func (c *Cursor[K, V]) begin() (*op[K, V], error) {
+	t := c.tree
+	if err := t.failure(); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	return t.newOp(readMode), nil
+}
+
+func (c *Cursor[K, V]) end(o *op[K, V]) {
+	o.releaseAll()
+	c.tree.mu.RUnlock()
+}
+
+// edgeLeaf 返回最左(或最右)的叶子页，不固定该页，调用方需独占整棵树
+func (t *BPlusTree[K, V]) edgeLeaf(rightmost bool) (*Page[K, V], error) {
+	if err := t.failure(); err != nil {
+		return nil, err
+	}
+	id := t.root
+	for {
+		p, err := t.pool.FetchPage(id)
+		if err != nil {
+			return nil, err
+		}
+		t.pool.UnpinPage(p)
+		if p.isLeaf {
+			return p, nil
+		}
+		if rightmost {
+			id = p.children[len(p.children)-1]
+		} else {
+			id = p.children[0]
+		}
+	}
+}
+
+// edgeLeaf 下降到最左(或最右)的叶子页
+func (o *op[K, V]) edgeLeaf(rightmost bool) (*Page[K, V], error) {
+	return o.descend(func(p *Page[K, V]) int {
+		if rightmost {
+			return len(p.children) - 1
+		}
+		return 0
+	})
+}
+
+// locate 找到 key 所在叶子页以及页内第一个不小于 key 的位置
+func (c *Cursor[K, V]) locate(o *op[K, V], key K) (p *Page[K, V], i int, exact bool, err error) {
+	t := c.tree
+	if p, err = o.findLeafPage(key); err != nil {
+		return nil, 0, false, err
+	}
+	i = t.searchIndex(p, key)
+	return p, i, i < len(p.keys) && t.codec.cmp(p.keys[i], key) == 0, nil
+}
+
+// reposition 回到游标记下的键: 页没有变化时直接使用原位置，否则重新查找
+func (c *Cursor[K, V]) reposition(o *op[K, V]) (*Page[K, V], int, bool, error) {
+	p, err := o.fetch(c.pageID)
+	if err == nil {
+		if p.isLeaf && !p.isFree && c.idx < len(p.keys) && c.tree.codec.cmp(p.keys[c.idx], c.key) == 0 {
+			return p, c.idx, true, nil
+		}
+		o.release(p)
+	}
+	return c.locate(o, c.key)
+}
+
+// step 持有页 p 的读闩锁时尝试获取相邻叶子页 id 的读闩锁，成功则放开 p。
+// 不能等待: 写操作可能持有相邻页而在等 p，此时返回 nil，由调用方放开 p 重新查找
+func (c *Cursor[K, V]) step(o *op[K, V], p *Page[K, V], id int) (*Page[K, V], error) {
+	pool := c.tree.pool
+	next, err := pool.FetchPage(id)
+	if err != nil {
+		return nil, err
+	}
+	if !next.latch.TryRLock() {
+		pool.UnpinPage(next)
+		return nil, nil
+	}
+	o.held[id] = latched[K, V]{page: next}
+	o.release(p)
+	if !next.isLeaf || next.isFree {
+		return nil, fmt.Errorf("%w: page %d is not a leaf", ErrCorruptPage, id)
+	}
+	return next, nil
+}
+
+// forward 从页 p 的第 i 项起向后找第一条未删除的记录
+func (c *Cursor[K, V]) forward(o *op[K, V], p *Page[K, V], i int) bool {
+	for {
+		for ; i < len(p.keys); i++ {
+			if rec := p.records[i]; rec.status != 1 {
+				return c.set(p, i, rec)
+			}
+		}
+		if p.next == META_PAGE_ID {
+			c.valid = false
+			return false
+		}
+		next, err := c.step(o, p, p.next)
+		if err != nil {
+			return c.fail(err)
+		}
+		if next != nil {
+			p, i = next, 0
+			continue
+		}
+		// 从本页最后一个键之后重新查找
+		last := p.keys[len(p.keys)-1]
+		o.release(p)
+		var exact bool
+		if p, i, exact, err = c.locate(o, last); err != nil {
+			return c.fail(err)
+		}
+		if exact {
+			i++
+		}
+	}
+}
+
+// backward 从页 p 的第 i 项起向前找第一条未删除的记录
+func (c *Cursor[K, V]) backward(o *op[K, V], p *Page[K, V], i int) bool {
+	for {
+		for ; i >= 0; i-- {
+			if rec := p.records[i]; rec.status != 1 {
+				return c.set(p, i, rec)
+			}
+		}
+		if p.prev == META_PAGE_ID {
+			c.valid = false
+			return false
+		}
+		prev, err := c.step(o, p, p.prev)
+		if err != nil {
+			return c.fail(err)
+		}
+		if prev != nil {
+			p, i = prev, len(prev.keys)-1
+			continue
+		}
+		// 从本页第一个键之前重新查找
+		first := p.keys[0]
+		o.release(p)
+		if p, i, _, err = c.locate(o, first); err != nil {
+			return c.fail(err)
+		}
+		i--
+	}
+}
+
+func (c *Cursor[K, V]) set(p *Page[K, V], i int, rec *Record[K, V]) bool {
+	c.pageID = p.id
+	c.idx = i
+	c.key = rec.key
+	c.value = rec.value
+	c.valid = true
+	return true
+}
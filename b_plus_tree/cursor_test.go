@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestTree(t *testing.T, keys []int) *BPlusTree[int, string] {
+	t.Helper()
+	tree := NewBPlusTree(3)
+	for _, k := range keys {
+		if err := tree.Insert(k, fmt.Sprint("v", k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+func TestRange(t *testing.T) {
+	tree := newTestTree(t, []int{50, 10, 40, 20, 30, 60, 70, 80, 90, 0})
+	records, err := tree.Range(15, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, rec := range records {
+		got = append(got, rec.key)
+		if rec.value != fmt.Sprint("v", rec.key) {
+			t.Errorf("key %d: value %q", rec.key, rec.value)
+		}
+	}
+	if want := []int{20, 30, 40, 50, 60}; !slices.Equal(got, want) {
+		t.Errorf("Range(15, 60) = %v, want %v", got, want)
+	}
+
+	if records, _ := tree.Range(91, 200); len(records) != 0 {
+		t.Errorf("Range past the end returned %d records", len(records))
+	}
+}
+
+func TestCursorSkipsTombstones(t *testing.T) {
+	tree := newTestTree(t, []int{1, 2, 3, 4, 5, 6, 7})
+	for _, k := range []int{1, 4, 5, 7} {
+		rec, _ := tree.Search(k)
+		rec.status = 1
+	}
+
+	var got []int
+	for k := range tree.All() {
+		got = append(got, k)
+	}
+	if want := []int{2, 3, 6}; !slices.Equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+
+	got = got[:0]
+	for k := range tree.Backward() {
+		got = append(got, k)
+	}
+	if want := []int{6, 3, 2}; !slices.Equal(got, want) {
+		t.Errorf("Backward() = %v, want %v", got, want)
+	}
+}
+
+func TestCursorNextPrevSeek(t *testing.T) {
+	var keys []int
+	for i := 0; i < 100; i += 2 {
+		keys = append(keys, i)
+	}
+	tree := newTestTree(t, keys)
+
+	c, err := tree.Scan(31)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Valid() || c.Key() != 32 {
+		t.Fatalf("Scan(31) at %d, want 32", c.Key())
+	}
+	c.Prev()
+	c.Prev()
+	if c.Key() != 28 {
+		t.Errorf("after two Prev: %d, want 28", c.Key())
+	}
+	c.Next()
+	if c.Key() != 30 || c.Value() != "v30" {
+		t.Errorf("after Next: %d %q", c.Key(), c.Value())
+	}
+
+	if c.Seek(99); c.Valid() {
+		t.Errorf("Seek past the end should be invalid, at %d", c.Key())
+	}
+	if c.SeekReverse(45); c.Key() != 44 {
+		t.Errorf("SeekReverse(45) at %d, want 44", c.Key())
+	}
+	if c.SeekReverse(44); c.Key() != 44 {
+		t.Errorf("SeekReverse(44) at %d, want 44", c.Key())
+	}
+	if c.SeekReverse(-1); c.Valid() {
+		t.Errorf("SeekReverse before the start should be invalid")
+	}
+	if !c.Last() || c.Key() != 98 {
+		t.Errorf("Last() at %d, want 98", c.Key())
+	}
+	if !c.First() || c.Key() != 0 {
+		t.Errorf("First() at %d, want 0", c.Key())
+	}
+}
+
+func TestCursorSurvivesModification(t *testing.T) {
+	tree := newTestTree(t, []int{10, 20, 30, 40, 50, 60, 70})
+	c, _ := tree.Scan(30)
+
+	// 删除当前记录并触发合并，游标仍应走到后继
+	for _, k := range []int{30, 40, 50} {
+		if _, err := tree.Delete(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !c.Next() || c.Key() != 60 {
+		t.Fatalf("Next after deletes at %d, want 60", c.Key())
+	}
+	if err := tree.Insert(55, "v55"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Prev() || c.Key() != 55 {
+		t.Fatalf("Prev after insert at %d, want 55", c.Key())
+	}
+}
+
+func TestCursorOnDisk(t *testing.T) {
+	tree, err := Open(filepath.Join(t.TempDir(), "tree.db"), WithOrder(4), WithPoolSize(8), WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	want := make(map[int]bool)
+	for i := 0; i < 3000; i++ {
+		k := rng.Intn(10000)
+		want[k] = true
+		if err := tree.Insert(k, fmt.Sprint(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sorted := make([]int, 0, len(want))
+	for k := range want {
+		sorted = append(sorted, k)
+	}
+	slices.Sort(sorted)
+
+	var got []int
+	for k := range tree.All() {
+		got = append(got, k)
+	}
+	if !slices.Equal(got, sorted) {
+		t.Fatalf("All() returned %d keys, want %d in order", len(got), len(sorted))
+	}
+
+	got = got[:0]
+	for k := range tree.Backward() {
+		got = append(got, k)
+	}
+	slices.Reverse(got)
+	if !slices.Equal(got, sorted) {
+		t.Fatalf("Backward() returned %d keys, want %d in reverse order", len(got), len(sorted))
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// applyRandomOps 随机插入/删除并与 map 对照，每步之后校验不变式
+func applyRandomOps(t *testing.T, tree *BPlusTree[int, string], rng *rand.Rand, n, keySpace int, want map[int]string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		key := rng.Intn(keySpace)
+		if rng.Intn(2) == 0 {
+			value := strings.Repeat("v", rng.Intn(8))
+			if err := tree.Insert(key, value); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = value
+		} else {
+			found, err := tree.Delete(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := want[key]; ok != found {
+				t.Fatalf("Delete(%d) = %v, want %v", key, found, ok)
+			}
+			delete(want, key)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after op %d on key %d: %v", i, key, err)
+		}
+	}
+	for k, v := range want {
+		rec, err := tree.Search(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec == nil || rec.value != v {
+			t.Fatalf("key %d: got %v, want %q", k, rec, v)
+		}
+	}
+}
+
+func TestDeleteRebalance(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 8} {
+		t.Run(fmt.Sprint("order", order), func(t *testing.T) {
+			tree := NewBPlusTree(order)
+			rng := rand.New(rand.NewSource(int64(order)))
+			applyRandomOps(t, tree, rng, 3000, 300, make(map[int]string))
+		})
+	}
+}
+
+func TestDeleteAllShrinksTree(t *testing.T) {
+	tree := NewBPlusTree(3)
+	for i := 0; i < 200; i++ {
+		if err := tree.Insert(i, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pages := tree.pool.pageCount
+	for i := 199; i >= 0; i -= 2 {
+		if _, err := tree.Delete(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 200; i += 2 {
+		if _, err := tree.Delete(i); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := tree.pool.FetchPage(tree.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.isLeaf || len(root.keys) != 0 {
+		t.Fatalf("empty tree should be a single empty leaf, got %+v", root)
+	}
+
+	// 释放的页会被重新使用
+	for i := 0; i < 200; i++ {
+		if err := tree.Insert(i, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tree.pool.pageCount != pages {
+		t.Errorf("page count grew from %d to %d after reinserting", pages, tree.pool.pageCount)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteVariableLengthValues(t *testing.T) {
+	tree := NewBPlusTree(64)
+	rng := rand.New(rand.NewSource(7))
+	want := make(map[int]string)
+	for i := 0; i < 2000; i++ {
+		key := rng.Intn(400)
+		if rng.Intn(3) > 0 {
+			value := strings.Repeat("x", rng.Intn(MAX_VALUE_SIZE))
+			if err := tree.Insert(key, value); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = value
+		} else {
+			if _, err := tree.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, key)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("op %d: %v", i, err)
+		}
+	}
+}
+
+func TestDeleteOnDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithOrder(4), WithPoolSize(8), WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]string)
+	applyRandomOps(t, tree, rand.New(rand.NewSource(3)), 2000, 500, want)
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = Open(path, WithPoolSize(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if got := checkTree(t, tree); len(got) != len(want) {
+		t.Fatalf("reopened tree has %d records, want %d", len(got), len(want))
+	}
+}
+
+func TestVacuum(t *testing.T) {
+	tree := NewBPlusTree(4)
+	for i := 0; i < 100; i++ {
+		if err := tree.Insert(i, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 旧版本的逻辑删除只打标记
+	for i := 0; i < 100; i += 3 {
+		rec, err := tree.Search(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec.status = 1
+	}
+
+	n, err := tree.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 34 {
+		t.Errorf("Vacuum() = %d, want 34", n)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		rec, err := tree.Search(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (rec == nil) != (i%3 == 0) {
+			t.Errorf("key %d: record %v after vacuum", i, rec)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Stats 树的统计信息
+type Stats struct {
+	Height         int     `json:"height"`          // 根到叶子的层数
+	Pages          int     `json:"pages"`           // 已分配的页数(不含元数据页)
+	InternalPages  int     `json:"internal_pages"`  // 树中的内部页数
+	LeafPages      int     `json:"leaf_pages"`      // 树中的叶子页数
+	FreePages      int     `json:"free_pages"`      // 空闲页链表中的页数
+	Records        int     `json:"records"`         // 叶子页中的记录数(含删除标记)
+	Tombstones     int     `json:"tombstones"`      // 删除标记数
+	AvgFill        float64 `json:"avg_fill"`        // 树中页的平均字节填充率
+	LeafFill       float64 `json:"leaf_fill"`       // 叶子页的平均字节填充率
+	Fragmentation  float64 `json:"fragmentation"`   // 叶子链表中下一页不是物理上紧邻的页的比例
+	TombstoneRatio float64 `json:"tombstone_ratio"` // 删除标记占记录的比例
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("height=%d pages=%d (internal=%d leaf=%d free=%d) records=%d tombstones=%d (%.1f%%) fill=%.1f%% (leaf %.1f%%) fragmentation=%.1f%%",
+		s.Height, s.Pages, s.InternalPages, s.LeafPages, s.FreePages, s.Records, s.Tombstones,
+		100*s.TombstoneRatio, 100*s.AvgFill, 100*s.LeafFill, 100*s.Fragmentation)
+}
+
+// PageInfo 导出的一页。键按 %v 格式化，不依赖键类型能否编码成JSON
+type PageInfo struct {
+	ID         int      `json:"id"`
+	Level      int      `json:"level"` // 根页为 0
+	Leaf       bool     `json:"leaf"`
+	Keys       []string `json:"keys"`
+	Children   []int    `json:"children,omitempty"`
+	Next       int      `json:"next,omitempty"`
+	Prev       int      `json:"prev,omitempty"`
+	Used       int      `json:"used"` // 序列化后占用的字节数
+	Tombstones int      `json:"tombstones,omitempty"`
+}
+
+// TreeDump 某一时刻整棵树的页图
+type TreeDump struct {
+	Root  int        `json:"root"`
+	Order int        `json:"order"`
+	Stats Stats      `json:"stats"`
+	Pages []PageInfo `json:"pages"` // 按层从上到下、层内从左到右
+}
+
+// Stats 返回树的统计信息，需要遍历整棵树
+func (t *BPlusTree[K, V]) Stats() (Stats, error) {
+	d, err := t.Dump()
+	if err != nil {
+		return Stats{}, err
+	}
+	return d.Stats, nil
+}
+
+// Dump 独占整棵树，逐层遍历导出页图和统计信息
+func (t *BPlusTree[K, V]) Dump() (*TreeDump, error) {
+	if err := t.failure(); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d := &TreeDump{Root: t.root, Order: t.order}
+	pageCount, freeList := t.pool.state()
+	s := &d.Stats
+	s.Pages = pageCount - 1
+	used, leafUsed := 0, 0
+	level := []int{t.root}
+	for len(level) > 0 {
+		var next []int
+		for _, id := range level {
+			p, err := t.pool.FetchPage(id)
+			if err != nil {
+				return nil, err
+			}
+			// 逐页解除固定，避免大树撑满缓冲池
+			t.pool.UnpinPage(p)
+			info := PageInfo{ID: p.id, Level: s.Height, Leaf: p.isLeaf, Used: p.usedSpace()}
+			for _, key := range p.keys {
+				info.Keys = append(info.Keys, fmt.Sprint(key))
+			}
+			used += info.Used
+			if p.isLeaf {
+				info.Next, info.Prev = p.next, p.prev
+				for _, rec := range p.records {
+					if rec.status == 1 {
+						info.Tombstones++
+					}
+				}
+				s.LeafPages++
+				s.Records += len(p.records)
+				s.Tombstones += info.Tombstones
+				leafUsed += info.Used
+				if p.next != META_PAGE_ID && p.next != p.id+1 {
+					s.Fragmentation++
+				}
+			} else {
+				info.Children = append([]int{}, p.children...)
+				s.InternalPages++
+				next = append(next, p.children...)
+			}
+			d.Pages = append(d.Pages, info)
+		}
+		level = next
+		s.Height++
+	}
+
+	for id := freeList; id != META_PAGE_ID && s.FreePages < pageCount; s.FreePages++ {
+		p, err := t.pool.FetchPage(id)
+		if err != nil {
+			return nil, err
+		}
+		t.pool.UnpinPage(p)
+		id = p.next
+	}
+
+	treePages := s.InternalPages + s.LeafPages
+	s.AvgFill = float64(used) / float64(treePages*PAGE_SIZE)
+	s.LeafFill = float64(leafUsed) / float64(s.LeafPages*PAGE_SIZE)
+	if s.LeafPages > 1 {
+		s.Fragmentation /= float64(s.LeafPages - 1)
+	}
+	if s.Records > 0 {
+		s.TombstoneRatio = float64(s.Tombstones) / float64(s.Records)
+	}
+	return d, nil
+}
+
+// WriteJSON 把页图和统计信息以JSON写入 w
+func (t *BPlusTree[K, V]) WriteJSON(w io.Writer) error {
+	d, err := t.Dump()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// WriteDOT 把页图以 Graphviz DOT 格式写入 w: 内部页的每个子页指针是一个端口，
+// 叶子链表画成虚线，含删除标记的叶子页标成灰色
+func (t *BPlusTree[K, V]) WriteDOT(w io.Writer) error {
+	d, err := t.Dump()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("digraph bplustree {\n")
+	b.WriteString("\tnode [shape=record, fontname=\"monospace\"];\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n", d.Stats.String())
+	var leaves []string
+	for _, p := range d.Pages {
+		var fields []string
+		if p.Leaf {
+			for _, key := range p.Keys {
+				fields = append(fields, escapeRecord(key))
+			}
+			style := ""
+			if p.Tombstones > 0 {
+				style = ", style=filled, fillcolor=lightgray"
+			}
+			fmt.Fprintf(&b, "\tp%d [label=\"{page %d|{%s}}\"%s];\n", p.ID, p.ID, strings.Join(fields, "|"), style)
+			leaves = append(leaves, fmt.Sprintf("p%d", p.ID))
+			continue
+		}
+		for i, key := range p.Keys {
+			fields = append(fields, fmt.Sprintf("<c%d>", i), escapeRecord(key))
+		}
+		fields = append(fields, fmt.Sprintf("<c%d>", len(p.Keys)))
+		fmt.Fprintf(&b, "\tp%d [label=\"{page %d|{%s}}\"];\n", p.ID, p.ID, strings.Join(fields, "|"))
+		for i, child := range p.Children {
+			fmt.Fprintf(&b, "\tp%d:c%d -> p%d;\n", p.ID, i, child)
+		}
+	}
+	for _, p := range d.Pages {
+		if p.Leaf && p.Next != META_PAGE_ID {
+			fmt.Fprintf(&b, "\tp%d -> p%d [style=dashed, constraint=false];\n", p.ID, p.Next)
+		}
+	}
+	if len(leaves) > 0 {
+		fmt.Fprintf(&b, "\t{rank=same; %s;}\n", strings.Join(leaves, "; "))
+	}
+	b.WriteString("}\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// escapeRecord 转义 record 形状标签中有特殊含义的字符
+func escapeRecord(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '{', '}', '|', '<', '>', '"', '\\':
+			b.WriteByte('\\')
+		case '\n':
+			b.WriteString(`\n`)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	tree := NewBPlusTree(4)
+	s, err := tree.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Height != 1 || s.Pages != 1 || s.LeafPages != 1 || s.Records != 0 {
+		t.Fatalf("empty tree: %+v", s)
+	}
+
+	// 阶数4、填满的叶子: 64条记录正好16页，上面一层4页，再上面是根
+	if _, err := tree.BulkLoad(seqRecords(64, func(int) int { return 0 }), 1); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = tree.Stats(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Height != 3 || s.LeafPages != 16 || s.InternalPages != 5 || s.Records != 64 || s.FreePages != 1 {
+		t.Fatalf("bulk loaded tree: %+v", s)
+	}
+	if s.Pages != s.LeafPages+s.InternalPages+s.FreePages {
+		t.Fatalf("pages %d != %d leaf + %d internal + %d free", s.Pages, s.LeafPages, s.InternalPages, s.FreePages)
+	}
+	if s.AvgFill <= 0 || s.AvgFill > 1 || s.LeafFill <= 0 || s.LeafFill > 1 {
+		t.Fatalf("fill out of range: %+v", s)
+	}
+
+	// 活跃快照还看得到旧版本时，事务删除留下删除标记
+	reader := tree.Begin()
+	tx := tree.Begin()
+	for i := 0; i < 16; i++ {
+		if _, err := tx.Delete(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = tree.Stats(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Tombstones != 16 || s.TombstoneRatio != 0.25 {
+		t.Fatalf("tombstones: %+v", s)
+	}
+	reader.Rollback()
+	if s, err = tree.Stats(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Tombstones != 0 || s.Records != 48 {
+		t.Fatalf("after GC: %+v", s)
+	}
+}
+
+// TestFragmentation 顺序插入时新叶子页紧跟在被分裂的页之后，碎片率远低于随机插入
+func TestFragmentation(t *testing.T) {
+	seq := NewBPlusTree(4)
+	for i := 0; i < 200; i++ {
+		if err := seq.Insert(i, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rnd := NewBPlusTree(4)
+	for i := 0; i < 200; i++ {
+		if err := rnd.Insert((i*73)%200, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := seq.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rnd.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Fragmentation >= b.Fragmentation {
+		t.Fatalf("sequential fragmentation %.2f >= random %.2f", a.Fragmentation, b.Fragmentation)
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	tree := newTestTree(t, []int{5, 1, 9, 3, 7, 2, 8})
+	var buf bytes.Buffer
+	if err := tree.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var d TreeDump
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Root != tree.root || d.Pages[0].ID != d.Root || d.Stats.Records != 7 {
+		t.Fatalf("dump: root %d, first page %d, %d records", d.Root, d.Pages[0].ID, d.Stats.Records)
+	}
+	// 叶子页从左到右连起来正好是全部键
+	var keys []string
+	for _, p := range d.Pages {
+		if p.Leaf {
+			if p.Level != d.Stats.Height-1 {
+				t.Errorf("leaf %d at level %d, want %d", p.ID, p.Level, d.Stats.Height-1)
+			}
+			keys = append(keys, p.Keys...)
+		}
+	}
+	if got := strings.Join(keys, ","); got != "1,2,3,5,7,8,9" {
+		t.Fatalf("leaf keys %s", got)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	tree := New(strings.Compare, StringCodec{}, StringCodec{}, 3)
+	for _, k := range []string{"a|b", "{c}", "d\"e", "f g", "<h>"} {
+		if err := tree.Insert(k, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tree.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	d, err := tree.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range d.Pages {
+		if !strings.Contains(dot, fmt.Sprintf("\tp%d [label=", p.ID)) {
+			t.Errorf("page %d has no node", p.ID)
+		}
+		for i, child := range p.Children {
+			if !strings.Contains(dot, fmt.Sprintf("p%d:c%d -> p%d;", p.ID, i, child)) {
+				t.Errorf("missing edge %d -> %d", p.ID, child)
+			}
+		}
+	}
+	for _, want := range []string{`a\|b`, `\{c\}`, `d\"e`, `\<h\>`, "style=dashed"} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output lacks %q:\n%s", want, dot)
+		}
+	}
+}
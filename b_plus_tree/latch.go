@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 并发控制(闩锁耦合):
+//
+// 每页有一把读写闩锁，操作自根向下逐层加闩锁，拿到子页的闩锁后再决定是否放开父页:
+//   - 读操作对途经的页加读闩锁，拿到子页后立即放开父页
+//   - 写操作先乐观地像读操作一样下降，只对叶子页加写闩锁。叶子页原地修改后既不分裂也不下溢时
+//     直接完成，否则放开全部闩锁，以悲观模式重做
+//   - 悲观写操作对途经的页加写闩锁，子页安全(其下的分裂、合并不会波及父页)时放开全部祖先。
+//     仍持有的路径就是分裂、合并时要找的父页，因此页中不记录父指针
+//   - 根页ID由 rootLatch 保护，悲观写操作在根页可能改变时一直持有它的写锁
+//
+// 闩锁总是自上而下获取，同一层的兄弟页只在持有父页写闩锁时获取。
+// 分裂、合并后要改 prev 指针的相邻叶子页可能不在路径上，推迟到操作最后再获取；
+// 游标沿叶子链表移动时只尝试获取相邻页，拿不到就放开当前页按键重新下降。因此闩锁之间不会成环。
+// 悲观写操作之间互相串行(smo)，修改过的页一直持有写闩锁，提交到日志之后才放开。
+//
+// 事务提交、检查点等涉及多个键或整个缓冲池的操作独占 mu，与单键操作互斥。
+
+// errRestart 乐观写操作发现叶子页需要分裂或合并，此时还没有修改任何页
+var errRestart = errors.New("b+tree: restart pessimistically")
+
+// latchMode 操作获取闩锁的方式
+type latchMode int
+
+const (
+	readMode        latchMode = iota // 逐层读闩锁
+	optimisticMode                   // 内部页读闩锁，叶子页写闩锁
+	pessimisticMode                  // 逐层写闩锁，子页安全时放开祖先
+	exclusiveMode                    // 已独占整棵树，逐层写闩锁并持有到操作结束
+)
+
+// latched 操作持有的一页
+type latched[K, V any] struct {
+	page  *Page[K, V]
+	write bool
+}
+
+// op 一次读写操作: 固定并加了闩锁的页在操作结束时统一放开
+type op[K, V any] struct {
+	t      *BPlusTree[K, V]
+	mode   latchMode
+	ts     int  // 提交时间戳，第一次修改记录时分配
+	root   int  // 下降时看到的根页ID
+	rootWL bool // 持有 rootLatch 的写锁
+	held   map[int]latched[K, V]
+	path   []*Page[K, V] // 从仍持有的最高祖先到当前页的路径
+	relink map[int]int   // 推迟修改的 prev 指针: 叶子页ID -> 新的上一页ID
+}
+
+func (t *BPlusTree[K, V]) newOp(mode latchMode) *op[K, V] {
+	return &op[K, V]{t: t, mode: mode, held: make(map[int]latched[K, V])}
+}
+
+// update 执行一次单键写操作并提交: 先乐观执行，fn 返回 errRestart 时以悲观模式重做
+func (t *BPlusTree[K, V]) update(fn func(o *op[K, V]) error) error {
+	if err := t.failure(); err != nil {
+		return err
+	}
+	t.mu.RLock()
+	err := t.apply(optimisticMode, fn)
+	if errors.Is(err, errRestart) {
+		t.smo.Lock()
+		err = t.apply(pessimisticMode, fn)
+		t.smo.Unlock()
+	}
+	t.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return t.maybeCheckpoint()
+}
+
+// exclusive 独占整棵树执行一次写操作并提交
+func (t *BPlusTree[K, V]) exclusive(fn func(o *op[K, V]) error) error {
+	if err := t.failure(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	err := t.apply(exclusiveMode, fn)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return t.maybeCheckpoint()
+}
+
+// apply 以指定模式执行 fn 并提交，修改过页之后失败则树不再可用
+func (t *BPlusTree[K, V]) apply(mode latchMode, fn func(o *op[K, V]) error) error {
+	o := t.newOp(mode)
+	defer o.releaseAll()
+
+	if err := fn(o); err != nil {
+		if o.modified() {
+			t.fail(fmt.Errorf("b+tree: write failed, reopen to recover: %w", err))
+		}
+		return err
+	}
+	if err := o.finish(); err != nil {
+		t.fail(fmt.Errorf("b+tree: write failed, reopen to recover: %w", err))
+		return err
+	}
+	if err := o.commit(); err != nil {
+		t.fail(fmt.Errorf("b+tree: commit failed, reopen to recover: %w", err))
+		return err
+	}
+	return nil
+}
+
+// failure 返回使树不再可用的错误
+func (t *BPlusTree[K, V]) failure() error {
+	t.errMu.Lock()
+	defer t.errMu.Unlock()
+	return t.err
+}
+
+func (t *BPlusTree[K, V]) fail(err error) {
+	t.errMu.Lock()
+	if t.err == nil {
+		t.err = err
+	}
+	t.errMu.Unlock()
+}
+
+// fetch 固定页并按操作模式加闩锁，已持有的页直接返回
+func (o *op[K, V]) fetch(id int) (*Page[K, V], error) {
+	if h, ok := o.held[id]; ok {
+		return h.page, nil
+	}
+	p, err := o.t.pool.FetchPage(id)
+	if err != nil {
+		return nil, err
+	}
+	// 乐观模式下页是经由持有读闩锁的父页找到的，不会在加闩锁前被释放，可以先看页类型
+	write := o.mode == pessimisticMode || o.mode == exclusiveMode || (o.mode == optimisticMode && p.isLeaf)
+	if write {
+		p.latch.Lock()
+	} else {
+		p.latch.RLock()
+	}
+	o.held[id] = latched[K, V]{page: p, write: write}
+	return p, nil
+}
+
+// newPage 分配新页，新页已加写闩锁
+func (o *op[K, V]) newPage(isLeaf bool) (*Page[K, V], error) {
+	p, err := o.t.pool.NewPage(isLeaf)
+	if err != nil {
+		return nil, err
+	}
+	o.held[p.id] = latched[K, V]{page: p, write: true}
+	return p, nil
+}
+
+// release 放开页的闩锁并解除固定
+func (o *op[K, V]) release(p *Page[K, V]) {
+	h, ok := o.held[p.id]
+	if !ok {
+		return
+	}
+	delete(o.held, p.id)
+	if h.write {
+		p.latch.Unlock()
+	} else {
+		p.latch.RUnlock()
+	}
+	o.t.pool.UnpinPage(p)
+}
+
+// releaseAll 放开操作持有的全部页和根闩锁
+func (o *op[K, V]) releaseAll() {
+	for _, h := range o.held {
+		o.release(h.page)
+	}
+	o.path = o.path[:0]
+	o.unlockRoot()
+}
+
+func (o *op[K, V]) unlockRoot() {
+	if o.rootWL {
+		o.rootWL = false
+		o.t.rootLatch.Unlock()
+	}
+}
+
+// modified 操作是否已经修改过页
+func (o *op[K, V]) modified() bool {
+	for _, h := range o.held {
+		if h.page.pending {
+			return true
+		}
+	}
+	return false
+}
+
+// descend 从根下降到叶子页，pick 给出内部页中要进入的子页位置
+func (o *op[K, V]) descend(pick func(p *Page[K, V]) int) (*Page[K, V], error) {
+	t := o.t
+	var p *Page[K, V]
+	var err error
+	switch o.mode {
+	case pessimisticMode:
+		if !o.rootWL {
+			t.rootLatch.Lock()
+			o.rootWL = true
+		}
+		o.root = t.root
+		p, err = o.fetch(o.root)
+	case exclusiveMode:
+		o.root = t.root
+		p, err = o.fetch(o.root)
+	default:
+		// 持有根闩锁直到根页加上闩锁，保证拿到的确实是根页
+		t.rootLatch.RLock()
+		o.root = t.root
+		p, err = o.fetch(o.root)
+		t.rootLatch.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.path = append(o.path[:0], p)
+	if o.mode == pessimisticMode && o.safe(p) {
+		o.unlockRoot()
+	}
+
+	for !p.isLeaf {
+		idx := pick(p)
+		if idx < 0 || idx >= len(p.children) {
+			return nil, fmt.Errorf("%w: page %d has no child %d", ErrCorruptPage, p.id, idx)
+		}
+		child, err := o.fetch(p.children[idx])
+		if err != nil {
+			return nil, err
+		}
+		o.path = append(o.path, child)
+		switch o.mode {
+		case readMode, optimisticMode:
+			o.release(p)
+			o.path = append(o.path[:0], child)
+		case pessimisticMode:
+			if o.safe(child) {
+				o.releaseAncestors()
+			}
+		}
+		p = child
+	}
+	return p, nil
+}
+
+// releaseAncestors 放开路径上当前页以上的页和根闩锁: 当前页之下的结构变化不会再波及它们
+func (o *op[K, V]) releaseAncestors() {
+	last := o.path[len(o.path)-1]
+	for _, p := range o.path[:len(o.path)-1] {
+		if !p.pending {
+			o.release(p)
+		}
+	}
+	o.path = append(o.path[:0], last)
+	o.unlockRoot()
+}
+
+// parent 返回路径上 p 的父页。悲观写操作只放开安全页以上的祖先，需要父页时它一定还在路径上
+func (o *op[K, V]) parent(p *Page[K, V]) (*Page[K, V], error) {
+	for i := len(o.path) - 1; i > 0; i-- {
+		if o.path[i] == p {
+			return o.path[i-1], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: parent of page %d is not latched", ErrCorruptPage, p.id)
+}
+
+func (o *op[K, V]) isRoot(p *Page[K, V]) bool {
+	return p.id == o.root
+}
+
+// setRoot 更换根页，调用方持有根闩锁的写锁或独占整棵树
+func (o *op[K, V]) setRoot(id int) {
+	o.t.root = id
+	o.root = id
+}
+
+// safe 判断悲观写操作在页下方引起的结构变化是否一定止于该页:
+// 再插入(或换上)一项不溢出，删去最大的一项不下溢，根页删去一项后仍有键
+func (o *op[K, V]) safe(p *Page[K, V]) bool {
+	t := o.t
+	used := p.usedSpace()
+	grow := KEY_LEN_SIZE + MAX_KEY_SIZE + POINTER_SIZE
+	if p.isLeaf {
+		grow = RECORD_HEADER + MAX_KEY_SIZE + MAX_VALUE_SIZE
+	}
+	if len(p.keys)+1 > t.order || used+grow > PAGE_SIZE {
+		return false
+	}
+	if o.isRoot(p) {
+		return p.isLeaf || len(p.keys) > 1
+	}
+	largest := 0
+	for i, key := range p.keys {
+		if p.isLeaf {
+			largest = max(largest, p.recordSize(p.records[i]))
+		} else {
+			largest = max(largest, p.entrySize(key))
+		}
+	}
+	return len(p.keys)-1 >= t.minKeys(p.isLeaf) ||
+		used-PAGE_HEADER_SIZE-largest >= (PAGE_SIZE-PAGE_HEADER_SIZE)/4
+}
+
+// fits 乐观写操作在叶子页上原地修改后(键数 keys、占用 used 字节)是否既不溢出也不下溢，
+// 不满足时要以悲观模式重做。其他模式不受限制
+func (o *op[K, V]) fits(leaf *Page[K, V], keys, used int) bool {
+	if o.mode != optimisticMode {
+		return true
+	}
+	if keys > o.t.order || used > PAGE_SIZE {
+		return false
+	}
+	return o.isRoot(leaf) || keys >= o.t.minKeys(true) ||
+		used-PAGE_HEADER_SIZE >= (PAGE_SIZE-PAGE_HEADER_SIZE)/4
+}
+
+// stamp 本次操作的提交时间戳，第一次修改记录时在叶子页的写闩锁下分配，
+// 因此同一个键上的时间戳与修改顺序一致
+func (o *op[K, V]) stamp() int {
+	if o.ts == 0 {
+		o.ts = o.t.txns.tick()
+	}
+	return o.ts
+}
+
+// relinkLater 推迟修改叶子页的 prev 指针
+func (o *op[K, V]) relinkLater(id, prev int) {
+	if o.relink == nil {
+		o.relink = make(map[int]int)
+	}
+	o.relink[id] = prev
+}
+
+// finish 修改推迟的 prev 指针。此时操作不会再获取其他闩锁，等待相邻页不会成环
+func (o *op[K, V]) finish() error {
+	for id, prev := range o.relink {
+		p, err := o.fetch(id)
+		if err != nil {
+			return err
+		}
+		if p.isFree {
+			continue
+		}
+		p.prev = prev
+		p.markDirty()
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentInsertSearch 多个goroutine交错插入互不相同的键，同时查找自己插入过的键
+func TestConcurrentInsertSearch(t *testing.T) {
+	tree := NewBPlusTree(4)
+	const workers, perWorker = 8, 2000
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for g := 0; g < workers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < perWorker; i++ {
+				key := i*workers + g
+				if err := tree.Insert(key, fmt.Sprint("v", key)); err != nil {
+					errs <- err
+					return
+				}
+				probe := rng.Intn(i+1)*workers + g
+				rec, err := tree.Search(probe)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if rec == nil || rec.value != fmt.Sprint("v", probe) {
+					errs <- fmt.Errorf("key %d: got %v after inserting it", probe, rec)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range tree.All() {
+		n++
+	}
+	if n != workers*perWorker {
+		t.Errorf("tree has %d records, want %d", n, workers*perWorker)
+	}
+}
+
+// TestConcurrentMixed 每个goroutine在自己的键区间内随机增删改查，同时有游标反复全表扫描。
+// 结束后与各自的模型比对，并在重新打开后再比对一次
+func TestConcurrentMixed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithOrder(3), WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const workers, keysPerWorker, ops = 6, 300, 3000
+	models := make([]map[int]string, workers)
+	var wg sync.WaitGroup
+	errs := make(chan error, workers+2)
+	stop := make(chan struct{})
+
+	for g := 0; g < workers; g++ {
+		models[g] = make(map[int]string)
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			model := models[g]
+			for i := 0; i < ops; i++ {
+				key := g*keysPerWorker + rng.Intn(keysPerWorker)
+				switch rng.Intn(4) {
+				case 0:
+					found, err := tree.Delete(key)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if _, ok := model[key]; ok != found {
+						errs <- fmt.Errorf("delete %d: found = %v, want %v", key, found, ok)
+						return
+					}
+					delete(model, key)
+				case 1:
+					rec, err := tree.Search(key)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if v, ok := model[key]; (rec != nil) != ok || (ok && rec.value != v) {
+						errs <- fmt.Errorf("search %d: got %v, want %q", key, rec, v)
+						return
+					}
+				default:
+					// 值长度不一，叶子页按字节分裂、合并
+					value := fmt.Sprintf("g%d-%d-%s", g, i, make([]byte, rng.Intn(40)))
+					if err := tree.Insert(key, value); err != nil {
+						errs <- err
+						return
+					}
+					model[key] = value
+				}
+			}
+		}(g)
+	}
+
+	var scanners sync.WaitGroup
+	for _, reverse := range []bool{false, true} {
+		scanners.Add(1)
+		go func(reverse bool) {
+			defer scanners.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c := tree.NewCursor()
+				prev, first := 0, true
+				move := c.Next
+				if reverse {
+					c.Last()
+					move = c.Prev
+				} else {
+					c.First()
+				}
+				for ; c.Valid(); move() {
+					if !first && (reverse && c.Key() >= prev || !reverse && c.Key() <= prev) {
+						errs <- fmt.Errorf("scan (reverse=%v) went from %d to %d", reverse, prev, c.Key())
+						return
+					}
+					prev, first = c.Key(), false
+				}
+				if err := c.Err(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(reverse)
+	}
+
+	wg.Wait()
+	close(stop)
+	scanners.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	want := make(map[int]string)
+	for _, model := range models {
+		for k, v := range model {
+			want[k] = v
+		}
+	}
+	check := func(tree *BPlusTree[int, string]) {
+		t.Helper()
+		got := checkTree(t, tree)
+		if len(got) != len(want) {
+			t.Fatalf("got %d records, want %d", len(got), len(want))
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Fatalf("key %d: got %q, want %q", k, got[k], v)
+			}
+		}
+	}
+	check(tree)
+	crash(tree)
+
+	tree, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	check(tree)
+}
+
+// TestConcurrentTransfers 并发事务在账户间转账，总额不变；只读事务在任意时刻看到的总额也不变
+func TestConcurrentTransfers(t *testing.T) {
+	tree := NewBPlusTree(4)
+	const accounts, initial = 20, 100
+	for i := 0; i < accounts; i++ {
+		if err := tree.Insert(i, fmt.Sprint(initial)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	balance := func(tx *Txn[int, string], key int) (int, error) {
+		v, _, err := tx.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		var n int
+		_, err = fmt.Sscan(v, &n)
+		return n, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for done := 0; done < 200; {
+				from, to := rng.Intn(accounts), rng.Intn(accounts)
+				if from == to {
+					continue
+				}
+				tx := tree.Begin()
+				a, err := balance(tx, from)
+				if err == nil {
+					var b int
+					if b, err = balance(tx, to); err == nil {
+						if err = tx.Put(from, fmt.Sprint(a-1)); err == nil {
+							err = tx.Put(to, fmt.Sprint(b+1))
+						}
+					}
+				}
+				if err == nil {
+					err = tx.Commit()
+				} else {
+					tx.Rollback()
+				}
+				if errors.Is(err, ErrWriteConflict) {
+					continue
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				done++
+			}
+		}(g)
+	}
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				tx := tree.Begin()
+				sum := 0
+				for k := 0; k < accounts; k++ {
+					n, err := balance(tx, k)
+					if err != nil {
+						errs <- err
+						return
+					}
+					sum += n
+				}
+				tx.Rollback()
+				if sum != accounts*initial {
+					errs <- fmt.Errorf("snapshot %d sees total %d, want %d", tx.snapshot, sum, accounts*initial)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// globalLocked 对照组: 用一把全局读写锁串行化所有写操作
+type globalLocked struct {
+	mu   sync.RWMutex
+	tree *BPlusTree[int, string]
+}
+
+func (g *globalLocked) Search(key int) (*Record[int, string], error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.tree.Search(key)
+}
+
+func (g *globalLocked) Insert(key int, value string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.tree.Insert(key, value)
+}
+
+// BenchmarkConcurrent 比较闩锁耦合与全局读写锁在不同读写比例下的并发吞吐
+func BenchmarkConcurrent(b *testing.B) {
+	const keys = 100000
+	type store interface {
+		Search(key int) (*Record[int, string], error)
+		Insert(key int, value string) error
+	}
+	for _, writePct := range []int{5, 50} {
+		for _, kind := range []string{"latch", "global"} {
+			b.Run(fmt.Sprintf("%s/writes=%d%%", kind, writePct), func(b *testing.B) {
+				tree := NewBPlusTree(64)
+				for i := 0; i < keys; i += 2 {
+					tree.Insert(i, "v")
+				}
+				var s store = tree
+				if kind == "global" {
+					s = &globalLocked{tree: tree}
+				}
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rng := rand.New(rand.NewSource(rand.Int63()))
+					for pb.Next() {
+						key := rng.Intn(keys)
+						if rng.Intn(100) < writePct {
+							if err := s.Insert(key, "w"); err != nil {
+								b.Error(err)
+								return
+							}
+						} else if _, err := s.Search(key); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -1,563 +1,943 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
-	"strings"
+	"sync"
 )
 
 const (
 	DEFAULT_ORDER = 4    // 默认阶数
 	PAGE_SIZE     = 4096 // 页大小(字节)
-	KEY_SIZE      = 8    // 键大小(字节)
-	POINTER_SIZE  = 8    // 指针大小(字节)
+	POINTER_SIZE  = 4    // 页ID大小(字节)
 )
 
-// BPlusTree MySQL风格的B+树
-type BPlusTree struct {
-	root      *Page
-	order     int
-	pageCount int
+// BPlusTree MySQL风格的B+树，键按 cmp 排序，键值经 Codec 编码后存入页。
+// 可以在多个goroutine中并发使用，并发控制见 latch.go
+type BPlusTree[K, V any] struct {
+	root    int // 根页ID，由 rootLatch 保护
+	order   int
+	codec   *codecs[K, V]
+	pool    *BufferPool[K, V]
+	file    *PageFile // 为 nil 时是纯内存树
+	wal     *WAL
+	logBuf  []byte            // 写日志时序列化页用的缓冲区，由 wal.mu 保护
+	durable fileMeta          // 最后一次提交到日志的元数据，由 wal.mu 保护
+	txns    *txnManager[K, V] // 多版本并发控制的事务状态
+
+	mu        sync.RWMutex // 单键操作共享持有，事务提交、检查点等独占持有
+	smo       sync.Mutex   // 可能改变树结构的悲观写操作互相串行
+	rootLatch sync.RWMutex // 根页之上的闩锁
+	errMu     sync.Mutex
+	err       error // 写操作中途失败后树不再可用，需要重新打开以从日志恢复
 }
 
 // Page 表示B+树的页(节点)
-type Page struct {
+type Page[K, V any] struct {
 	id        int
 	isLeaf    bool
-	keys      []int
-	pointers  []interface{} // 对于叶子节点存储值，内部节点存储子页指针
-	next      *Page         // 叶子节点的链表指针
-	parent    *Page
+	isFree    bool // 已释放，位于空闲页链表中
+	keys      []K
+	records   []*Record[K, V] // 叶子页: 与 keys 一一对应的记录
+	children  []int           // 内部页: 子页ID，比 keys 多一个
+	next      int             // 叶子节点的链表指针(下一页ID)
+	prev      int             // 叶子节点的链表指针(上一页ID)
 	freeSpace int
+	codec     *codecs[K, V]
+	latch     sync.RWMutex // 保护以上字段
+
+	lsn      uint64 // 最后一次修改对应的日志LSN
+	pinCount int    // 缓冲池固定计数
+	dirty    bool   // 修改后尚未写回文件
+	pending  bool   // 本次操作修改过，提交时需写入日志
+	ref      bool   // 时钟置换的访问位
 }
 
-// Record 表示数据库记录
-type Record struct {
-	key    int
-	value  string
+// Record 表示数据库记录。记录放进页后不再修改，更新时整条替换，
+// 因此读操作放开闩锁后仍可以使用拿到的记录
+type Record[K, V any] struct {
+	key    K
+	value  V
 	status byte // 用于事务: 0=正常, 1=已删除
-	txID   int  // 事务ID
+	txID   int  // 写入该版本的事务的提交时间戳
 }
 
-// NewBPlusTree 创建新的B+树
-func NewBPlusTree(order int) *BPlusTree {
+type options struct {
+	order    int
+	poolSize int
+	sync     bool
+}
+
+// Option 配置 Open 打开的树
+type Option func(o *options)
+
+// WithOrder 设置新建数据文件时的阶数，已有文件使用文件中记录的阶数
+func WithOrder(order int) Option {
+	return func(o *options) {
+		o.order = order
+	}
+}
+
+// WithPoolSize 设置缓冲池页数
+func WithPoolSize(n int) Option {
+	return func(o *options) {
+		o.poolSize = n
+	}
+}
+
+// WithSync 设置每次提交是否 fsync 日志，关闭后进程崩溃不丢数据但掉电可能丢失最近的提交
+func WithSync(sync bool) Option {
+	return func(o *options) {
+		o.sync = sync
+	}
+}
+
+// NewBPlusTree 创建以 int 为键、string 为值的纯内存B+树
+func NewBPlusTree(order int) *BPlusTree[int, string] {
+	return New(cmp.Compare[int], IntCodec{}, StringCodec{}, order)
+}
+
+// New 创建纯内存B+树，键按 compare 排序
+func New[K, V any](compare func(a, b K) int, keys Codec[K], values Codec[V], order int) *BPlusTree[K, V] {
+	c := &codecs[K, V]{cmp: compare, key: keys, value: values}
+	t := &BPlusTree[K, V]{
+		order: normalizeOrder(order),
+		codec: c,
+		pool:  NewBufferPool(c, nil, 0, 1),
+		txns:  newTxnManager[K, V](0),
+	}
+	// 内存模式下分配页不会失败
+	t.exclusive(func(o *op[K, V]) error {
+		root, err := o.newPage(true)
+		if err != nil {
+			return err
+		}
+		o.setRoot(root.id)
+		return nil
+	})
+	return t
+}
+
+// Open 打开(不存在则创建)以 int 为键、string 为值的B+树
+func Open(path string, opts ...Option) (*BPlusTree[int, string], error) {
+	return OpenTree(path, cmp.Compare[int], IntCodec{}, StringCodec{}, opts...)
+}
+
+// OpenTree 打开(不存在则创建)以 path 为数据文件的B+树，重做日志保存在 path+".wal"，
+// 打开时会先重放日志中已提交的操作。数据文件不记录键值类型，需用建树时的比较函数和编码打开
+func OpenTree[K, V any](path string, compare func(a, b K) int, keys Codec[K], values Codec[V], opts ...Option) (*BPlusTree[K, V], error) {
+	o := options{order: DEFAULT_ORDER, poolSize: DEFAULT_POOL_SIZE, sync: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	file, err := openPageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := openWAL(path+".wal", o.sync)
+	if err != nil {
+		file.close()
+		return nil, err
+	}
+	c := &codecs[K, V]{cmp: compare, key: keys, value: values}
+	t, err := openTree(c, file, wal, o)
+	if err != nil {
+		wal.close()
+		file.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func openTree[K, V any](c *codecs[K, V], file *PageFile, wal *WAL, o options) (*BPlusTree[K, V], error) {
+	if err := recoverFromWAL(file, wal); err != nil {
+		return nil, err
+	}
+	meta, err := file.readMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &BPlusTree[K, V]{codec: c, file: file, wal: wal, logBuf: make([]byte, PAGE_SIZE)}
+	if meta != nil {
+		wal.nextLSN = max(wal.nextLSN, meta.lsn+1)
+		t.order = meta.order
+		t.root = meta.root
+		t.pool = NewBufferPool(c, file, minPoolSize(o.poolSize, t.order), meta.pageCount)
+		t.pool.freeList = meta.freeList
+		t.pool.wal = wal
+		t.txns = newTxnManager[K, V](meta.clock)
+		t.durable = *meta
+		return t, nil
+	}
+
+	t.order = normalizeOrder(o.order)
+	t.pool = NewBufferPool(c, file, minPoolSize(o.poolSize, t.order), 1)
+	t.pool.wal = wal
+	t.txns = newTxnManager[K, V](0)
+	err = t.exclusive(func(o *op[K, V]) error {
+		root, err := o.newPage(true)
+		if err != nil {
+			return err
+		}
+		o.setRoot(root.id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, t.Checkpoint()
+}
+
+// normalizeOrder 把阶数限制在一页能容纳的范围内
+func normalizeOrder(order int) int {
 	if order < 3 {
 		order = DEFAULT_ORDER
 	}
-	return &BPlusTree{
-		order: order,
-		root:  createNewPage(true),
-	}
+	return min(order, maxOrder())
+}
+
+// minPoolSize 缓冲池至少要容纳一次写操作修改的全部页(每层最多涉及本页、兄弟页和新页)，
+// 并为同时进行的其他操作留出余量
+func minPoolSize(poolSize, order int) int {
+	return max(poolSize, 8*(order/2+3))
 }
 
-// createNewPage 创建新页
-func createNewPage(isLeaf bool) *Page {
-	return &Page{
-		id:        generatePageID(),
-		isLeaf:    isLeaf,
-		keys:      make([]int, 0),
-		pointers:  make([]interface{}, 0),
-		freeSpace: PAGE_SIZE - 16, // 减去页头开销
+// Close 做检查点并关闭数据文件和日志
+func (t *BPlusTree[K, V]) Close() error {
+	if t.file == nil {
+		return nil
 	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var err error
+	if t.failure() == nil {
+		err = t.checkpoint()
+	}
+	if cerr := t.wal.close(); err == nil {
+		err = cerr
+	}
+	if cerr := t.file.close(); err == nil {
+		err = cerr
+	}
+	t.file = nil
+	t.wal = nil
+	return err
 }
 
-var pageIDCounter = 0
+// checkSize 检查键值编码后的长度
+func (t *BPlusTree[K, V]) checkSize(key K, value V) error {
+	if t.codec.key.Size(key) > MAX_KEY_SIZE {
+		return ErrKeyTooLarge
+	}
+	if t.codec.value.Size(value) > MAX_VALUE_SIZE {
+		return ErrValueTooLarge
+	}
+	return nil
+}
 
-func generatePageID() int {
-	pageIDCounter++
-	return pageIDCounter
+// Insert 插入键值对，立即提交
+func (t *BPlusTree[K, V]) Insert(key K, value V) error {
+	if err := t.checkSize(key, value); err != nil {
+		return err
+	}
+	if t.txns.locked(t.codec.encodeKey(key)) {
+		return ErrWriteConflict
+	}
+	return t.update(func(o *op[K, V]) error {
+		return o.insert(key, value)
+	})
 }
 
-// Insert 插入键值对
-func (t *BPlusTree) Insert(key int, value string) {
+// insert 写入键值对，由调用方负责提交
+func (o *op[K, V]) insert(key K, value V) error {
+	t := o.t
 	// 查找合适的叶子页
-	leaf := t.findLeafPage(key)
+	leaf, err := o.findLeafPage(key)
+	if err != nil {
+		return err
+	}
+	record := &Record[K, V]{key: key, value: value}
 
 	// 检查键是否已存在
-	for i, k := range leaf.keys {
-		if k == key {
-			// 更新现有记录
-			if rec, ok := leaf.pointers[i].(*Record); ok {
-				rec.value = value
-			}
-			return
+	if i := t.indexOf(leaf, key); i != -1 {
+		// 更新现有记录
+		old := leaf.records[i]
+		if !o.fits(leaf, len(leaf.keys), leaf.usedSpace()-leaf.recordSize(old)+leaf.recordSize(record)) {
+			return errRestart
+		}
+		record.txID = o.stamp()
+		t.txns.preserve(t.codec, old, record.txID)
+		t.txns.unbury(t.codec.encodeKey(key))
+		leaf.records[i] = record
+		leaf.updateFreeSpace()
+		// 新值更长时可能需要分裂，更短时可能下溢
+		if t.overflow(leaf) {
+			return o.splitLeafPage(leaf)
 		}
+		return o.rebalance(leaf)
 	}
 
 	// 插入新记录
-	record := &Record{key: key, value: value}
-	t.insertIntoLeaf(leaf, key, record)
+	if !o.fits(leaf, len(leaf.keys)+1, leaf.usedSpace()+leaf.recordSize(record)) {
+		return errRestart
+	}
+	record.txID = o.stamp()
+	return o.insertIntoLeaf(leaf, key, record)
 }
 
 // findLeafPage 查找包含key的叶子页
-func (t *BPlusTree) findLeafPage(key int) *Page {
-	current := t.root
-	for !current.isLeaf {
+func (o *op[K, V]) findLeafPage(key K) (*Page[K, V], error) {
+	return o.descend(func(p *Page[K, V]) int {
 		// 二分查找合适的子页
-		idx := 0
-		for idx < len(current.keys) && key >= current.keys[idx] {
-			idx++
-		}
-		if child, ok := current.pointers[idx].(*Page); ok {
-			current = child
-		}
+		return o.t.childIndex(p, key)
+	})
+}
+
+// childIndex 内部页中 key 所在子页的位置
+func (t *BPlusTree[K, V]) childIndex(p *Page[K, V], key K) int {
+	idx := 0
+	for idx < len(p.keys) && t.codec.cmp(key, p.keys[idx]) >= 0 {
+		idx++
 	}
-	return current
+	return idx
 }
 
-// insertIntoLeaf 向叶子页插入记录
-func (t *BPlusTree) insertIntoLeaf(leaf *Page, key int, record *Record) {
-	// 找到插入位置
+// searchIndex 页内第一个不小于 key 的位置
+func (t *BPlusTree[K, V]) searchIndex(p *Page[K, V], key K) int {
 	idx := 0
-	for idx < len(leaf.keys) && key > leaf.keys[idx] {
+	for idx < len(p.keys) && t.codec.cmp(p.keys[idx], key) < 0 {
 		idx++
 	}
+	return idx
+}
+
+// indexOf 返回键在页内的位置，不存在时返回 -1
+func (t *BPlusTree[K, V]) indexOf(p *Page[K, V], key K) int {
+	if i := t.searchIndex(p, key); i < len(p.keys) && t.codec.cmp(p.keys[i], key) == 0 {
+		return i
+	}
+	return -1
+}
+
+// overflow 判断页是否超过阶数或放不进一页
+func (t *BPlusTree[K, V]) overflow(p *Page[K, V]) bool {
+	return len(p.keys) > t.order || p.usedSpace() > PAGE_SIZE
+}
+
+// insertIntoLeaf 向叶子页插入记录
+func (o *op[K, V]) insertIntoLeaf(leaf *Page[K, V], key K, record *Record[K, V]) error {
+	t := o.t
+	// 找到插入位置
+	idx := t.searchIndex(leaf, key)
 
 	// 插入键和记录
-	leaf.keys = append(leaf.keys[:idx], append([]int{key}, leaf.keys[idx:]...)...)
-	leaf.pointers = append(leaf.pointers[:idx], append([]interface{}{record}, leaf.pointers[idx:]...)...)
+	leaf.keys = append(leaf.keys[:idx], append([]K{key}, leaf.keys[idx:]...)...)
+	leaf.records = append(leaf.records[:idx], append([]*Record[K, V]{record}, leaf.records[idx:]...)...)
 
 	// 更新空闲空间
-	leaf.freeSpace -= (KEY_SIZE + POINTER_SIZE)
+	leaf.updateFreeSpace()
 
-	// 检查是否需要分裂
-	if len(leaf.keys) > t.order {
-		t.splitLeafPage(leaf)
+	// 键数超过阶数或页放不下时分裂
+	if t.overflow(leaf) {
+		return o.splitLeafPage(leaf)
 	}
+	return nil
+}
+
+// splitIndex 计算分裂点: 键数超限时按键数对半，页满时取两半字节数最接近的位置。
+// 内部页的分裂点上的键会上移到父页，因此分裂点左右至少各留一个键
+func (t *BPlusTree[K, V]) splitIndex(p *Page[K, V]) int {
+	if len(p.keys) > t.order {
+		return len(p.keys) / 2
+	}
+	sizes := make([]int, len(p.keys))
+	total := 0
+	for i := range p.keys {
+		if p.isLeaf {
+			sizes[i] = p.recordSize(p.records[i])
+		} else {
+			sizes[i] = p.entrySize(p.keys[i])
+		}
+		total += sizes[i]
+	}
+	if p.isLeaf {
+		best, bestDiff := 1, total
+		left := 0
+		for i := 1; i < len(sizes); i++ {
+			left += sizes[i-1]
+			if diff := abs(total - 2*left); diff < bestDiff {
+				best, bestDiff = i, diff
+			}
+		}
+		return best
+	}
+	best, bestDiff := 1, total
+	left := sizes[0]
+	for i := 1; i < len(sizes)-1; i++ {
+		if diff := abs(total - sizes[i] - 2*left); diff < bestDiff {
+			best, bestDiff = i, diff
+		}
+		left += sizes[i]
+	}
+	return best
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
 }
 
 // splitLeafPage 分裂叶子页
-func (t *BPlusTree) splitLeafPage(leaf *Page) {
+func (o *op[K, V]) splitLeafPage(leaf *Page[K, V]) error {
 	// 创建新页
-	newPage := createNewPage(true)
+	newPage, err := o.newPage(true)
+	if err != nil {
+		return err
+	}
 
 	// 计算分裂点
-	splitIdx := len(leaf.keys) / 2
+	splitIdx := o.t.splitIndex(leaf)
 
 	// 移动一半键和记录到新页
 	newPage.keys = append(newPage.keys, leaf.keys[splitIdx:]...)
-	newPage.pointers = append(newPage.pointers, leaf.pointers[splitIdx:]...)
+	newPage.records = append(newPage.records, leaf.records[splitIdx:]...)
+	testHookCrash("splitLeafPage:copied")
 
 	// 更新原页
 	leaf.keys = leaf.keys[:splitIdx]
-	leaf.pointers = leaf.pointers[:splitIdx]
+	leaf.records = leaf.records[:splitIdx]
 
-	// 更新链表指针
+	// 更新链表指针，下一页不在路径上，推迟到操作最后修改
+	if leaf.next != META_PAGE_ID {
+		o.relinkLater(leaf.next, newPage.id)
+	}
 	newPage.next = leaf.next
-	leaf.next = newPage
-	newPage.parent = leaf.parent
+	newPage.prev = leaf.id
+	leaf.next = newPage.id
 
 	// 更新空闲空间
-	leaf.freeSpace = PAGE_SIZE - 16 - (len(leaf.keys)*KEY_SIZE + len(leaf.pointers)*POINTER_SIZE)
-	newPage.freeSpace = PAGE_SIZE - 16 - (len(newPage.keys)*KEY_SIZE + len(newPage.pointers)*POINTER_SIZE)
+	leaf.updateFreeSpace()
+	newPage.updateFreeSpace()
+	testHookCrash("splitLeafPage:linked")
 
 	// 插入分隔键到父页
-	t.insertIntoParent(leaf, newPage.keys[0], newPage)
+	return o.insertIntoParent(leaf, newPage.keys[0], newPage)
 }
 
 // insertIntoParent 更新父页
-func (t *BPlusTree) insertIntoParent(left *Page, key int, right *Page) {
-	parent := left.parent
-
+func (o *op[K, V]) insertIntoParent(left *Page[K, V], key K, right *Page[K, V]) error {
 	// 如果是根页分裂
-	if parent == nil {
-		newRoot := createNewPage(false)
+	if o.isRoot(left) {
+		newRoot, err := o.newPage(false)
+		if err != nil {
+			return err
+		}
 		newRoot.keys = append(newRoot.keys, key)
-		newRoot.pointers = append(newRoot.pointers, left, right)
-		left.parent = newRoot
-		right.parent = newRoot
-		t.root = newRoot
-		return
+		newRoot.children = append(newRoot.children, left.id, right.id)
+		newRoot.updateFreeSpace()
+		o.setRoot(newRoot.id)
+		return nil
 	}
 
-	// 找到插入位置
-	idx := 0
-	for idx < len(parent.keys) && key > parent.keys[idx] {
-		idx++
+	parent, err := o.parent(left)
+	if err != nil {
+		return err
 	}
 
+	// 找到插入位置
+	idx := o.t.searchIndex(parent, key)
+
 	// 插入键和指针
-	parent.keys = append(parent.keys[:idx], append([]int{key}, parent.keys[idx:]...)...)
-	parent.pointers = append(parent.pointers[:idx+1], append([]interface{}{right}, parent.pointers[idx+1:]...)...)
+	parent.keys = append(parent.keys[:idx], append([]K{key}, parent.keys[idx:]...)...)
+	parent.children = append(parent.children[:idx+1], append([]int{right.id}, parent.children[idx+1:]...)...)
 
 	// 更新空闲空间
-	parent.freeSpace -= (KEY_SIZE + POINTER_SIZE)
+	parent.updateFreeSpace()
 
 	// 检查是否需要分裂
-	if len(parent.keys) > t.order {
-		t.splitInternalPage(parent)
+	if o.t.overflow(parent) {
+		return o.splitInternalPage(parent)
 	}
+	return nil
 }
 
 // splitInternalPage 分裂内部页
-func (t *BPlusTree) splitInternalPage(page *Page) {
+func (o *op[K, V]) splitInternalPage(page *Page[K, V]) error {
 	// 创建新页
-	newPage := createNewPage(false)
+	newPage, err := o.newPage(false)
+	if err != nil {
+		return err
+	}
 
 	// 计算分裂点
-	splitIdx := len(page.keys) / 2
+	splitIdx := o.t.splitIndex(page)
 	promoteKey := page.keys[splitIdx]
 
 	// 移动一半键和指针到新页
 	newPage.keys = append(newPage.keys, page.keys[splitIdx+1:]...)
-	newPage.pointers = append(newPage.pointers, page.pointers[splitIdx+1:]...)
+	newPage.children = append(newPage.children, page.children[splitIdx+1:]...)
 
 	// 更新原页
 	page.keys = page.keys[:splitIdx]
-	page.pointers = page.pointers[:splitIdx+1]
-
-	// 更新子页的父指针
-	for _, p := range newPage.pointers {
-		if child, ok := p.(*Page); ok {
-			child.parent = newPage
-		}
-	}
-
-	newPage.parent = page.parent
+	page.children = page.children[:splitIdx+1]
+	testHookCrash("splitInternalPage:moved")
 
 	// 更新空闲空间
-	page.freeSpace = PAGE_SIZE - 16 - (len(page.keys)*KEY_SIZE + len(page.pointers)*POINTER_SIZE)
-	newPage.freeSpace = PAGE_SIZE - 16 - (len(newPage.keys)*KEY_SIZE + len(newPage.pointers)*POINTER_SIZE)
+	page.updateFreeSpace()
+	newPage.updateFreeSpace()
+	testHookCrash("splitInternalPage:promote")
 
 	// 插入分隔键到父页
-	t.insertIntoParent(page, promoteKey, newPage)
+	return o.insertIntoParent(page, promoteKey, newPage)
 }
 
 // Search 搜索记录
-func (t *BPlusTree) Search(key int) *Record {
-	leaf := t.findLeafPage(key)
-	for i, k := range leaf.keys {
-		if k == key {
-			if rec, ok := leaf.pointers[i].(*Record); ok {
-				return rec
-			}
-		}
+func (t *BPlusTree[K, V]) Search(key K) (*Record[K, V], error) {
+	if err := t.failure(); err != nil {
+		return nil, err
 	}
-	return nil
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	o := t.newOp(readMode)
+	defer o.releaseAll()
+	return o.search(key)
 }
 
-// Print 打印B+树结构
-func (t *BPlusTree) Print() {
-	if t.root == nil {
-		fmt.Println("B+树为空")
-		return
+func (o *op[K, V]) search(key K) (*Record[K, V], error) {
+	leaf, err := o.findLeafPage(key)
+	if err != nil {
+		return nil, err
+	}
+	if i := o.t.indexOf(leaf, key); i != -1 {
+		return leaf.records[i], nil
+	}
+	return nil, nil
+}
+
+// Print 把B+树结构逐层打印到 w
+func (t *BPlusTree[K, V]) Print(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	root, err := t.pool.FetchPage(t.root)
+	if err != nil {
+		return err
 	}
+	t.pool.UnpinPage(root)
 
-	queue := []*Page{t.root}
+	queue := []*Page[K, V]{root}
 	level := 0
 
 	for len(queue) > 0 {
-		fmt.Printf("Level %d:\n", level)
-		nextQueue := []*Page{}
+		fmt.Fprintf(w, "Level %d:\n", level)
+		nextQueue := []*Page[K, V]{}
 		for _, page := range queue {
-			fmt.Printf("  Page %d: %v ", page.id, page.keys)
+			fmt.Fprintf(w, "  Page %d: %v ", page.id, page.keys)
 			if page.isLeaf {
-				fmt.Print("(leaf)")
-				if page.next != nil {
-					fmt.Printf(" -> Page %d", page.next.id)
+				fmt.Fprint(w, "(leaf)")
+				if page.next != META_PAGE_ID {
+					fmt.Fprintf(w, " -> Page %d", page.next)
 				}
 			} else {
-				fmt.Print("(internal)")
-				for _, p := range page.pointers {
-					if child, ok := p.(*Page); ok {
-						nextQueue = append(nextQueue, child)
+				fmt.Fprint(w, "(internal)")
+				for _, id := range page.children {
+					child, err := t.pool.FetchPage(id)
+					if err != nil {
+						fmt.Fprintln(w)
+						return err
 					}
+					// 逐层打印时不长期固定页，避免大树撑满缓冲池
+					t.pool.UnpinPage(child)
+					nextQueue = append(nextQueue, child)
 				}
 			}
-			fmt.Println()
+			fmt.Fprintln(w)
 		}
 		queue = nextQueue
 		level++
 	}
+	return nil
 }
 
 // 插入相关方法保持不变...
 
-// Delete 删除键
-func (t *BPlusTree) Delete(key int) bool {
-	leaf := t.findLeafPage(key)
-	idx := -1
-	for i, k := range leaf.keys {
-		if k == key {
-			idx = i
-			break
-		}
+// Delete 删除键，立即提交
+func (t *BPlusTree[K, V]) Delete(key K) (bool, error) {
+	if t.txns.locked(t.codec.encodeKey(key)) {
+		return false, ErrWriteConflict
+	}
+	var found bool
+	err := t.update(func(o *op[K, V]) error {
+		var err error
+		found, err = o.delete(key)
+		return err
+	})
+	return found, err
+}
+
+// delete 删除键，由调用方负责提交。
+// 有活跃事务时只留下删除标记，等它们结束后由 GC 物理删除
+func (o *op[K, V]) delete(key K) (bool, error) {
+	t := o.t
+	leaf, err := o.findLeafPage(key)
+	if err != nil {
+		return false, err
 	}
+	idx := t.indexOf(leaf, key)
 	if idx == -1 {
-		return false
+		return false, nil
+	}
+	if t.txns.idle() {
+		return true, o.remove(leaf, idx)
 	}
 
-	// 标记为已删除（逻辑删除）
-	if rec, ok := leaf.pointers[idx].(*Record); ok {
-		rec.status = 1
+	old := leaf.records[idx]
+	if old.status == 1 {
+		return false, nil
+	}
+	rec := &Record[K, V]{key: key, status: 1}
+	if !o.fits(leaf, len(leaf.keys), leaf.usedSpace()-leaf.recordSize(old)+leaf.recordSize(rec)) {
+		return false, errRestart
 	}
+	rec.txID = o.stamp()
+	t.txns.preserve(t.codec, old, rec.txID)
+	t.txns.bury(t.codec.encodeKey(key), key, rec.txID)
+	leaf.records[idx] = rec
+	leaf.updateFreeSpace()
+	return true, o.rebalance(leaf)
+}
 
-	// 物理删除（可选）
-	// leaf.keys = append(leaf.keys[:idx], leaf.keys[idx+1:]...)
-	// leaf.pointers = append(leaf.pointers[:idx], leaf.pointers[idx+1:]...)
-	// leaf.freeSpace += KEY_SIZE + POINTER_SIZE
-	// t.rebalance(leaf)
+// purge 物理删除在时间戳 horizon 之前留下的删除标记，由调用方负责提交
+func (o *op[K, V]) purge(key K, horizon int) (bool, error) {
+	leaf, err := o.findLeafPage(key)
+	if err != nil {
+		return false, err
+	}
+	idx := o.t.indexOf(leaf, key)
+	if idx == -1 {
+		return false, nil
+	}
+	if rec := leaf.records[idx]; rec.status != 1 || rec.txID > horizon {
+		return false, nil
+	}
+	return true, o.remove(leaf, idx)
+}
+
+// remove 从叶子页物理删除第 idx 项并重新平衡
+func (o *op[K, V]) remove(leaf *Page[K, V], idx int) error {
+	if !o.fits(leaf, len(leaf.keys)-1, leaf.usedSpace()-leaf.recordSize(leaf.records[idx])) {
+		return errRestart
+	}
+	leaf.keys = append(leaf.keys[:idx], leaf.keys[idx+1:]...)
+	leaf.records = append(leaf.records[:idx], leaf.records[idx+1:]...)
+	leaf.updateFreeSpace()
+	testHookCrash("delete:removed")
 
-	return true
+	return o.rebalance(leaf)
 }
 
-// rebalance 重新平衡页
-func (t *BPlusTree) rebalance(p *Page) {
-	if len(p.keys) < (t.order+1)/2 && p.parent != nil {
-		parent := p.parent
-		idx := t.getChildIndex(parent, p)
+// minKeys 非根页的最少键数
+func (t *BPlusTree[K, V]) minKeys(isLeaf bool) int {
+	if isLeaf {
+		return (t.order + 1) / 2
+	}
+	return t.order / 2
+}
 
-		// 尝试从左兄弟借
-		if idx > 0 {
-			leftSibling := parent.pointers[idx-1].(*Page)
-			if len(leftSibling.keys) > (t.order+1)/2 {
-				t.redistribute(leftSibling, p, parent, idx-1, false)
-				return
-			}
-		}
+// underflow 判断页是否下溢。页按字节分裂后键数可能偏少，
+// 因此只有键数和占用字节都不足时才算下溢
+func (t *BPlusTree[K, V]) underflow(p *Page[K, V]) bool {
+	return len(p.keys) < t.minKeys(p.isLeaf) &&
+		p.usedSpace()-PAGE_HEADER_SIZE < (PAGE_SIZE-PAGE_HEADER_SIZE)/4
+}
 
-		// 尝试从右兄弟借
-		if idx < len(parent.pointers)-1 {
-			rightSibling := parent.pointers[idx+1].(*Page)
-			if len(rightSibling.keys) > (t.order+1)/2 {
-				t.redistribute(p, rightSibling, parent, idx, true)
-				return
-			}
+// canLend 判断兄弟页借出第 i 项后是否仍不下溢
+func (t *BPlusTree[K, V]) canLend(p *Page[K, V], i int) bool {
+	used := p.usedSpace() - PAGE_HEADER_SIZE
+	if p.isLeaf {
+		used -= p.recordSize(p.records[i])
+	} else {
+		used -= p.entrySize(p.keys[i])
+	}
+	return len(p.keys)-1 >= t.minKeys(p.isLeaf) || used >= (PAGE_SIZE-PAGE_HEADER_SIZE)/4
+}
+
+// rebalance 重新平衡页: 下溢时先向兄弟借键，借不到就与兄弟合并，并递归处理父页
+func (o *op[K, V]) rebalance(p *Page[K, V]) error {
+	t := o.t
+	if o.isRoot(p) {
+		return o.shrinkRoot(p)
+	}
+	if !t.underflow(p) {
+		return nil
+	}
+
+	parent, err := o.parent(p)
+	if err != nil {
+		return err
+	}
+	idx := t.getChildIndex(parent, p)
+	if idx < 0 {
+		return fmt.Errorf("%w: page %d missing from parent %d", ErrCorruptPage, p.id, parent.id)
+	}
+
+	var leftSibling, rightSibling *Page[K, V]
+	if idx > 0 {
+		if leftSibling, err = o.fetch(parent.children[idx-1]); err != nil {
+			return err
 		}
+	}
+	if idx < len(parent.children)-1 {
+		if rightSibling, err = o.fetch(parent.children[idx+1]); err != nil {
+			return err
+		}
+	}
 
-		// 需要合并
-		if idx > 0 {
-			// 与左兄弟合并
-			leftSibling := parent.pointers[idx-1].(*Page)
-			t.merge(leftSibling, p, parent, idx-1)
+	// 尝试从兄弟借，变长记录可能要借多次
+	for t.underflow(p) {
+		if leftSibling != nil && t.canLend(leftSibling, len(leftSibling.keys)-1) {
+			o.redistribute(leftSibling, p, parent, idx-1, false)
+		} else if rightSibling != nil && t.canLend(rightSibling, 0) {
+			o.redistribute(p, rightSibling, parent, idx, true)
 		} else {
-			// 与右兄弟合并
-			rightSibling := parent.pointers[idx+1].(*Page)
-			t.merge(p, rightSibling, parent, idx)
+			break
+		}
+	}
+	if !t.underflow(p) {
+		// 换上的分隔键可能更长，父页放不下时分裂
+		if t.overflow(parent) {
+			return o.splitInternalPage(parent)
 		}
+		return nil
 	}
+
+	// 需要合并
+	if leftSibling != nil {
+		// 与左兄弟合并
+		err = o.merge(leftSibling, p, parent, idx-1)
+	} else if rightSibling != nil {
+		// 与右兄弟合并
+		err = o.merge(p, rightSibling, parent, idx)
+	} else {
+		return fmt.Errorf("%w: page %d has no siblings", ErrCorruptPage, p.id)
+	}
+	if err != nil {
+		return err
+	}
+	return o.rebalance(parent)
+}
+
+// shrinkRoot 根页只剩一个子页时让子页成为新根，树高减一
+func (o *op[K, V]) shrinkRoot(root *Page[K, V]) error {
+	if root.isLeaf || len(root.keys) > 0 {
+		return nil
+	}
+	o.setRoot(root.children[0])
+	o.t.pool.FreePage(root)
+	return nil
 }
 
 // redistribute 重新分配键
-func (t *BPlusTree) redistribute(left, right *Page, parent *Page, parentIdx int, borrowFromRight bool) {
+func (o *op[K, V]) redistribute(left, right *Page[K, V], parent *Page[K, V], parentIdx int, borrowFromRight bool) {
 	if borrowFromRight {
 		// 从右兄弟借一个键
 		if left.isLeaf {
 			// 叶子节点
 			left.keys = append(left.keys, right.keys[0])
-			left.pointers = append(left.pointers, right.pointers[0])
+			left.records = append(left.records, right.records[0])
 			right.keys = right.keys[1:]
-			right.pointers = right.pointers[1:]
+			right.records = right.records[1:]
 			parent.keys[parentIdx] = right.keys[0]
 		} else {
 			// 内部节点
 			left.keys = append(left.keys, parent.keys[parentIdx])
 			parent.keys[parentIdx] = right.keys[0]
-			left.pointers = append(left.pointers, right.pointers[0])
+			left.children = append(left.children, right.children[0])
 			right.keys = right.keys[1:]
-			right.pointers = right.pointers[1:]
+			right.children = right.children[1:]
 		}
 	} else {
 		// 从左兄弟借一个键
 		if left.isLeaf {
 			// 叶子节点
-			right.keys = append([]int{left.keys[len(left.keys)-1]}, right.keys...)
-			right.pointers = append([]interface{}{left.pointers[len(left.pointers)-1]}, right.pointers...)
+			right.keys = append([]K{left.keys[len(left.keys)-1]}, right.keys...)
+			right.records = append([]*Record[K, V]{left.records[len(left.records)-1]}, right.records...)
 			left.keys = left.keys[:len(left.keys)-1]
-			left.pointers = left.pointers[:len(left.pointers)-1]
+			left.records = left.records[:len(left.records)-1]
 			parent.keys[parentIdx] = right.keys[0]
 		} else {
 			// 内部节点
-			right.keys = append([]int{parent.keys[parentIdx]}, right.keys...)
+			right.keys = append([]K{parent.keys[parentIdx]}, right.keys...)
 			parent.keys[parentIdx] = left.keys[len(left.keys)-1]
-			right.pointers = append([]interface{}{left.pointers[len(left.pointers)-1]}, right.pointers...)
+			right.children = append([]int{left.children[len(left.children)-1]}, right.children...)
 			left.keys = left.keys[:len(left.keys)-1]
-			left.pointers = left.pointers[:len(left.pointers)-1]
+			left.children = left.children[:len(left.children)-1]
 		}
 	}
+	testHookCrash("redistribute:moved")
+
+	left.updateFreeSpace()
+	right.updateFreeSpace()
+	parent.updateFreeSpace()
 }
 
-// merge 合并页
-func (t *BPlusTree) merge(left, right *Page, parent *Page, parentIdx int) {
+// merge 把右页合并进左页并释放右页
+func (o *op[K, V]) merge(left, right *Page[K, V], parent *Page[K, V], parentIdx int) error {
 	if left.isLeaf {
-		// 合并叶子节点
+		// 合并叶子节点，下一页不在路径上，推迟到操作最后修改
 		left.keys = append(left.keys, right.keys...)
-		left.pointers = append(left.pointers, right.pointers...)
+		left.records = append(left.records, right.records...)
 		left.next = right.next
+		if right.next != META_PAGE_ID {
+			o.relinkLater(right.next, left.id)
+		}
 	} else {
-		// 合并内部节点
+		// 合并内部节点，分隔键下移
 		left.keys = append(left.keys, parent.keys[parentIdx])
 		left.keys = append(left.keys, right.keys...)
-		left.pointers = append(left.pointers, right.pointers...)
+		left.children = append(left.children, right.children...)
 	}
+	testHookCrash("merge:moved")
 
 	// 更新父节点
 	parent.keys = append(parent.keys[:parentIdx], parent.keys[parentIdx+1:]...)
-	parent.pointers = append(parent.pointers[:parentIdx+1], parent.pointers[parentIdx+2:]...)
+	parent.children = append(parent.children[:parentIdx+1], parent.children[parentIdx+2:]...)
 
-	// 如果父节点是根且变空
-	if parent == t.root && len(parent.keys) == 0 {
-		t.root = left
-		left.parent = nil
+	left.updateFreeSpace()
+	parent.updateFreeSpace()
+	if o.t.overflow(left) {
+		return fmt.Errorf("%w: merged page %d overflows", ErrCorruptPage, left.id)
 	}
+	o.t.pool.FreePage(right)
+	return nil
 }
 
 // getChildIndex 获取子页索引
-func (t *BPlusTree) getChildIndex(parent, child *Page) int {
-	for i, p := range parent.pointers {
-		if p == child {
+func (t *BPlusTree[K, V]) getChildIndex(parent, child *Page[K, V]) int {
+	for i, id := range parent.children {
+		if id == child.id {
 			return i
 		}
 	}
 	return -1
 }
 
-// BatchInsert 批量插入
-func (t *BPlusTree) BatchInsert(records map[int]string) {
-	for key, value := range records {
-		t.Insert(key, value)
-	}
-}
-
 // BatchDelete 批量删除
-func (t *BPlusTree) BatchDelete(keys []int) {
+func (t *BPlusTree[K, V]) BatchDelete(keys []K) error {
 	for _, key := range keys {
-		t.Delete(key)
+		if _, err := t.Delete(key); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// 其他方法保持不变...
+// Vacuum 物理删除所有活跃快照都看不到其旧版本的删除标记(status=1)并回收页，返回清理的记录数
+func (t *BPlusTree[K, V]) Vacuum() (int, error) {
+	if err := t.failure(); err != nil {
+		return 0, err
+	}
+	horizon := t.txns.horizon()
+	tombstones, err := t.collectTombstones(horizon)
+	if err != nil {
+		return 0, err
+	}
 
-func main() {
-	tree := NewBPlusTree(3)
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Println("MySQL风格B+树实现（完整版）")
-	fmt.Println("命令:")
-	fmt.Println("  insert <key> <value> - 插入记录")
-	fmt.Println("  delete <key> - 删除记录")
-	fmt.Println("  batch_insert <key1:value1,key2:value2,...> - 批量插入")
-	fmt.Println("  batch_delete <key1,key2,...> - 批量删除")
-	fmt.Println("  search <key> - 搜索记录")
-	fmt.Println("  print - 打印树结构")
-	fmt.Println("  exit - 退出")
-
-	for {
-		fmt.Print("> ")
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		parts := strings.Split(input, " ")
-
-		if len(parts) == 0 {
-			continue
+	n := 0
+	for _, key := range tombstones {
+		var purged bool
+		err := t.update(func(o *op[K, V]) error {
+			var err error
+			purged, err = o.purge(key, horizon)
+			return err
+		})
+		if err != nil {
+			return n, err
 		}
+		if purged {
+			t.txns.unbury(t.codec.encodeKey(key))
+			n++
+		}
+	}
+	return n, nil
+}
 
-		switch parts[0] {
-		case "insert":
-			if len(parts) < 3 {
-				parts = append(parts, fmt.Sprint("v", parts[1]))
-				/* fmt.Println("Usage: insert <key> <value>")
-				continue */
-			}
-			key, err := strconv.Atoi(parts[1])
-			if err != nil {
-				fmt.Println("无效键")
-				continue
-			}
-			value := strings.Join(parts[2:], " ")
-			tree.Insert(key, value)
-			fmt.Printf("已插入记录: %d -> %s\n", key, value)
-			tree.Print()
-
-		case "delete":
-			if len(parts) < 2 {
-				fmt.Println("Usage: delete <key>")
-				continue
-			}
-			key, err := strconv.Atoi(parts[1])
-			if err != nil {
-				fmt.Println("无效键")
-				continue
-			}
-			if tree.Delete(key) {
-				fmt.Printf("已删除键 %d\n", key)
-			} else {
-				fmt.Printf("键 %d 未找到\n", key)
-			}
-
-		case "batch_insert":
-			if len(parts) < 2 {
-				fmt.Println("Usage: batch_insert <key1:value1,key2:value2,...>")
-				continue
-			}
-			records := make(map[int]string)
-			pairs := strings.Split(parts[1], ",")
-			for _, pair := range pairs {
-				kv := strings.Split(pair, ":")
-				if len(kv) != 2 {
-					fmt.Printf("无效键值对: %s\n", pair)
-					continue
-				}
-				key, err := strconv.Atoi(kv[0])
-				if err != nil {
-					fmt.Printf("无效键: %s\n", kv[0])
-					continue
-				}
-				records[key] = kv[1]
-			}
-			tree.BatchInsert(records)
-			fmt.Printf("已批量插入 %d 条记录\n", len(records))
-			tree.Print()
-
-		case "batch_delete":
-			if len(parts) < 2 {
-				fmt.Println("Usage: batch_delete <key1,key2,...>")
-				continue
-			}
-			keys := make([]int, 0)
-			for _, k := range strings.Split(parts[1], ",") {
-				key, err := strconv.Atoi(k)
-				if err != nil {
-					fmt.Printf("无效键: %s\n", k)
-					continue
-				}
-				keys = append(keys, key)
-			}
-			tree.BatchDelete(keys)
-			fmt.Printf("已批量删除 %d 个键\n", len(keys))
-
-		case "search":
-			if len(parts) < 2 {
-				fmt.Println("Usage: search <key>")
-				continue
-			}
-			key, err := strconv.Atoi(parts[1])
-			if err != nil {
-				fmt.Println("无效键")
-				continue
-			}
-			record := tree.Search(key)
-			if record != nil {
-				if record.status == 0 {
-					fmt.Printf("找到记录: %d -> %s\n", record.key, record.value)
-				} else {
-					fmt.Printf("键 %d 已被删除\n", key)
-				}
-			} else {
-				fmt.Printf("键 %d 未找到\n", key)
+// collectTombstones 独占整棵树，沿叶子链表收集时间戳不晚于 horizon 的删除标记
+func (t *BPlusTree[K, V]) collectTombstones(horizon int) ([]K, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	first, err := t.edgeLeaf(false)
+	if err != nil {
+		return nil, err
+	}
+	var tombstones []K
+	for id := first.id; id != META_PAGE_ID; {
+		p, err := t.pool.FetchPage(id)
+		if err != nil {
+			return nil, err
+		}
+		t.pool.UnpinPage(p)
+		for _, rec := range p.records {
+			if rec.status == 1 && rec.txID <= horizon {
+				tombstones = append(tombstones, rec.key)
 			}
+		}
+		id = p.next
+	}
+	return tombstones, nil
+}
 
-		case "print":
-			tree.Print()
-
-		case "exit":
-			fmt.Println("退出中...")
-			return
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-		default:
-			fmt.Println("未知命令")
+func run() error {
+	s := &session{}
+	cli := s.interpreter()
+	dbPath := flag.String("db", "", "数据文件路径，为空时使用纯内存树")
+	order := flag.Int("order", 3, "新建树的阶数")
+	load := flag.String("load", "", "启动时把按键升序的 key,value CSV 文件批量装入空树，- 表示标准输入(装载后退出)")
+	flag.Float64Var(&s.fill, "fill", DEFAULT_FILL_FACTOR, "批量装载时的页填充因子(0.5~1)")
+	cli.Flags(flag.CommandLine)
+	flag.Parse()
+
+	s.tree = NewBPlusTree(*order)
+	if *dbPath != "" {
+		var err error
+		s.tree, err = Open(*dbPath, WithOrder(*order))
+		if err != nil {
+			return fmt.Errorf("打开数据文件失败: %w", err)
+		}
+	}
+	defer func() {
+		if s.tx != nil {
+			s.tx.Rollback()
+		}
+		if err := s.tree.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "关闭数据文件失败:", err)
+		}
+	}()
+	if *load != "" {
+		n, err := loadFile(s.tree, *load, s.fill)
+		if err != nil {
+			return fmt.Errorf("批量装载失败: %w", err)
+		}
+		if !cli.Quiet {
+			fmt.Printf("已批量装载 %d 条记录\n", n)
+		}
+		if *load == "-" {
+			return nil
 		}
 	}
+	return cli.Main()
 }
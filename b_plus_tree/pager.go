@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 数据文件布局:
+//
+//	页0: 元数据页(魔数、版本、阶数、根页ID、页数、检查点LSN、空闲页链表头、事务时钟)
+//	页N: 位于偏移 N*PAGE_SIZE 的固定4KiB槽位
+//
+// 普通页的页头(PAGE_HEADER_SIZE字节):
+//
+//	[0]     页类型(1=叶子, 2=内部, 3=空闲)
+//	[1]     保留
+//	[2:4]   键数量
+//	[4:8]   保留
+//	[8:12]  下一个叶子页ID(空闲页为下一个空闲页ID)
+//	[12:16] 上一个叶子页ID
+//	[16:24] 页LSN(最后一次修改对应的重做日志序号)
+//
+// 叶子页记录: keyLen(2) valueLen(2) status(1) txID(8) key value
+// 内部页: child0(4) 之后每项 keyLen(2) key child(4)
+// 页ID和页数一律占4字节(uint32): 页头中的页指针、内部页的子页指针、元数据页中的根页ID、页数和空闲页链表头
+// 键和值由树的 Codec 编码，数据文件本身不记录键值类型
+const (
+	META_PAGE_ID     = 0             // 元数据页ID，同时作为"空页ID"
+	PAGE_HEADER_SIZE = 24            // 页头大小(字节)
+	KEY_LEN_SIZE     = 2             // 键长度字段大小(字节)
+	RECORD_HEADER    = 2 + 2 + 1 + 8 // 叶子记录除键值以外的开销
+	MAX_KEY_SIZE     = 256           // 编码后键的最大长度
+	MAX_VALUE_SIZE   = 1024          // 编码后值的最大长度，保证分裂后两半都能放进一页
+	FILE_MAGIC       = "BPT1"        // 数据文件魔数
+	FILE_VERSION     = 6             // 数据文件格式版本
+
+	pageTypeLeaf     = 1
+	pageTypeInternal = 2
+	pageTypeFree     = 3
+)
+
+var (
+	ErrBadMagic      = errors.New("b+tree: not a b+tree data file")
+	ErrCorruptPage   = errors.New("b+tree: corrupt page")
+	ErrKeyTooLarge   = fmt.Errorf("b+tree: key exceeds %d bytes", MAX_KEY_SIZE)
+	ErrValueTooLarge = fmt.Errorf("b+tree: value exceeds %d bytes", MAX_VALUE_SIZE)
+)
+
+// maxOrder 阶数上限(内部页按最短的键能容纳的项数)，键较长时页按字节数分裂
+func maxOrder() int {
+	return (PAGE_SIZE - PAGE_HEADER_SIZE - POINTER_SIZE) / (KEY_LEN_SIZE + POINTER_SIZE)
+}
+
+// fileMeta 元数据页内容
+type fileMeta struct {
+	order     int
+	root      int
+	pageCount int    // 已分配的页数(含元数据页)
+	lsn       uint64 // 检查点LSN，之前的日志都已反映在数据文件中
+	freeList  int    // 空闲页链表头
+	clock     int    // 最后一次提交的事务时间戳
+}
+
+// PageFile 以固定大小槽位存放页的数据文件
+type PageFile struct {
+	f *os.File
+}
+
+// openPageFile 打开(或创建)数据文件
+func openPageFile(path string) (*PageFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &PageFile{f: f}, nil
+}
+
+// readMeta 读取元数据页，新建的空文件返回 nil
+func (pf *PageFile) readMeta() (*fileMeta, error) {
+	info, err := pf.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, PAGE_SIZE)
+	if err := pf.readPage(META_PAGE_ID, buf); err != nil {
+		return nil, err
+	}
+	return decodeMeta(buf)
+}
+
+// pageLSN 读取文件中某页的LSN，页不存在或已损坏时返回0
+func (pf *PageFile) pageLSN(id int, buf []byte) uint64 {
+	if err := pf.readPage(id, buf); err != nil {
+		return 0
+	}
+	if buf[0] < pageTypeLeaf || buf[0] > pageTypeFree {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(buf[16:24])
+}
+
+// readPage 读取一页到 buf
+func (pf *PageFile) readPage(id int, buf []byte) error {
+	_, err := pf.f.ReadAt(buf[:PAGE_SIZE], int64(id)*PAGE_SIZE)
+	if err == io.EOF {
+		return fmt.Errorf("%w: page %d beyond end of file", ErrCorruptPage, id)
+	}
+	return err
+}
+
+// writePage 把 buf 写入指定页槽位
+func (pf *PageFile) writePage(id int, buf []byte) error {
+	_, err := pf.f.WriteAt(buf[:PAGE_SIZE], int64(id)*PAGE_SIZE)
+	return err
+}
+
+// writeMeta 写元数据页
+func (pf *PageFile) writeMeta(meta *fileMeta) error {
+	buf := make([]byte, PAGE_SIZE)
+	encodeMeta(meta, buf)
+	return pf.writePage(META_PAGE_ID, buf)
+}
+
+func (pf *PageFile) sync() error {
+	return pf.f.Sync()
+}
+
+func (pf *PageFile) close() error {
+	return pf.f.Close()
+}
+
+func encodeMeta(meta *fileMeta, buf []byte) {
+	copy(buf[0:4], FILE_MAGIC)
+	binary.LittleEndian.PutUint16(buf[4:6], FILE_VERSION)
+	binary.LittleEndian.PutUint16(buf[6:8], uint16(meta.order))
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(meta.root))
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(meta.pageCount))
+	binary.LittleEndian.PutUint64(buf[16:24], meta.lsn)
+	binary.LittleEndian.PutUint32(buf[24:28], uint32(meta.freeList))
+	binary.LittleEndian.PutUint64(buf[28:36], uint64(meta.clock))
+}
+
+func decodeMeta(buf []byte) (*fileMeta, error) {
+	if string(buf[0:4]) != FILE_MAGIC {
+		return nil, ErrBadMagic
+	}
+	if v := binary.LittleEndian.Uint16(buf[4:6]); v != FILE_VERSION {
+		return nil, fmt.Errorf("b+tree: unsupported file version %d", v)
+	}
+	return &fileMeta{
+		order:     int(binary.LittleEndian.Uint16(buf[6:8])),
+		root:      int(binary.LittleEndian.Uint32(buf[8:12])),
+		pageCount: int(binary.LittleEndian.Uint32(buf[12:16])),
+		lsn:       binary.LittleEndian.Uint64(buf[16:24]),
+		freeList:  int(binary.LittleEndian.Uint32(buf[24:28])),
+		clock:     int(binary.LittleEndian.Uint64(buf[28:36])),
+	}, nil
+}
+
+// recordSize 叶子记录序列化后的大小
+func (p *Page[K, V]) recordSize(rec *Record[K, V]) int {
+	return RECORD_HEADER + p.codec.key.Size(rec.key) + p.codec.value.Size(rec.value)
+}
+
+// entrySize 内部页中一个分隔键及其右侧子页指针序列化后的大小
+func (p *Page[K, V]) entrySize(key K) int {
+	return KEY_LEN_SIZE + p.codec.key.Size(key) + POINTER_SIZE
+}
+
+// usedSpace 计算页序列化后占用的字节数
+func (p *Page[K, V]) usedSpace() int {
+	used := PAGE_HEADER_SIZE
+	if p.isFree {
+		return used
+	}
+	if p.isLeaf {
+		for _, rec := range p.records {
+			used += p.recordSize(rec)
+		}
+		return used
+	}
+	used += POINTER_SIZE
+	for _, key := range p.keys {
+		used += p.entrySize(key)
+	}
+	return used
+}
+
+// markDirty 标记页已修改: 需要写回文件，且要在本次操作提交时写入重做日志
+func (p *Page[K, V]) markDirty() {
+	p.dirty = true
+	p.pending = true
+}
+
+// updateFreeSpace 按实际序列化大小刷新空闲空间并标记脏页
+func (p *Page[K, V]) updateFreeSpace() {
+	p.freeSpace = PAGE_SIZE - p.usedSpace()
+	p.markDirty()
+}
+
+// encodePage 把页序列化到 buf(长度至少 PAGE_SIZE)
+func encodePage[K, V any](p *Page[K, V], buf []byte) error {
+	if p.usedSpace() > PAGE_SIZE {
+		return fmt.Errorf("%w: page %d overflows (%d bytes)", ErrCorruptPage, p.id, p.usedSpace())
+	}
+	clear(buf[:PAGE_SIZE])
+
+	switch {
+	case p.isFree:
+		buf[0] = pageTypeFree
+	case p.isLeaf:
+		buf[0] = pageTypeLeaf
+	default:
+		buf[0] = pageTypeInternal
+	}
+	binary.LittleEndian.PutUint16(buf[2:4], uint16(len(p.keys)))
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(p.next))
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(p.prev))
+	binary.LittleEndian.PutUint64(buf[16:24], p.lsn)
+
+	c := p.codec
+	off := PAGE_HEADER_SIZE
+	if p.isFree {
+		return nil
+	}
+	if p.isLeaf {
+		for _, rec := range p.records {
+			klen := c.key.Size(rec.key)
+			vlen := c.value.Size(rec.value)
+			binary.LittleEndian.PutUint16(buf[off:], uint16(klen))
+			binary.LittleEndian.PutUint16(buf[off+2:], uint16(vlen))
+			buf[off+4] = rec.status
+			binary.LittleEndian.PutUint64(buf[off+5:], uint64(rec.txID))
+			off += RECORD_HEADER
+			c.key.Encode(buf[off:off+klen], rec.key)
+			off += klen
+			c.value.Encode(buf[off:off+vlen], rec.value)
+			off += vlen
+		}
+		return nil
+	}
+
+	binary.LittleEndian.PutUint32(buf[off:], uint32(p.children[0]))
+	off += POINTER_SIZE
+	for i, key := range p.keys {
+		klen := c.key.Size(key)
+		binary.LittleEndian.PutUint16(buf[off:], uint16(klen))
+		off += KEY_LEN_SIZE
+		c.key.Encode(buf[off:off+klen], key)
+		off += klen
+		binary.LittleEndian.PutUint32(buf[off:], uint32(p.children[i+1]))
+		off += POINTER_SIZE
+	}
+	return nil
+}
+
+// decodePage 从 buf 反序列化页
+func decodePage[K, V any](c *codecs[K, V], id int, buf []byte) (*Page[K, V], error) {
+	p := &Page[K, V]{id: id, codec: c}
+	switch buf[0] {
+	case pageTypeLeaf:
+		p.isLeaf = true
+	case pageTypeInternal:
+	case pageTypeFree:
+		p.isFree = true
+	default:
+		return nil, fmt.Errorf("%w: page %d has type %d", ErrCorruptPage, id, buf[0])
+	}
+	n := int(binary.LittleEndian.Uint16(buf[2:4]))
+	p.next = int(binary.LittleEndian.Uint32(buf[8:12]))
+	p.prev = int(binary.LittleEndian.Uint32(buf[12:16]))
+	p.lsn = binary.LittleEndian.Uint64(buf[16:24])
+
+	off := PAGE_HEADER_SIZE
+	if p.isFree {
+		p.freeSpace = PAGE_SIZE - p.usedSpace()
+		return p, nil
+	}
+	p.keys = make([]K, 0, n)
+	if p.isLeaf {
+		p.records = make([]*Record[K, V], 0, n)
+		for i := 0; i < n; i++ {
+			if off+RECORD_HEADER > PAGE_SIZE {
+				return nil, fmt.Errorf("%w: page %d record %d out of bounds", ErrCorruptPage, id, i)
+			}
+			klen := int(binary.LittleEndian.Uint16(buf[off:]))
+			vlen := int(binary.LittleEndian.Uint16(buf[off+2:]))
+			rec := &Record[K, V]{
+				status: buf[off+4],
+				txID:   int(binary.LittleEndian.Uint64(buf[off+5:])),
+			}
+			off += RECORD_HEADER
+			if off+klen+vlen > PAGE_SIZE {
+				return nil, fmt.Errorf("%w: page %d record %d out of bounds", ErrCorruptPage, id, i)
+			}
+			var err error
+			if rec.key, err = c.key.Decode(buf[off : off+klen]); err != nil {
+				return nil, err
+			}
+			off += klen
+			if rec.value, err = c.value.Decode(buf[off : off+vlen]); err != nil {
+				return nil, err
+			}
+			off += vlen
+			p.keys = append(p.keys, rec.key)
+			p.records = append(p.records, rec)
+		}
+	} else {
+		p.children = make([]int, 0, n+1)
+		p.children = append(p.children, int(binary.LittleEndian.Uint32(buf[off:])))
+		off += POINTER_SIZE
+		for i := 0; i < n; i++ {
+			if off+KEY_LEN_SIZE > PAGE_SIZE {
+				return nil, fmt.Errorf("%w: page %d key %d out of bounds", ErrCorruptPage, id, i)
+			}
+			klen := int(binary.LittleEndian.Uint16(buf[off:]))
+			off += KEY_LEN_SIZE
+			if off+klen+POINTER_SIZE > PAGE_SIZE {
+				return nil, fmt.Errorf("%w: page %d key %d out of bounds", ErrCorruptPage, id, i)
+			}
+			key, err := c.key.Decode(buf[off : off+klen])
+			if err != nil {
+				return nil, err
+			}
+			off += klen
+			p.keys = append(p.keys, key)
+			p.children = append(p.children, int(binary.LittleEndian.Uint32(buf[off:])))
+			off += POINTER_SIZE
+		}
+	}
+	p.freeSpace = PAGE_SIZE - p.usedSpace()
+	return p, nil
+}
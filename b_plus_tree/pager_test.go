@@ -0,0 +1,170 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCodecs int 键 string 值
+var testCodecs = &codecs[int, string]{cmp: cmp.Compare[int], key: IntCodec{}, value: StringCodec{}}
+
+func TestPageEncodeDecode(t *testing.T) {
+	leaf := &Page[int, string]{id: 7, isLeaf: true, next: 9, prev: 5, codec: testCodecs}
+	for i := 0; i < 5; i++ {
+		rec := &Record[int, string]{key: i - 2, value: strings.Repeat("x", i*10), status: byte(i % 2), txID: i * 100}
+		leaf.keys = append(leaf.keys, rec.key)
+		leaf.records = append(leaf.records, rec)
+	}
+	buf := make([]byte, PAGE_SIZE)
+	if err := encodePage(leaf, buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodePage(testCodecs, 7, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.isLeaf || got.next != 9 || got.prev != 5 || len(got.keys) != 5 {
+		t.Fatalf("header mismatch: %+v", got)
+	}
+	for i, rec := range got.records {
+		if want := leaf.records[i]; *rec != *want {
+			t.Errorf("record %d: got %+v, want %+v", i, rec, want)
+		}
+	}
+	if got.freeSpace != PAGE_SIZE-leaf.usedSpace() {
+		t.Errorf("freeSpace = %d, want %d", got.freeSpace, PAGE_SIZE-leaf.usedSpace())
+	}
+
+	internal := &Page[int, string]{id: 3, keys: []int{10, 20}, children: []int{4, 5, 6}, codec: testCodecs}
+	if err := encodePage(internal, buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err = decodePage(testCodecs, 3, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.isLeaf || fmt.Sprint(got.keys) != "[10 20]" || fmt.Sprint(got.children) != "[4 5 6]" {
+		t.Fatalf("internal page mismatch: %+v", got)
+	}
+}
+
+func TestBufferPoolFull(t *testing.T) {
+	pf, err := openPageFile(filepath.Join(t.TempDir(), "pool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.close()
+
+	bp := NewBufferPool(testCodecs, pf, 8, 1)
+	for i := 0; i < 8; i++ {
+		if _, err := bp.NewPage(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bp.NewPage(true); !errors.Is(err, ErrBufferPoolFull) {
+		t.Fatalf("expected ErrBufferPoolFull, got %v", err)
+	}
+}
+
+func TestBufferPoolEvictsDirtyPages(t *testing.T) {
+	pf, err := openPageFile(filepath.Join(t.TempDir(), "pool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.close()
+
+	bp := NewBufferPool(testCodecs, pf, 8, 1)
+	for i := 0; i < 32; i++ {
+		p, err := bp.NewPage(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.keys = append(p.keys, i)
+		p.records = append(p.records, &Record[int, string]{key: i, value: fmt.Sprint("v", i)})
+		p.updateFreeSpace()
+		p.pending = false // 相当于已提交
+		bp.UnpinPage(p)
+	}
+	if len(bp.frames) != 8 {
+		t.Fatalf("pool holds %d frames, want 8", len(bp.frames))
+	}
+	for id := 1; id <= 32; id++ {
+		p, err := bp.FetchPage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec := p.records[0]; rec.key != id-1 || rec.value != fmt.Sprint("v", id-1) {
+			t.Errorf("page %d: got %+v", id, rec)
+		}
+		bp.UnpinPage(p)
+	}
+}
+
+func TestOpenCloseReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithOrder(8), WithPoolSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make(map[int]string)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		key := rng.Intn(20000)
+		value := strings.Repeat(fmt.Sprint(key), 1+key%7)
+		want[key] = value
+		if err := tree.Insert(key, value); err != nil {
+			t.Fatalf("insert %d: %v", key, err)
+		}
+	}
+	if tree.pool.misses == 0 {
+		t.Fatal("expected the tree to outgrow a 16-page pool")
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = Open(path, WithPoolSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if tree.order != 8 {
+		t.Errorf("order = %d, want 8", tree.order)
+	}
+	for key, value := range want {
+		rec, err := tree.Search(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec == nil || rec.value != value {
+			t.Fatalf("key %d: got %v, want %q", key, rec, value)
+		}
+	}
+	if rec, _ := tree.Search(-1); rec != nil {
+		t.Errorf("unexpected record for missing key: %+v", rec)
+	}
+}
+
+func TestLargeValuesSplitByBytes(t *testing.T) {
+	tree := NewBPlusTree(200)
+	value := strings.Repeat("v", MAX_VALUE_SIZE)
+	for i := 0; i < 50; i++ {
+		if err := tree.Insert(i, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range tree.pool.frames {
+		if p.freeSpace < 0 {
+			t.Errorf("page %d overflows by %d bytes", p.id, -p.freeSpace)
+		}
+	}
+	if err := tree.Insert(100, value+"x"); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("expected ErrValueTooLarge, got %v", err)
+	}
+}
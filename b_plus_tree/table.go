@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// 表:
+//
+// 与 InnoDB 一样，表由一棵聚簇主键索引和若干二级索引组成，每个索引都是一棵B+树:
+//   - 主键树: 主键 -> 编码后的整行
+//   - 二级索引树: 列值+主键 -> 空值。列值相同的项按主键排在一起，查询时再回主键树取整行
+//
+// 键按可比较编码(memcomparable)编成字节串，字节序与列值的顺序一致，
+// 整数是翻转符号位的8字节大端，字符串中的 0x00 转义成 0x00 0xFF 并以 0x00 0x01 结尾。
+// 编码无前缀歧义，因此二级索引键可以直接截出列值部分和主键部分。
+//
+// 一次写操作要改多棵树，崩溃时可能只改了其中一部分。写入时先加新的索引项、再改主键树、
+// 最后删旧的索引项，崩溃后最多留下指向不存在或已变化的行的索引项，查询回表时按列值复核并跳过。
+
+// PRIMARY 主键索引的名字
+const PRIMARY = "PRIMARY"
+
+var (
+	ErrDuplicateKey = errors.New("b+tree: duplicate key")
+	ErrRowNotFound  = errors.New("b+tree: row not found")
+	ErrNoSuchIndex  = errors.New("b+tree: no such index")
+	ErrBadRow       = errors.New("b+tree: row does not match schema")
+	ErrBadSchema    = errors.New("b+tree: bad schema")
+)
+
+// ColumnType 列类型
+type ColumnType byte
+
+const (
+	IntColumn    ColumnType = iota + 1 // Go 类型为 int
+	StringColumn                       // Go 类型为 string
+)
+
+func (ct ColumnType) String() string {
+	switch ct {
+	case IntColumn:
+		return "int"
+	case StringColumn:
+		return "string"
+	}
+	return fmt.Sprintf("ColumnType(%d)", byte(ct))
+}
+
+// Column 列定义
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Index 二级索引定义
+type Index struct {
+	Name   string
+	Column string
+	Unique bool
+}
+
+// Schema 表结构。数据文件不记录表结构，打开已有的表时需给出建表时的主键和列
+type Schema struct {
+	Columns    []Column
+	PrimaryKey string  // 主键列名
+	Indexes    []Index // 二级索引，可以在重新打开时追加
+}
+
+// Row 一行数据，按 Schema.Columns 的顺序给出各列的值
+type Row []any
+
+// Table 带二级索引的表，可以在多个goroutine中并发使用
+type Table struct {
+	mu      sync.RWMutex // 写操作要改多棵树，互相串行
+	schema  Schema
+	pk      int // 主键列下标
+	primary *BPlusTree[[]byte, []byte]
+	indexes map[string]*secondary
+}
+
+// secondary 一个二级索引
+type secondary struct {
+	Index
+	col  int
+	typ  ColumnType
+	tree *BPlusTree[[]byte, []byte]
+}
+
+// NewTable 创建纯内存的表
+func NewTable(schema Schema) (*Table, error) {
+	return newTable(schema, func(string) (*BPlusTree[[]byte, []byte], error) {
+		return New(bytes.Compare, BytesCodec{}, BytesCodec{}, maxOrder()), nil
+	})
+}
+
+// OpenTable 打开(不存在则创建)目录 dir 下的表: 主键树保存在 PRIMARY.db，
+// 每个二级索引保存在 <索引名>.db。新加的二级索引在打开时由主键树中的行建好
+func OpenTable(dir string, schema Schema, opts ...Option) (*Table, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	opts = append([]Option{WithOrder(maxOrder())}, opts...)
+	return newTable(schema, func(name string) (*BPlusTree[[]byte, []byte], error) {
+		return OpenTree(filepath.Join(dir, name+".db"), bytes.Compare, BytesCodec{}, BytesCodec{}, opts...)
+	})
+}
+
+func newTable(schema Schema, open func(name string) (*BPlusTree[[]byte, []byte], error)) (*Table, error) {
+	tb := &Table{schema: schema, pk: schema.column(schema.PrimaryKey), indexes: make(map[string]*secondary)}
+	if err := schema.check(); err != nil {
+		return nil, err
+	}
+	var err error
+	if tb.primary, err = open(PRIMARY); err != nil {
+		return nil, err
+	}
+	for _, ix := range schema.Indexes {
+		col := schema.column(ix.Column)
+		s := &secondary{Index: ix, col: col, typ: schema.Columns[col].Type}
+		if s.tree, err = open(ix.Name); err == nil {
+			tb.indexes[ix.Name] = s
+			err = tb.backfill(s)
+		}
+		if err != nil {
+			tb.Close()
+			return nil, err
+		}
+	}
+	return tb, nil
+}
+
+// column 返回列下标，不存在时返回 -1
+func (s *Schema) column(name string) int {
+	return slices.IndexFunc(s.Columns, func(c Column) bool { return c.Name == name })
+}
+
+// check 检查列名、主键和索引定义
+func (s *Schema) check() error {
+	seen := make(map[string]bool)
+	for _, c := range s.Columns {
+		if c.Name == "" || seen[c.Name] {
+			return fmt.Errorf("%w: empty or duplicate column name %q", ErrBadSchema, c.Name)
+		}
+		if c.Type != IntColumn && c.Type != StringColumn {
+			return fmt.Errorf("%w: column %q has unknown type %v", ErrBadSchema, c.Name, c.Type)
+		}
+		seen[c.Name] = true
+	}
+	if s.column(s.PrimaryKey) < 0 {
+		return fmt.Errorf("%w: primary key column %q not found", ErrBadSchema, s.PrimaryKey)
+	}
+	names := map[string]bool{PRIMARY: true}
+	for _, ix := range s.Indexes {
+		if ix.Name == "" || names[ix.Name] || filepath.Base(ix.Name) != ix.Name {
+			return fmt.Errorf("%w: bad or duplicate index name %q", ErrBadSchema, ix.Name)
+		}
+		if s.column(ix.Column) < 0 {
+			return fmt.Errorf("%w: index %q on unknown column %q", ErrBadSchema, ix.Name, ix.Column)
+		}
+		names[ix.Name] = true
+	}
+	return nil
+}
+
+// backfill 索引为空而表中已有行时(索引是新加的)，按索引键排序后批量装载
+func (tb *Table) backfill(s *secondary) error {
+	c := s.tree.NewCursor()
+	if c.First(); c.Err() != nil || c.Valid() {
+		return c.Err()
+	}
+	var entries [][]byte
+	for key, value := range tb.primary.All() {
+		row, err := tb.decodeRow(value)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, s.key(row[s.col], key))
+	}
+	slices.SortFunc(entries, bytes.Compare)
+	if s.Unique {
+		for i := 1; i < len(entries); i++ {
+			if bytes.Equal(s.value(entries[i-1]), s.value(entries[i])) {
+				return fmt.Errorf("%w: building unique index %q", ErrDuplicateKey, s.Name)
+			}
+		}
+	}
+	_, err := s.tree.BulkLoad(func(yield func([]byte, []byte) bool) {
+		for _, key := range entries {
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}, 0)
+	return err
+}
+
+// Close 关闭表的所有索引树
+func (tb *Table) Close() error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	var err error
+	if tb.primary != nil {
+		err = tb.primary.Close()
+	}
+	for _, s := range tb.indexes {
+		if cerr := s.tree.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Insert 插入一行，主键或唯一索引列的值已存在时返回 ErrDuplicateKey
+func (tb *Table) Insert(row Row) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	pk, err := tb.primaryKey(row)
+	if err != nil {
+		return err
+	}
+	if _, found, err := tb.get(pk); err != nil || found {
+		if found {
+			err = fmt.Errorf("%w: %s = %v", ErrDuplicateKey, tb.schema.PrimaryKey, row[tb.pk])
+		}
+		return err
+	}
+	return tb.write(pk, nil, row)
+}
+
+// Update 按主键整行替换，行不存在时返回 ErrRowNotFound
+func (tb *Table) Update(row Row) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	pk, err := tb.primaryKey(row)
+	if err != nil {
+		return err
+	}
+	old, found, err := tb.get(pk)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s = %v", ErrRowNotFound, tb.schema.PrimaryKey, row[tb.pk])
+	}
+	return tb.write(pk, old, row)
+}
+
+// Delete 按主键删除一行，返回行是否存在
+func (tb *Table) Delete(pk any) (bool, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	key, err := tb.primaryKey(tb.keyRow(pk))
+	if err != nil {
+		return false, err
+	}
+	old, found, err := tb.get(key)
+	if err != nil || !found {
+		return false, err
+	}
+	if _, err := tb.primary.Delete(key); err != nil {
+		return false, err
+	}
+	for _, s := range tb.indexes {
+		if _, err := s.tree.Delete(s.key(old[s.col], key)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Get 按主键取一行
+func (tb *Table) Get(pk any) (Row, bool, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	key, err := tb.primaryKey(tb.keyRow(pk))
+	if err != nil {
+		return nil, false, err
+	}
+	return tb.get(key)
+}
+
+// Lookup 返回索引列等于 value 的所有行，按主键排序。index 为 PRIMARY 时按主键查找
+func (tb *Table) Lookup(index string, value any) ([]Row, error) {
+	if value == nil {
+		return nil, fmt.Errorf("%w: lookup of nil", ErrBadRow)
+	}
+	return tb.Range(index, value, value)
+}
+
+// Range 返回索引列在 [lo, hi] 内的所有行，按索引列排序，列值相同时按主键排序。
+// lo 或 hi 为 nil 时该端无界，index 为 PRIMARY 时按主键范围查询
+func (tb *Table) Range(index string, lo, hi any) ([]Row, error) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	if index == PRIMARY {
+		return tb.scanPrimary(lo, hi)
+	}
+	s, ok := tb.indexes[index]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoSuchIndex, index)
+	}
+	from, to, err := bounds(s.typ, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	c := s.tree.NewCursor()
+	for c.Seek(from); c.Valid(); c.Next() {
+		value := s.value(c.Key())
+		if to != nil && bytes.Compare(value, to) > 0 {
+			break
+		}
+		row, found, err := tb.get(c.Key()[len(value):])
+		if err != nil {
+			return nil, err
+		}
+		// 崩溃可能留下过时的索引项，回表后按列值复核
+		if found && bytes.Equal(s.key(row[s.col], nil), value) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, c.Err()
+}
+
+// scanPrimary 主键在 [lo, hi] 内的所有行
+func (tb *Table) scanPrimary(lo, hi any) ([]Row, error) {
+	from, to, err := bounds(tb.schema.Columns[tb.pk].Type, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	c := tb.primary.NewCursor()
+	for c.Seek(from); c.Valid(); c.Next() {
+		if to != nil && bytes.Compare(c.Key(), to) > 0 {
+			break
+		}
+		row, err := tb.decodeRow(c.Value())
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, c.Err()
+}
+
+// Validate 检查每棵树的不变式，并检查每一行在每个二级索引中都有对应的索引项
+func (tb *Table) Validate() error {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	if err := tb.primary.Validate(); err != nil {
+		return err
+	}
+	for _, s := range tb.indexes {
+		if err := s.tree.Validate(); err != nil {
+			return fmt.Errorf("index %q: %w", s.Name, err)
+		}
+	}
+	for key, value := range tb.primary.All() {
+		row, err := tb.decodeRow(value)
+		if err != nil {
+			return err
+		}
+		for _, s := range tb.indexes {
+			rec, err := s.tree.Search(s.key(row[s.col], key))
+			if err != nil {
+				return err
+			}
+			if rec == nil || rec.status == 1 {
+				return fmt.Errorf("%w: index %q has no entry for row %v", ErrInvariant, s.Name, row)
+			}
+		}
+	}
+	return nil
+}
+
+// write 把主键为 pk 的行从 old(为 nil 时是新行)改成 row:
+// 先检查唯一索引，再加新索引项、写主键树，最后删旧索引项
+func (tb *Table) write(pk []byte, old, row Row) error {
+	value, err := tb.encodeRow(row)
+	if err != nil {
+		return err
+	}
+	if len(value) > MAX_VALUE_SIZE {
+		return ErrValueTooLarge
+	}
+	var changed []*secondary
+	var added [][]byte
+	for _, s := range tb.indexes {
+		if old != nil && old[s.col] == row[s.col] {
+			continue
+		}
+		key := s.key(row[s.col], pk)
+		if len(key) > MAX_KEY_SIZE {
+			return fmt.Errorf("%w: index %q", ErrKeyTooLarge, s.Name)
+		}
+		if s.Unique {
+			if err := tb.checkUnique(s, row[s.col], pk); err != nil {
+				return err
+			}
+		}
+		changed = append(changed, s)
+		added = append(added, key)
+	}
+
+	for i, s := range changed {
+		if err := s.tree.Insert(added[i], nil); err != nil {
+			return err
+		}
+	}
+	if err := tb.primary.Insert(pk, value); err != nil {
+		return err
+	}
+	if old == nil {
+		return nil
+	}
+	for _, s := range changed {
+		if _, err := s.tree.Delete(s.key(old[s.col], pk)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUnique 唯一索引中已有其他行使用该列值时返回 ErrDuplicateKey
+func (tb *Table) checkUnique(s *secondary, value any, pk []byte) error {
+	prefix := s.key(value, nil)
+	c := s.tree.NewCursor()
+	for c.Seek(prefix); c.Valid() && bytes.HasPrefix(c.Key(), prefix); c.Next() {
+		other := c.Key()[len(prefix):]
+		if bytes.Equal(other, pk) {
+			continue
+		}
+		row, found, err := tb.get(other)
+		if err != nil {
+			return err
+		}
+		if found && row[s.col] == value {
+			return fmt.Errorf("%w: %s = %v", ErrDuplicateKey, s.Column, value)
+		}
+	}
+	return c.Err()
+}
+
+// get 按编码后的主键取行
+func (tb *Table) get(pk []byte) (Row, bool, error) {
+	rec, err := tb.primary.Search(pk)
+	if err != nil || rec == nil || rec.status == 1 {
+		return nil, false, err
+	}
+	row, err := tb.decodeRow(rec.value)
+	return row, err == nil, err
+}
+
+// keyRow 只填了主键列的行，用于编码主键
+func (tb *Table) keyRow(pk any) Row {
+	row := make(Row, len(tb.schema.Columns))
+	row[tb.pk] = pk
+	return row
+}
+
+// primaryKey 编码行的主键
+func (tb *Table) primaryKey(row Row) ([]byte, error) {
+	if len(row) != len(tb.schema.Columns) {
+		return nil, fmt.Errorf("%w: %d values for %d columns", ErrBadRow, len(row), len(tb.schema.Columns))
+	}
+	pk, err := appendKey(nil, tb.schema.Columns[tb.pk].Type, row[tb.pk])
+	if err == nil && len(pk) > MAX_KEY_SIZE {
+		err = ErrKeyTooLarge
+	}
+	return pk, err
+}
+
+// key 二级索引键: 列值的可比较编码 + 主键
+func (s *secondary) key(value any, pk []byte) []byte {
+	// 行已经按表结构检查过，编码不会失败
+	key, _ := appendKey(nil, s.typ, value)
+	return append(key, pk...)
+}
+
+// value 截出二级索引键中的列值部分
+func (s *secondary) value(key []byte) []byte {
+	if s.typ == IntColumn {
+		return key[:min(8, len(key))]
+	}
+	for i := 0; i+1 < len(key); i++ {
+		if key[i] == 0 {
+			if key[i+1] == 1 {
+				return key[:i+2]
+			}
+			i++
+		}
+	}
+	return key
+}
+
+// bounds 编码范围查询的两端，nil 表示无界
+func bounds(typ ColumnType, lo, hi any) (from, to []byte, err error) {
+	if lo != nil {
+		if from, err = appendKey(nil, typ, lo); err != nil {
+			return nil, nil, err
+		}
+	}
+	if hi != nil {
+		if to, err = appendKey(nil, typ, hi); err != nil {
+			return nil, nil, err
+		}
+	}
+	return from, to, nil
+}
+
+// appendKey 把列值按可比较编码追加到 dst
+func appendKey(dst []byte, typ ColumnType, v any) ([]byte, error) {
+	switch typ {
+	case IntColumn:
+		n, ok := v.(int)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v (%T) is not an int", ErrBadRow, v, v)
+		}
+		return binary.BigEndian.AppendUint64(dst, uint64(n)^(1<<63)), nil
+	case StringColumn:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v (%T) is not a string", ErrBadRow, v, v)
+		}
+		for i := 0; i < len(s); i++ {
+			dst = append(dst, s[i])
+			if s[i] == 0 {
+				dst = append(dst, 0xFF)
+			}
+		}
+		return append(dst, 0, 1), nil
+	}
+	return nil, fmt.Errorf("%w: unknown column type %v", ErrBadSchema, typ)
+}
+
+// encodeRow 按列顺序编码整行: 整数为 varint，字符串为 uvarint 长度 + 内容
+func (tb *Table) encodeRow(row Row) ([]byte, error) {
+	var buf []byte
+	for i, c := range tb.schema.Columns {
+		switch v := row[i].(type) {
+		case int:
+			if c.Type != IntColumn {
+				return nil, fmt.Errorf("%w: column %q wants %v, got int", ErrBadRow, c.Name, c.Type)
+			}
+			buf = binary.AppendVarint(buf, int64(v))
+		case string:
+			if c.Type != StringColumn {
+				return nil, fmt.Errorf("%w: column %q wants %v, got string", ErrBadRow, c.Name, c.Type)
+			}
+			buf = binary.AppendUvarint(buf, uint64(len(v)))
+			buf = append(buf, v...)
+		default:
+			return nil, fmt.Errorf("%w: column %q wants %v, got %T", ErrBadRow, c.Name, c.Type, v)
+		}
+	}
+	return buf, nil
+}
+
+// decodeRow 解码 encodeRow 编码的行
+func (tb *Table) decodeRow(buf []byte) (Row, error) {
+	row := make(Row, len(tb.schema.Columns))
+	for i, c := range tb.schema.Columns {
+		switch c.Type {
+		case IntColumn:
+			v, n := binary.Varint(buf)
+			if n <= 0 {
+				return nil, fmt.Errorf("%w: bad int in column %q", ErrCorruptPage, c.Name)
+			}
+			row[i], buf = int(v), buf[n:]
+		case StringColumn:
+			l, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < l {
+				return nil, fmt.Errorf("%w: bad string in column %q", ErrCorruptPage, c.Name)
+			}
+			row[i], buf = string(buf[n:n+int(l)]), buf[n+int(l):]
+		}
+	}
+	if len(buf) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes in row", ErrCorruptPage, len(buf))
+	}
+	return row, nil
+}
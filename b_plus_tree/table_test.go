@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var usersSchema = Schema{
+	Columns: []Column{
+		{Name: "id", Type: IntColumn},
+		{Name: "email", Type: StringColumn},
+		{Name: "city", Type: StringColumn},
+		{Name: "age", Type: IntColumn},
+	},
+	PrimaryKey: "id",
+	Indexes: []Index{
+		{Name: "by_email", Column: "email", Unique: true},
+		{Name: "by_city", Column: "city"},
+		{Name: "by_age", Column: "age"},
+	},
+}
+
+// ids 取出各行的主键
+func ids(rows []Row) []int {
+	var out []int
+	for _, row := range rows {
+		out = append(out, row[0].(int))
+	}
+	return out
+}
+
+// TestTableRandom 随机增删改，与模型对照各个索引上的等值和范围查询
+func TestTableRandom(t *testing.T) {
+	tb, err := NewTable(usersSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cities := []string{"", "berlin", "paris", "tokyo", "zürich", "a\x00b", "a"}
+	rng := rand.New(rand.NewSource(9))
+	model := make(map[int]Row)
+	for i := 0; i < 3000; i++ {
+		id := rng.Intn(300) - 100
+		row := Row{id, fmt.Sprintf("u%d@x", rng.Intn(400)), cities[rng.Intn(len(cities))], rng.Intn(60) - 10}
+		_, exists := model[id]
+		if rng.Intn(3) == 0 {
+			found, err := tb.Delete(id)
+			if err != nil || found != exists {
+				t.Fatalf("Delete(%d) = %v, %v; want %v", id, found, err, exists)
+			}
+			delete(model, id)
+			continue
+		}
+		insert := rng.Intn(2) == 0
+		if insert {
+			err = tb.Insert(row)
+		} else {
+			err = tb.Update(row)
+		}
+		taken := slices.ContainsFunc(slices.Collect(maps.Values(model)), func(r Row) bool {
+			return r[1] == row[1] && r[0] != id
+		})
+		switch {
+		case insert && exists, !insert && !exists:
+			if !errors.Is(err, ErrDuplicateKey) && !errors.Is(err, ErrRowNotFound) {
+				t.Fatalf("write of %v (exists=%v): got %v", row, exists, err)
+			}
+		case taken:
+			if !errors.Is(err, ErrDuplicateKey) {
+				t.Fatalf("write of %v: got %v, want ErrDuplicateKey", row, err)
+			}
+		case err != nil:
+			t.Fatal(err)
+		default:
+			model[id] = row
+		}
+	}
+	if err := tb.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按列 col 过滤并按 (列值, 主键) 排序的模型结果
+	want := func(col int, keep func(v any) bool) []int {
+		var rows []Row
+		for _, row := range model {
+			if keep(row[col]) {
+				rows = append(rows, row)
+			}
+		}
+		slices.SortFunc(rows, func(a, b Row) int {
+			if c := compareValues(a[col], b[col]); c != 0 {
+				return c
+			}
+			return cmp.Compare(a[0].(int), b[0].(int))
+		})
+		return ids(rows)
+	}
+	check := func(name string, got []Row, err error, want []int) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids(got), want) {
+			t.Fatalf("%s: got %v, want %v", name, ids(got), want)
+		}
+	}
+	for _, city := range cities {
+		got, err := tb.Lookup("by_city", city)
+		check("city="+city, got, err, want(2, func(v any) bool { return v == city }))
+	}
+	for lo := -12; lo < 55; lo += 7 {
+		hi := lo + rng.Intn(10)
+		got, err := tb.Range("by_age", lo, hi)
+		check(fmt.Sprintf("age in [%d,%d]", lo, hi), got, err, want(3, func(v any) bool { return v.(int) >= lo && v.(int) <= hi }))
+	}
+	got, err := tb.Range("by_city", "a", "paris")
+	check("city in [a,paris]", got, err, want(2, func(v any) bool { return v.(string) >= "a" && v.(string) <= "paris" }))
+	got, err = tb.Range("by_age", nil, 0)
+	check("age <= 0", got, err, want(3, func(v any) bool { return v.(int) <= 0 }))
+	got, err = tb.Range(PRIMARY, -5, 5)
+	check("id in [-5,5]", got, err, want(0, func(v any) bool { return v.(int) >= -5 && v.(int) <= 5 }))
+	for id, row := range model {
+		got, err := tb.Lookup("by_email", row[1])
+		check("email="+row[1].(string), got, err, []int{id})
+	}
+}
+
+func compareValues(a, b any) int {
+	if x, ok := a.(int); ok {
+		return cmp.Compare(x, b.(int))
+	}
+	return cmp.Compare(a.(string), b.(string))
+}
+
+// TestKeyEncodingOrder 可比较编码的字节序与列值顺序一致
+func TestKeyEncodingOrder(t *testing.T) {
+	for _, tc := range []struct {
+		typ    ColumnType
+		values []any
+	}{
+		{IntColumn, []any{-1 << 63, -1000, -1, 0, 1, 255, 256, 1<<63 - 1}},
+		{StringColumn, []any{"", "\x00", "\x00\x00", "\x00\x01", "\x00\xff", "a", "a\x00", "a\x00b", "ab", "b"}},
+	} {
+		s := &secondary{typ: tc.typ}
+		for i := 1; i < len(tc.values); i++ {
+			a, _ := appendKey(nil, tc.typ, tc.values[i-1])
+			b, _ := appendKey(nil, tc.typ, tc.values[i])
+			if bytes.Compare(a, b) >= 0 {
+				t.Errorf("%q encodes after %q", tc.values[i-1], tc.values[i])
+			}
+			// 拼上主键后仍能截出列值
+			if got := s.value(s.key(tc.values[i], []byte{0, 1, 2})); !bytes.Equal(got, b) {
+				t.Errorf("value of %q: got %x, want %x", tc.values[i], got, b)
+			}
+		}
+	}
+}
+
+func TestTableErrors(t *testing.T) {
+	if _, err := NewTable(Schema{Columns: []Column{{Name: "id", Type: IntColumn}}, PrimaryKey: "nope"}); !errors.Is(err, ErrBadSchema) {
+		t.Errorf("bad primary key: got %v", err)
+	}
+	tb, err := NewTable(usersSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []Row{
+		{1, "a@x"},
+		{"1", "a@x", "paris", 30},
+		{1, "a@x", "paris", "30"},
+		{1, "a@x", nil, 30},
+	} {
+		if err := tb.Insert(row); !errors.Is(err, ErrBadRow) {
+			t.Errorf("Insert(%v): got %v, want ErrBadRow", row, err)
+		}
+	}
+	if _, err := tb.Lookup("by_name", "x"); !errors.Is(err, ErrNoSuchIndex) {
+		t.Errorf("unknown index: got %v", err)
+	}
+	if err := tb.Insert(Row{1, "a@x", string(make([]byte, MAX_KEY_SIZE)), 30}); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("oversized index key: got %v", err)
+	}
+	if err := tb.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := tb.Range(PRIMARY, nil, nil); err != nil || len(rows) != 0 {
+		t.Fatalf("failed writes left rows %v (%v)", rows, err)
+	}
+}
+
+// TestTableReopen 表保存在磁盘上，重新打开时新加的索引由已有的行建好
+func TestTableReopen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "users")
+	schema := usersSchema
+	schema.Indexes = schema.Indexes[:1]
+	tb, err := OpenTable(dir, schema, WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if err := tb.Insert(Row{i, fmt.Sprintf("u%d@x", i), fmt.Sprint("c", i%7), i % 50}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if tb, err = OpenTable(dir, usersSchema); err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+	if err := tb.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := tb.Lookup("by_city", "c3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 71 || rows[0][0] != 3 || rows[1][0] != 10 {
+		t.Fatalf("city=c3: got %d rows starting %v", len(rows), ids(rows)[:2])
+	}
+	rows, err = tb.Range("by_age", 48, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 20 {
+		t.Fatalf("age >= 48: got %d rows, want 20", len(rows))
+	}
+	rows, err = tb.Lookup("by_email", "u42@x")
+	if err != nil || len(rows) != 1 || rows[0][0] != 42 {
+		t.Fatalf("email=u42@x: got %v (%v)", rows, err)
+	}
+}
+
+// TestTableStaleIndexEntry 崩溃留下的过时索引项在查询时被跳过，也不妨碍唯一性检查
+func TestTableStaleIndexEntry(t *testing.T) {
+	tb, err := NewTable(usersSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tb.Insert(Row{1, "a@x", "paris", 30}); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟改邮箱时在加了新索引项、写主键树之前崩溃
+	pk, _ := tb.primaryKey(Row{1, "b@x", "paris", 30})
+	email := tb.indexes["by_email"]
+	if err := email.tree.Insert(email.key("b@x", pk), nil); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := tb.Lookup("by_email", "b@x"); err != nil || len(rows) != 0 {
+		t.Fatalf("stale entry returned %v (%v)", rows, err)
+	}
+	if err := tb.Insert(Row{2, "b@x", "tokyo", 20}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := tb.Lookup("by_email", "b@x")
+	if err != nil || len(rows) != 1 || rows[0][0] != 2 {
+		t.Fatalf("email=b@x: got %v (%v)", rows, err)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// 多版本并发控制(MVCC):
+//
+// 树中只保存每个键最新提交的版本，Record.txID 是写入该版本的事务的提交时间戳，
+// status=1 表示该版本是删除标记。被覆盖的旧版本按时间戳从新到旧挂在内存里的版本链上，
+// 只在还有活跃快照可能读到时保留。
+//
+// 事务在 Begin 时取当前时钟作为快照，只能看到提交时间戳不大于快照的版本。
+// 未提交的修改缓存在事务里，Commit 时作为一次写操作原子地写入树和日志，Rollback 直接丢弃。
+// 写写冲突按先写者胜处理: 键已被其他活跃事务修改，或快照之后有新的提交时返回 ErrWriteConflict。
+// 非事务的 Insert/Delete 相当于只含一条语句、立即提交的事务。
+//
+// 单键写操作在叶子页的写闩锁下分配时间戳并写入，可以与其他操作并发。
+// Begin 和 Commit 独占整棵树: Begin 等正在进行的写操作结束，快照之前的时间戳都已写入树中；
+// Commit 在独占下重新检查冲突，再以一个时间戳写入全部修改。
+
+var (
+	ErrWriteConflict = errors.New("b+tree: write-write conflict")
+	ErrTxnDone       = errors.New("b+tree: transaction already committed or rolled back")
+)
+
+// version 记录的一个版本。旧版本在 [ts, end) 时间段内可见
+type version[V any] struct {
+	value   V
+	deleted bool
+	ts      int // 写入该版本的提交时间戳
+	end     int // 覆盖该版本的提交时间戳
+	prev    *version[V]
+}
+
+// tombstone 事务删除后留下的删除标记
+type tombstone[K any] struct {
+	key K
+	ts  int // 删除时间戳
+}
+
+// txnManager 事务状态，只有时钟随元数据持久化。
+// 键可能不可比较(例如 []byte)，各个表都以编码后的键为索引。mu 保护以下字段
+type txnManager[K, V any] struct {
+	mu         sync.Mutex
+	clock      int                     // 最后一次提交的时间戳
+	nextID     int                     // 下一个事务ID
+	active     map[int]*Txn[K, V]      // 活跃事务
+	locks      map[string]*Txn[K, V]   // 键 -> 修改了该键的活跃事务
+	chains     map[string]*version[V]  // 键 -> 旧版本链(从新到旧)
+	tombstones map[string]tombstone[K] // 所有快照都看不到旧版本后物理删除
+}
+
+func newTxnManager[K, V any](clock int) *txnManager[K, V] {
+	return &txnManager[K, V]{
+		clock:      clock,
+		active:     make(map[int]*Txn[K, V]),
+		locks:      make(map[string]*Txn[K, V]),
+		chains:     make(map[string]*version[V]),
+		tombstones: make(map[string]tombstone[K]),
+	}
+}
+
+// tick 分配一个提交时间戳
+func (m *txnManager[K, V]) tick() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock++
+	return m.clock
+}
+
+// now 最后分配的时间戳
+func (m *txnManager[K, V]) now() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock
+}
+
+// idle 是否没有活跃事务
+func (m *txnManager[K, V]) idle() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.active) == 0
+}
+
+// locked 键是否被活跃事务修改过
+func (m *txnManager[K, V]) locked(k string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.locks[k]
+	return ok
+}
+
+// bury 记下时间戳 ts 留下的删除标记
+func (m *txnManager[K, V]) bury(k string, key K, ts int) {
+	m.mu.Lock()
+	m.tombstones[k] = tombstone[K]{key: key, ts: ts}
+	m.mu.Unlock()
+}
+
+// unbury 删除标记被覆盖或物理删除
+func (m *txnManager[K, V]) unbury(k string) {
+	m.mu.Lock()
+	delete(m.tombstones, k)
+	m.mu.Unlock()
+}
+
+// horizon 最老的活跃快照，不晚于它的版本对所有事务可见
+func (m *txnManager[K, V]) horizon() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.clock
+	for _, tx := range m.active {
+		h = min(h, tx.snapshot)
+	}
+	return h
+}
+
+// preserve 在时间戳 end 覆盖记录前把旧版本挂到版本链上，没有活跃快照时不需要保留
+func (m *txnManager[K, V]) preserve(c *codecs[K, V], rec *Record[K, V], end int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.active) == 0 {
+		return
+	}
+	k := c.encodeKey(rec.key)
+	m.chains[k] = &version[V]{
+		value:   rec.value,
+		deleted: rec.status == 1,
+		ts:      rec.txID,
+		end:     end,
+		prev:    m.chains[k],
+	}
+}
+
+// write 事务中未提交的修改
+type write[K, V any] struct {
+	key     K
+	value   V
+	deleted bool
+}
+
+// Txn 快照隔离的事务，同一事务不能在多个goroutine中使用
+type Txn[K, V any] struct {
+	tree     *BPlusTree[K, V]
+	id       int
+	snapshot int                     // 快照时间戳
+	writes   map[string]*write[K, V] // 未提交的修改
+	done     bool
+}
+
+// Begin 开始一个事务
+func (t *BPlusTree[K, V]) Begin() *Txn[K, V] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := t.txns
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	tx := &Txn[K, V]{tree: t, id: m.nextID, snapshot: m.clock, writes: make(map[string]*write[K, V])}
+	m.active[tx.id] = tx
+	return tx
+}
+
+// ID 事务ID
+func (tx *Txn[K, V]) ID() int {
+	return tx.id
+}
+
+// Get 读取快照中(含本事务修改)的值
+func (tx *Txn[K, V]) Get(key K) (V, bool, error) {
+	var zero V
+	if tx.done {
+		return zero, false, ErrTxnDone
+	}
+	if w, ok := tx.writes[tx.tree.codec.encodeKey(key)]; ok {
+		return w.value, !w.deleted, nil
+	}
+	return tx.tree.read(key, tx.snapshot)
+}
+
+// Put 写入键值对，提交前对其他事务不可见
+func (tx *Txn[K, V]) Put(key K, value V) error {
+	if tx.done {
+		return ErrTxnDone
+	}
+	if err := tx.tree.checkSize(key, value); err != nil {
+		return err
+	}
+	k, err := tx.lock(key)
+	if err != nil {
+		return err
+	}
+	tx.writes[k] = &write[K, V]{key: key, value: value}
+	return nil
+}
+
+// Delete 删除快照中可见的键，返回键是否存在
+func (tx *Txn[K, V]) Delete(key K) (bool, error) {
+	_, found, err := tx.Get(key)
+	if err != nil || !found {
+		return false, err
+	}
+	k, err := tx.lock(key)
+	if err != nil {
+		return false, err
+	}
+	tx.writes[k] = &write[K, V]{key: key, deleted: true}
+	return true, nil
+}
+
+// Commit 以一个新的提交时间戳原子地写入所有修改。
+// 提交前修改过的页都不能被置换，大事务需要用 WithPoolSize 调大缓冲池
+func (tx *Txn[K, V]) Commit() error {
+	if tx.done {
+		return ErrTxnDone
+	}
+	t := tx.tree
+	var err error
+	if len(tx.writes) > 0 {
+		writes := slices.SortedFunc(maps.Values(tx.writes), func(a, b *write[K, V]) int {
+			return t.codec.cmp(a.key, b.key)
+		})
+		err = t.exclusive(func(o *op[K, V]) error {
+			// 加写锁之后、提交之前可能有非事务的写入
+			for _, w := range writes {
+				rec, err := o.search(w.key)
+				if err != nil {
+					return err
+				}
+				if rec != nil && rec.txID > tx.snapshot {
+					return ErrWriteConflict
+				}
+			}
+			o.stamp()
+			for _, w := range writes {
+				var err error
+				if w.deleted {
+					_, err = o.delete(w.key)
+				} else {
+					err = o.insert(w.key, w.value)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	// 写入结束后才释放写锁、不再是活跃事务: 在此之前非事务的写入报告冲突或只留下删除标记，
+	// Begin 也要等写入结束，新的快照一定包含这次提交
+	tx.finish()
+	if err != nil {
+		return err
+	}
+	_, err = t.GC()
+	return err
+}
+
+// Rollback 丢弃所有修改
+func (tx *Txn[K, V]) Rollback() error {
+	if tx.done {
+		return ErrTxnDone
+	}
+	tx.finish()
+	_, err := tx.tree.GC()
+	return err
+}
+
+// finish 结束事务: 不再是活跃快照，释放写锁
+func (tx *Txn[K, V]) finish() {
+	m := tx.tree.txns
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx.done = true
+	delete(m.active, tx.id)
+	for k := range tx.writes {
+		delete(m.locks, k)
+	}
+}
+
+// lock 取得键的写权限，返回编码后的键: 键被其他活跃事务修改过，或快照之后有新的提交时冲突
+func (tx *Txn[K, V]) lock(key K) (string, error) {
+	m := tx.tree.txns
+	k := tx.tree.codec.encodeKey(key)
+	rec, err := tx.tree.Search(key)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if owner, ok := m.locks[k]; ok {
+		if owner != tx {
+			return "", ErrWriteConflict
+		}
+		return k, nil
+	}
+	if rec != nil && rec.txID > tx.snapshot {
+		return "", ErrWriteConflict
+	}
+	m.locks[k] = tx
+	return k, nil
+}
+
+// read 返回快照 snapshot 中键的值
+func (t *BPlusTree[K, V]) read(key K, snapshot int) (V, bool, error) {
+	var zero V
+	rec, err := t.Search(key)
+	if err != nil {
+		return zero, false, err
+	}
+	if rec != nil && rec.txID <= snapshot {
+		return rec.value, rec.status == 0, nil
+	}
+	m := t.txns
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for v := m.chains[t.codec.encodeKey(key)]; v != nil; v = v.prev {
+		if v.ts <= snapshot {
+			return v.value, !v.deleted, nil
+		}
+	}
+	return zero, false, nil
+}
+
+// GC 裁剪所有活跃快照都看不到的旧版本，并物理删除这样的删除标记，返回清理的版本数。
+// 事务结束时会自动调用
+func (t *BPlusTree[K, V]) GC() (int, error) {
+	if err := t.failure(); err != nil {
+		return 0, err
+	}
+	h := t.txns.horizon()
+	expired, n := t.txns.collect(h)
+	slices.SortFunc(expired, func(a, b tombstone[K]) int {
+		return t.codec.cmp(a.key, b.key)
+	})
+	for _, ts := range expired {
+		var purged bool
+		err := t.update(func(o *op[K, V]) error {
+			var err error
+			purged, err = o.purge(ts.key, h)
+			return err
+		})
+		if err != nil {
+			return n, err
+		}
+		if purged {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// collect 裁剪时间戳 h 之前结束的旧版本，取出 h 之前留下的删除标记，返回它们和裁剪的版本数
+func (m *txnManager[K, V]) collect(h int) ([]tombstone[K], int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k, head := range m.chains {
+		// 链上的版本从新到旧，end 递减: 从第一个 end 不晚于 h 的版本起都已不可见
+		if head.end <= h {
+			n += chainLen(head)
+			delete(m.chains, k)
+			continue
+		}
+		for v := head; v.prev != nil; v = v.prev {
+			if v.prev.end <= h {
+				n += chainLen(v.prev)
+				v.prev = nil
+				break
+			}
+		}
+	}
+
+	var expired []tombstone[K]
+	for k, ts := range m.tombstones {
+		if ts.ts <= h {
+			expired = append(expired, ts)
+			delete(m.tombstones, k)
+		}
+	}
+	return expired, n
+}
+
+func chainLen[V any](v *version[V]) int {
+	n := 0
+	for ; v != nil; v = v.prev {
+		n++
+	}
+	return n
+}
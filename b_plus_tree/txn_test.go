@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func mustGet(t *testing.T, tx *Txn[int, string], key int) string {
+	t.Helper()
+	value, found, err := tx.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		return "<nil>"
+	}
+	return value
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	tree := newTestTree(t, []int{1, 2, 3})
+
+	reader := tree.Begin()
+	writer := tree.Begin()
+	if err := writer.Put(1, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Put(4, "v4"); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, writer, 1); got != "new" {
+		t.Errorf("writer reads its own write as %q", got)
+	}
+	if got := mustGet(t, reader, 1); got != "v1" {
+		t.Errorf("uncommitted write visible: %q", got)
+	}
+	if err := writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Insert(3, "plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 提交之后旧快照仍然看到开始时的数据
+	for key, want := range map[int]string{1: "v1", 2: "v2", 3: "v3", 4: "<nil>"} {
+		if got := mustGet(t, reader, key); got != want {
+			t.Errorf("old snapshot: key %d = %q, want %q", key, got, want)
+		}
+	}
+	fresh := tree.Begin()
+	for key, want := range map[int]string{1: "new", 2: "<nil>", 3: "plain", 4: "v4"} {
+		if got := mustGet(t, fresh, key); got != want {
+			t.Errorf("new snapshot: key %d = %q, want %q", key, got, want)
+		}
+	}
+
+	// 删除在旧快照结束前只留删除标记
+	if rec, _ := tree.Search(2); rec == nil || rec.status != 1 {
+		t.Errorf("key 2 should be a tombstone while snapshots are open, got %v", rec)
+	}
+	reader.Rollback()
+	fresh.Rollback()
+	if rec, _ := tree.Search(2); rec != nil {
+		t.Errorf("tombstone not collected: %v", rec)
+	}
+	if n := len(tree.txns.chains); n != 0 {
+		t.Errorf("%d version chains left after all transactions ended", n)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteConflict(t *testing.T) {
+	tree := newTestTree(t, []int{1, 2})
+
+	a := tree.Begin()
+	b := tree.Begin()
+	if err := a.Put(1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(1, "b"); !errors.Is(err, ErrWriteConflict) {
+		t.Errorf("concurrent write: %v, want ErrWriteConflict", err)
+	}
+	if _, err := b.Delete(1); !errors.Is(err, ErrWriteConflict) {
+		t.Errorf("concurrent delete: %v, want ErrWriteConflict", err)
+	}
+	if err := tree.Insert(1, "plain"); !errors.Is(err, ErrWriteConflict) {
+		t.Errorf("plain insert on a locked key: %v, want ErrWriteConflict", err)
+	}
+	if err := a.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// b 的快照早于 a 的提交，仍然冲突
+	if err := b.Put(1, "b"); !errors.Is(err, ErrWriteConflict) {
+		t.Errorf("write after newer commit: %v, want ErrWriteConflict", err)
+	}
+	if err := b.Put(2, "b"); err != nil {
+		t.Errorf("write to an untouched key: %v", err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); !errors.Is(err, ErrTxnDone) {
+		t.Errorf("second commit: %v, want ErrTxnDone", err)
+	}
+
+	c := tree.Begin()
+	if err := c.Put(1, "c"); err != nil {
+		t.Errorf("write after the conflicting transaction ended: %v", err)
+	}
+	c.Rollback()
+	if rec, _ := tree.Search(1); rec.value != "a" {
+		t.Errorf("rolled back write is visible: %q", rec.value)
+	}
+}
+
+// TestCommitRacesDelete 非事务的 Delete 与修改同一个键的事务提交并发:
+// 要么有一方报告冲突，要么删除排在提交之后、最终可见。
+// 只有一个 CPU 时很少真正并发，可以用 -race -cpu 4 多跑几次
+func TestCommitRacesDelete(t *testing.T) {
+	tree := newTestTree(t, nil)
+	for key := 0; key < 500; key++ {
+		if err := tree.Insert(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+		tx := tree.Begin()
+		if err := tx.Put(key, "tx"); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		var delErr error
+		start := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, delErr = tree.Delete(key)
+		}()
+		close(start)
+		commitErr := tx.Commit()
+		wg.Wait()
+		for _, err := range []error{commitErr, delErr} {
+			if err != nil && !errors.Is(err, ErrWriteConflict) {
+				t.Fatal(err)
+			}
+		}
+		reader := tree.Begin()
+		value, found, err := reader.Get(key)
+		reader.Rollback()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commitErr == nil && delErr == nil && found {
+			t.Fatalf("key %d: delete and commit both succeeded but the key reads %q", key, value)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGCTrimsVersions(t *testing.T) {
+	tree := newTestTree(t, []int{1})
+	old := tree.Begin()
+	var readers []*Txn[int, string]
+	for i := 0; i < 10; i++ {
+		if err := tree.Insert(1, fmt.Sprint("v", i)); err != nil {
+			t.Fatal(err)
+		}
+		readers = append(readers, tree.Begin())
+	}
+	if n := chainLen(tree.txns.chains[tree.codec.encodeKey(1)]); n != 10 {
+		t.Fatalf("chain length %d, want 10", n)
+	}
+
+	// 最老的快照结束后，只保留其余快照还能看到的版本
+	if err := old.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := chainLen(tree.txns.chains[tree.codec.encodeKey(1)]); n != 9 {
+		t.Errorf("chain length %d after the oldest snapshot ended, want 9", n)
+	}
+	for i, tx := range readers {
+		if got, want := mustGet(t, tx, 1), fmt.Sprint("v", i); got != want {
+			t.Errorf("reader %d sees %q, want %q", i, got, want)
+		}
+	}
+	for _, tx := range readers {
+		tx.Rollback()
+	}
+	if len(tree.txns.chains) != 0 {
+		t.Errorf("chains not collected")
+	}
+}
+
+// TestTxnRandom 随机交错多个事务，与按提交时间戳保存的历史快照比对
+func TestTxnRandom(t *testing.T) {
+	tree := NewBPlusTree(4)
+	rng := rand.New(rand.NewSource(7))
+	history := []map[int]string{{}} // history[ts] 为时间戳 ts 提交后的数据
+	type model struct {
+		tx     *Txn[int, string]
+		writes map[int]string // 值为空串表示删除
+	}
+	var open []*model
+
+	for step := 0; step < 5000; step++ {
+		if len(open) < 4 && rng.Intn(10) == 0 {
+			open = append(open, &model{tx: tree.Begin(), writes: make(map[int]string)})
+			continue
+		}
+		key := rng.Intn(50)
+		if len(open) == 0 || rng.Intn(8) == 0 {
+			// 非事务写
+			var err error
+			if rng.Intn(3) == 0 {
+				_, err = tree.Delete(key)
+			} else {
+				err = tree.Insert(key, fmt.Sprint("p", step))
+			}
+			if errors.Is(err, ErrWriteConflict) {
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 删除不存在的键也会消耗一个时间戳
+			for len(history) <= tree.txns.clock {
+				history = append(history, history[len(history)-1])
+			}
+			next := maps.Clone(history[len(history)-1])
+			rec, _ := tree.Search(key)
+			if rec == nil || rec.status == 1 {
+				delete(next, key)
+			} else {
+				next[key] = rec.value
+			}
+			history[len(history)-1] = next
+			continue
+		}
+
+		i := rng.Intn(len(open))
+		m := open[i]
+		snapshot := history[m.tx.snapshot]
+		switch op := rng.Intn(10); {
+		case op < 4:
+			want, ok := m.writes[key]
+			if !ok {
+				want = snapshot[key]
+			}
+			value, found, err := m.tx.Get(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found {
+				value = ""
+			}
+			if value != want {
+				t.Fatalf("step %d: tx %d (snapshot %d) key %d = %q, want %q",
+					step, m.tx.id, m.tx.snapshot, key, value, want)
+			}
+		case op < 8:
+			value := fmt.Sprint("t", step)
+			if err := m.tx.Put(key, value); err == nil {
+				m.writes[key] = value
+			} else if !errors.Is(err, ErrWriteConflict) {
+				t.Fatal(err)
+			}
+		case op < 9:
+			if found, err := m.tx.Delete(key); err == nil {
+				if found {
+					m.writes[key] = ""
+				}
+			} else if !errors.Is(err, ErrWriteConflict) {
+				t.Fatal(err)
+			}
+		default:
+			open = append(open[:i], open[i+1:]...)
+			if rng.Intn(3) == 0 {
+				if err := m.tx.Rollback(); err != nil {
+					t.Fatal(err)
+				}
+				break
+			}
+			if err := m.tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if len(m.writes) == 0 {
+				break
+			}
+			for len(history) <= tree.txns.clock {
+				history = append(history, history[len(history)-1])
+			}
+			next := maps.Clone(history[len(history)-1])
+			for k, v := range m.writes {
+				if v == "" {
+					delete(next, k)
+				} else {
+					next[k] = v
+				}
+			}
+			history[len(history)-1] = next
+		}
+	}
+
+	for _, m := range open {
+		m.tx.Rollback()
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[int]string)
+	for k, v := range tree.All() {
+		got[k] = v
+	}
+	if want := history[len(history)-1]; !maps.Equal(got, want) {
+		t.Errorf("final tree has %d keys, want %d", len(got), len(want))
+	}
+	if len(tree.txns.chains) != 0 || len(tree.txns.tombstones) != 0 {
+		t.Errorf("%d chains and %d tombstones left", len(tree.txns.chains), len(tree.txns.tombstones))
+	}
+}
+
+func TestTxnDurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithSync(false), WithPoolSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := tree.Begin()
+	for i := 0; i < 200; i++ {
+		if err := tx.Put(i, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	uncommitted := tree.Begin()
+	uncommitted.Put(500, "lost")
+	crash(tree)
+
+	tree, err = Open(path, WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if tree.txns.clock != 1 {
+		t.Errorf("clock %d after reopen, want 1", tree.txns.clock)
+	}
+	tx = tree.Begin()
+	if got := mustGet(t, tx, 199); got != "199" {
+		t.Errorf("committed write lost: %q", got)
+	}
+	if got := mustGet(t, tx, 500); got != "<nil>" {
+		t.Errorf("uncommitted write survived: %q", got)
+	}
+	// 重新打开后时钟继续递增，新快照之后的提交仍能检测出冲突
+	if err := tree.Insert(0, "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Put(0, "tx"); !errors.Is(err, ErrWriteConflict) {
+		t.Errorf("write after a newer commit: %v, want ErrWriteConflict", err)
+	}
+	tx.Rollback()
+}
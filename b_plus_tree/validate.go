@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvariant = errors.New("b+tree: invariant violated")
+
+// Validate 检查B+树的不变式:
+//   - 页内键严格递增，且落在父页分隔键划定的区间 [lo, hi) 内
+//   - 页不溢出，非根页不下溢，内部页的子页数等于键数加一
+//   - 所有叶子位于同一深度
+//   - 双向叶子链表按键序串起全部叶子
+//   - 空闲页链表与树中的页互不重叠，两者合计等于已分配页数
+func (t *BPlusTree[K, V]) Validate() error {
+	if err := t.failure(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v := &validator[K, V]{t: t, seen: make(map[int]bool), leafDepth: -1}
+	if err := v.walk(t.root, META_PAGE_ID, bound[K]{}, bound[K]{}, 0); err != nil {
+		return err
+	}
+
+	// 叶子链表
+	for i, id := range v.leaves {
+		p, err := v.fetch(id)
+		if err != nil {
+			return err
+		}
+		want := META_PAGE_ID
+		if i+1 < len(v.leaves) {
+			want = v.leaves[i+1]
+		}
+		if p.next != want {
+			return v.fail(id, "next leaf is %d, want %d", p.next, want)
+		}
+		want = META_PAGE_ID
+		if i > 0 {
+			want = v.leaves[i-1]
+		}
+		if p.prev != want {
+			return v.fail(id, "prev leaf is %d, want %d", p.prev, want)
+		}
+	}
+
+	// 空闲页链表
+	free := 0
+	for id := t.pool.freeList; id != META_PAGE_ID; free++ {
+		if v.seen[id] {
+			return v.fail(id, "free page is reachable from the tree or the free list loops")
+		}
+		v.seen[id] = true
+		p, err := v.fetch(id)
+		if err != nil {
+			return err
+		}
+		if !p.isFree {
+			return v.fail(id, "page on the free list is in use")
+		}
+		id = p.next
+	}
+	if len(v.seen) != t.pool.pageCount-1 {
+		return fmt.Errorf("%w: %d pages in tree and %d free, but %d allocated",
+			ErrInvariant, len(v.seen)-free, free, t.pool.pageCount-1)
+	}
+	return nil
+}
+
+type validator[K, V any] struct {
+	t         *BPlusTree[K, V]
+	seen      map[int]bool
+	leaves    []int
+	leafDepth int
+}
+
+// bound 子树键的区间端点，ok 为 false 时表示无界
+type bound[K any] struct {
+	key K
+	ok  bool
+}
+
+// fetch 取页后立即解除固定，校验大树时不会撑满缓冲池
+func (v *validator[K, V]) fetch(id int) (*Page[K, V], error) {
+	p, err := v.t.pool.FetchPage(id)
+	if err != nil {
+		return nil, err
+	}
+	v.t.pool.UnpinPage(p)
+	return p, nil
+}
+
+func (v *validator[K, V]) fail(id int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: page %d: %s", ErrInvariant, id, fmt.Sprintf(format, args...))
+}
+
+// walk 递归校验以 id 为根的子树，其中的键应满足 lo <= key < hi
+func (v *validator[K, V]) walk(id, parent int, lo, hi bound[K], depth int) error {
+	if v.seen[id] {
+		return v.fail(id, "reached twice")
+	}
+	v.seen[id] = true
+
+	p, err := v.fetch(id)
+	if err != nil {
+		return err
+	}
+	t := v.t
+	cmp := t.codec.cmp
+	switch {
+	case p.isFree:
+		return v.fail(id, "free page is linked into the tree")
+	case t.overflow(p):
+		return v.fail(id, "overflows with %d keys and %d bytes", len(p.keys), p.usedSpace())
+	case parent != META_PAGE_ID && t.underflow(p):
+		return v.fail(id, "underflows with %d keys and %d bytes", len(p.keys), p.usedSpace())
+	}
+	for i, k := range p.keys {
+		if (lo.ok && cmp(k, lo.key) < 0) || (hi.ok && cmp(k, hi.key) >= 0) {
+			return v.fail(id, "key %v outside [%v, %v)", k, lo.key, hi.key)
+		}
+		if i > 0 && cmp(k, p.keys[i-1]) <= 0 {
+			return v.fail(id, "key %v not greater than %v", k, p.keys[i-1])
+		}
+	}
+
+	if p.isLeaf {
+		if v.leafDepth == -1 {
+			v.leafDepth = depth
+		} else if depth != v.leafDepth {
+			return v.fail(id, "leaf at depth %d, want %d", depth, v.leafDepth)
+		}
+		if len(p.records) != len(p.keys) {
+			return v.fail(id, "%d keys but %d records", len(p.keys), len(p.records))
+		}
+		for i, rec := range p.records {
+			if rec == nil || cmp(rec.key, p.keys[i]) != 0 {
+				return v.fail(id, "record %d does not match key %v", i, p.keys[i])
+			}
+		}
+		v.leaves = append(v.leaves, id)
+		return nil
+	}
+
+	if len(p.keys) == 0 {
+		return v.fail(id, "internal page has no keys")
+	}
+	if len(p.children) != len(p.keys)+1 {
+		return v.fail(id, "%d keys but %d children", len(p.keys), len(p.children))
+	}
+	for i, child := range p.children {
+		childLo, childHi := lo, hi
+		if i > 0 {
+			childLo = bound[K]{p.keys[i-1], true}
+		}
+		if i < len(p.keys) {
+			childHi = bound[K]{p.keys[i], true}
+		}
+		if err := v.walk(child, id, childLo, childHi, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
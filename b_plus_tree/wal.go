@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// 重做日志(WAL)记录格式:
+//
+//	[0:4]   载荷长度
+//	[4:8]   CRC32(LSN+类型+载荷)
+//	[8:16]  LSN
+//	[16]    记录类型
+//	[17:]   载荷
+//
+// 一次写操作修改的所有页以整页镜像写入日志，随后是一条元数据记录和一条提交记录。
+// 恢复时只重放带提交记录的操作，崩溃时未提交的操作(例如分裂到一半)整体丢弃。
+const (
+	WAL_RECORD_HEADER   = 4 + 4 + 8 + 1
+	WAL_CHECKPOINT_SIZE = 16 << 20 // 日志超过该大小时在提交后自动做检查点
+
+	walPageImage = 1 // 载荷: 页ID(4) + 整页镜像
+	walMeta      = 2 // 载荷: 阶数(8) + 根页ID(4) + 页数(4) + 空闲页链表头(4) + 事务时钟(8)
+	walCommit    = 3 // 无载荷
+)
+
+var errBadWALRecord = errors.New("b+tree: bad wal record")
+
+// testHookCrash 测试用的崩溃注入点，正常运行时为空操作
+var testHookCrash = func(point string) {}
+
+// walRecord 解码后的日志记录
+type walRecord struct {
+	lsn    uint64
+	typ    byte
+	pageID int
+	image  []byte
+	meta   fileMeta
+}
+
+// WAL 追加写的重做日志文件。mu 保护以下字段，一次写操作的全部记录在持有 mu 时连续写入
+type WAL struct {
+	mu         sync.Mutex
+	f          *os.File
+	w          *bufio.Writer
+	nextLSN    uint64 // 下一条记录的LSN
+	flushedLSN uint64 // 已经 fsync 到磁盘的最大LSN
+	size       int64  // 日志当前大小
+	sync       bool   // 提交时是否 fsync
+	hdr        []byte
+}
+
+// openWAL 打开(或创建)日志文件
+func openWAL(path string, sync bool) (*WAL, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{
+		f:       f,
+		w:       bufio.NewWriterSize(f, 64<<10),
+		nextLSN: 1,
+		sync:    sync,
+		hdr:     make([]byte, WAL_RECORD_HEADER),
+	}, nil
+}
+
+// append 追加一条记录，返回其LSN
+func (w *WAL) append(typ byte, payload ...[]byte) (uint64, error) {
+	lsn := w.nextLSN
+	n := 0
+	for _, p := range payload {
+		n += len(p)
+	}
+
+	binary.LittleEndian.PutUint32(w.hdr[0:4], uint32(n))
+	binary.LittleEndian.PutUint64(w.hdr[8:16], lsn)
+	w.hdr[16] = typ
+	crc := crc32.ChecksumIEEE(w.hdr[8:])
+	for _, p := range payload {
+		crc = crc32.Update(crc, crc32.IEEETable, p)
+	}
+	binary.LittleEndian.PutUint32(w.hdr[4:8], crc)
+
+	if _, err := w.w.Write(w.hdr); err != nil {
+		return 0, err
+	}
+	for _, p := range payload {
+		if _, err := w.w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	w.nextLSN++
+	w.size += int64(WAL_RECORD_HEADER + n)
+	return lsn, nil
+}
+
+// appendPage 记录一页的镜像(镜像页头中的LSN必须已是本记录的LSN)
+func (w *WAL) appendPage(id int, image []byte) (uint64, error) {
+	var idBuf [4]byte
+	binary.LittleEndian.PutUint32(idBuf[:], uint32(id))
+	return w.append(walPageImage, idBuf[:], image[:PAGE_SIZE])
+}
+
+// appendMeta 记录元数据
+func (w *WAL) appendMeta(meta *fileMeta) (uint64, error) {
+	var buf [28]byte
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(meta.order))
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(meta.root))
+	binary.LittleEndian.PutUint32(buf[12:16], uint32(meta.pageCount))
+	binary.LittleEndian.PutUint32(buf[16:20], uint32(meta.freeList))
+	binary.LittleEndian.PutUint64(buf[20:28], uint64(meta.clock))
+	return w.append(walMeta, buf[:])
+}
+
+// commit 写提交记录，并按配置把日志刷到磁盘
+func (w *WAL) commit() error {
+	lsn, err := w.append(walCommit)
+	if err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	testHookCrash("wal:commit")
+	if w.sync {
+		return w.syncTo(lsn)
+	}
+	return nil
+}
+
+// flush 保证 LSN 不超过 lsn 的记录都已落盘(先写日志原则)
+func (w *WAL) flush(lsn uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.syncTo(lsn)
+}
+
+// syncTo 同 flush，调用方已持有 mu
+func (w *WAL) syncTo(lsn uint64) error {
+	if lsn <= w.flushedLSN {
+		return nil
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	w.flushedLSN = w.nextLSN - 1
+	return nil
+}
+
+// full 日志是否超过了自动做检查点的大小
+func (w *WAL) full() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size > WAL_CHECKPOINT_SIZE
+}
+
+// truncate 检查点完成后清空日志
+func (w *WAL) truncate() error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = 0
+	w.flushedLSN = w.nextLSN - 1
+	return w.f.Sync()
+}
+
+func (w *WAL) close() error {
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// readAll 从头读取所有完整且校验通过的记录，遇到残缺的尾部即停止
+func (w *WAL) readAll() ([]walRecord, error) {
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(w.f)
+	hdr := make([]byte, WAL_RECORD_HEADER)
+	var records []walRecord
+	for {
+		rec, err := readWALRecord(r, hdr)
+		if err != nil {
+			break
+		}
+		records = append(records, rec)
+	}
+	if _, err := w.f.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func readWALRecord(r io.Reader, hdr []byte) (walRecord, error) {
+	var rec walRecord
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return rec, err
+	}
+	n := int(binary.LittleEndian.Uint32(hdr[0:4]))
+	if n > 8+PAGE_SIZE {
+		return rec, errBadWALRecord
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, err
+	}
+	crc := crc32.ChecksumIEEE(hdr[8:])
+	crc = crc32.Update(crc, crc32.IEEETable, payload)
+	if crc != binary.LittleEndian.Uint32(hdr[4:8]) {
+		return rec, errBadWALRecord
+	}
+
+	rec.lsn = binary.LittleEndian.Uint64(hdr[8:16])
+	rec.typ = hdr[16]
+	switch rec.typ {
+	case walPageImage:
+		if n != 4+PAGE_SIZE {
+			return rec, errBadWALRecord
+		}
+		rec.pageID = int(binary.LittleEndian.Uint32(payload[0:4]))
+		rec.image = payload[4:]
+	case walMeta:
+		if n != 28 {
+			return rec, errBadWALRecord
+		}
+		rec.meta = fileMeta{
+			order:     int(binary.LittleEndian.Uint64(payload[0:8])),
+			root:      int(binary.LittleEndian.Uint32(payload[8:12])),
+			pageCount: int(binary.LittleEndian.Uint32(payload[12:16])),
+			freeList:  int(binary.LittleEndian.Uint32(payload[16:20])),
+			clock:     int(binary.LittleEndian.Uint64(payload[20:28])),
+		}
+	case walCommit:
+	default:
+		return rec, errBadWALRecord
+	}
+	return rec, nil
+}
+
+// recoverFromWAL 把日志中已提交的操作重放到数据文件，然后清空日志
+func recoverFromWAL(pf *PageFile, w *WAL) error {
+	records, err := w.readAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return w.truncate()
+	}
+
+	meta, err := pf.readMeta()
+	if err != nil {
+		// 元数据页本身损坏时以日志中的元数据为准
+		meta = nil
+	}
+
+	buf := make([]byte, PAGE_SIZE)
+	var pending []walRecord
+	for _, rec := range records {
+		w.nextLSN = max(w.nextLSN, rec.lsn+1)
+		if rec.typ != walCommit {
+			pending = append(pending, rec)
+			continue
+		}
+		for _, op := range pending {
+			switch op.typ {
+			case walPageImage:
+				// 页LSN不小于记录LSN说明该修改已经写入数据文件
+				if pf.pageLSN(op.pageID, buf) >= op.lsn {
+					continue
+				}
+				if err := pf.writePage(op.pageID, op.image); err != nil {
+					return err
+				}
+			case walMeta:
+				m := op.meta
+				meta = &m
+			}
+		}
+		pending = pending[:0]
+	}
+
+	if meta != nil {
+		meta.lsn = w.nextLSN - 1
+		if err := pf.writeMeta(meta); err != nil {
+			return err
+		}
+	}
+	if err := pf.sync(); err != nil {
+		return err
+	}
+	return w.truncate()
+}
+
+// commit 提交写操作: 把本次修改过的页镜像和元数据连续写入日志。
+// 乐观写操作不分配、不释放页也不改变根页，而此时可能有悲观写操作改了这些但还没提交，
+// 因此乐观写操作只在上次提交的元数据上更新时钟
+func (o *op[K, V]) commit() error {
+	t := o.t
+	var pages []*Page[K, V]
+	for _, h := range o.held {
+		if h.page.pending {
+			h.page.pending = false
+			pages = append(pages, h.page)
+		}
+	}
+	if t.wal == nil || len(pages) == 0 {
+		return nil
+	}
+	slices.SortFunc(pages, func(a, b *Page[K, V]) int { return a.id - b.id })
+	var current *fileMeta
+	if o.mode != optimisticMode {
+		current = t.meta()
+	}
+
+	t.wal.mu.Lock()
+	defer t.wal.mu.Unlock()
+	meta := t.durable
+	if current != nil {
+		meta = *current
+	}
+	for _, p := range pages {
+		// 页镜像中记录的LSN就是这条日志的LSN，恢复时据此判断是否已写入数据文件
+		p.lsn = t.wal.nextLSN
+		if err := encodePage(p, t.logBuf); err != nil {
+			return err
+		}
+		if _, err := t.wal.appendPage(p.id, t.logBuf); err != nil {
+			return err
+		}
+		testHookCrash("commit:page")
+	}
+	// 时钟在日志锁内读取，保证后提交的元数据时钟不会回退
+	meta.clock = t.txns.now()
+	if _, err := t.wal.appendMeta(&meta); err != nil {
+		return err
+	}
+	if err := t.wal.commit(); err != nil {
+		return err
+	}
+	t.durable = meta
+	return nil
+}
+
+// meta 当前树的元数据
+func (t *BPlusTree[K, V]) meta() *fileMeta {
+	pageCount, freeList := t.pool.state()
+	return &fileMeta{
+		order:     t.order,
+		root:      t.root,
+		pageCount: pageCount,
+		freeList:  freeList,
+		clock:     t.txns.now(),
+	}
+}
+
+// maybeCheckpoint 日志过大时独占整棵树做检查点
+func (t *BPlusTree[K, V]) maybeCheckpoint() error {
+	if t.wal == nil || !t.wal.full() {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.wal == nil || !t.wal.full() {
+		return nil
+	}
+	return t.checkpoint()
+}
+
+// Checkpoint 把所有脏页写回数据文件并清空日志，缩短下次打开时的恢复时间
+func (t *BPlusTree[K, V]) Checkpoint() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.checkpoint()
+}
+
+// checkpoint 同 Checkpoint，调用方已独占整棵树
+func (t *BPlusTree[K, V]) checkpoint() error {
+	if t.file == nil {
+		return nil
+	}
+	if err := t.failure(); err != nil {
+		return err
+	}
+	if err := t.pool.FlushAll(); err != nil {
+		return err
+	}
+	testHookCrash("checkpoint:flushed")
+
+	meta := t.meta()
+	meta.lsn = t.wal.nextLSN - 1
+	if err := t.file.writeMeta(meta); err != nil {
+		return err
+	}
+	if err := t.file.sync(); err != nil {
+		return err
+	}
+	t.durable = *meta
+	return t.wal.truncate()
+}
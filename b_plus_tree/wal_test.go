@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errInjectedCrash = errors.New("injected crash")
+
+// crash 模拟进程被杀: 不刷脏页、不做检查点，直接丢弃文件句柄
+func crash(tree *BPlusTree[int, string]) {
+	tree.wal.f.Close()
+	tree.file.close()
+}
+
+// injectCrash 在第 n 次经过名字以 prefix 开头的崩溃注入点时 panic
+func injectCrash(n int, prefixes ...string) (restore func()) {
+	old := testHookCrash
+	testHookCrash = func(point string) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(point, prefix) {
+				if n--; n == 0 {
+					panic(errInjectedCrash)
+				}
+				return
+			}
+		}
+	}
+	return func() { testHookCrash = old }
+}
+
+// checkTree 校验不变式并返回树中全部记录
+func checkTree(t *testing.T, tree *BPlusTree[int, string]) map[int]string {
+	t.Helper()
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[int]string)
+	first, err := tree.edgeLeaf(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := first.id; id != META_PAGE_ID; {
+		p, err := tree.pool.FetchPage(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.pool.UnpinPage(p)
+		for _, rec := range p.records {
+			got[rec.key] = rec.value
+		}
+		id = p.next
+	}
+	return got
+}
+
+func TestRecoverAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithOrder(4), WithPoolSize(8), WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]string)
+	for i := 0; i < 500; i++ {
+		key := (i * 7919) % 1000
+		want[key] = fmt.Sprint("v", i)
+		if err := tree.Insert(key, want[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	crash(tree)
+
+	tree, err = Open(path, WithPoolSize(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	got := checkTree(t, tree)
+	if len(got) != len(want) {
+		t.Fatalf("recovered %d records, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("key %d: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestCrashDuringSplit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	rng := rand.New(rand.NewSource(42))
+	want := make(map[int]string)
+	// 崩溃时正在执行的操作: 插入 inflightValue，或 inflightDelete 时删除
+	inflightKey, inflightValue, inflightDelete := -1, "", false
+	inflightOK := func(k int, v string, ok bool) bool {
+		if k != inflightKey {
+			return false
+		}
+		if inflightDelete {
+			return !ok
+		}
+		return ok && v == inflightValue
+	}
+
+	for round := 0; round < 100; round++ {
+		tree, err := Open(path, WithOrder(3), WithPoolSize(8), WithSync(false))
+		if err != nil {
+			t.Fatalf("round %d: open: %v", round, err)
+		}
+		// 崩溃时正在写的那条记录可能已提交也可能没有，其余记录必须与崩溃前一致
+		got := checkTree(t, tree)
+		for k, v := range want {
+			if gv, ok := got[k]; !(ok && gv == v) && !inflightOK(k, gv, ok) {
+				t.Fatalf("round %d: key %d: got %q, want %q", round, k, gv, v)
+			}
+		}
+		for k, v := range got {
+			if _, ok := want[k]; !ok && !inflightOK(k, v, true) {
+				t.Fatalf("round %d: unexpected key %d", round, k)
+			}
+		}
+		want = got
+
+		restore := injectCrash(1+rng.Intn(60), "splitLeafPage", "splitInternalPage",
+			"delete", "redistribute", "merge", "commit", "wal")
+		func() {
+			defer func() {
+				if r := recover(); r != errInjectedCrash {
+					panic(r)
+				}
+			}()
+			for {
+				key := rng.Intn(2000)
+				if rng.Intn(3) == 0 {
+					inflightKey, inflightDelete = key, true
+					if _, err := tree.Delete(key); err != nil {
+						t.Fatalf("round %d: delete: %v", round, err)
+					}
+					delete(want, key)
+					continue
+				}
+				value := fmt.Sprint("r", round, "k", key)
+				inflightKey, inflightValue, inflightDelete = key, value, false
+				if err := tree.Insert(key, value); err != nil {
+					t.Fatalf("round %d: insert: %v", round, err)
+				}
+				want[key] = value
+			}
+		}()
+		restore()
+		crash(tree)
+	}
+}
+
+func TestCheckpointTruncatesLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := tree.Insert(i, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, _ := os.Stat(path + ".wal"); info.Size() == 0 {
+		t.Fatal("expected log records before checkpoint")
+	}
+	if err := tree.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path + ".wal"); info.Size() != 0 {
+		t.Fatalf("log size after checkpoint = %d, want 0", info.Size())
+	}
+	lsn := tree.wal.nextLSN
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if tree.wal.nextLSN < lsn {
+		t.Errorf("LSN went backwards after reopen: %d < %d", tree.wal.nextLSN, lsn)
+	}
+	if got := checkTree(t, tree); len(got) != 100 {
+		t.Errorf("got %d records, want 100", len(got))
+	}
+}
+
+func TestTornLogTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	tree, err := Open(path, WithSync(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := tree.Insert(i, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	crash(tree)
+
+	f, err := os.OpenFile(path+".wal", os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0x10, 0, 0, 0, 0xde, 0xad})
+	f.Close()
+
+	tree, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if got := checkTree(t, tree); len(got) != 20 {
+		t.Errorf("got %d records, want 20", len(got))
+	}
+}
@@ -0,0 +1,61 @@
+package lru_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cg917658910/go-study/lib/lru"
+	"github.com/gin-gonic/gin"
+)
+
+func ExampleCache() {
+	c := lru.New[string, int](2)
+	c.OnEvict(func(key string, value int, reason lru.EvictReason) {
+		fmt.Println(reason, key, value)
+	})
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Get("a")
+	c.Add("c", 3)
+	fmt.Println(c.Keys())
+	_, ok := c.Get("b")
+	fmt.Println(ok, c.Stats().HitRate())
+	// Output:
+	// evicted b 2
+	// [c a]
+	// false 0.5
+}
+
+// 在 gin 的 handler 之间共用一个 SyncCache 缓存查询结果
+func ExampleSyncCache_gin() {
+	gin.SetMode(gin.TestMode)
+	users := lru.NewSync[string, string](1000, lru.WithTTL(time.Minute), lru.WithCleanupInterval(time.Minute))
+	defer users.Close()
+
+	loads := 0
+	r := gin.New()
+	r.GET("/users/:id", func(ctx *gin.Context) {
+		id := ctx.Param("id")
+		name, ok := users.Get(id)
+		if !ok {
+			loads++ // 代替查询数据库
+			name = "user-" + id
+			users.Add(id, name)
+		}
+		ctx.String(http.StatusOK, name)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/1"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		fmt.Println(w.Body.String())
+	}
+	fmt.Printf("loads %d, %+v\n", loads, users.Stats())
+	// Output:
+	// user-1
+	// user-2
+	// user-1
+	// loads 2, {Hits:1 Misses:2 Evictions:0 Expirations:0}
+}
@@ -0,0 +1,341 @@
+// Package lru 按最近最少使用淘汰的缓存，支持按条目设置过期时间和淘汰回调。
+// Cache 不能并发使用，多个 goroutine(如 gin 的 handler)共用时用 SyncCache
+package lru
+
+import (
+	"container/heap"
+	"time"
+)
+
+// EvictReason 条目离开缓存的原因
+type EvictReason int
+
+const (
+	Evicted EvictReason = iota // 超出容量，淘汰最久没用的
+	Expired                    // 过期
+	Removed                    // 调用 Remove 或 Purge
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case Evicted:
+		return "evicted"
+	case Expired:
+		return "expired"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// Stats 命中统计
+type Stats struct {
+	Hits        uint64
+	Misses      uint64 // 包括查到已过期的条目
+	Evictions   uint64 // 因容量淘汰的条目数
+	Expirations uint64 // 过期清理的条目数
+}
+
+// HitRate 命中率，没有查询时为 0
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type options struct {
+	ttl      time.Duration
+	interval time.Duration
+}
+
+// Option 配置 New 和 NewSync 创建的缓存
+type Option func(o *options)
+
+// WithTTL 设置 Add 写入的条目的过期时间，默认不过期
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithCleanupInterval 设置 SyncCache 在后台清理过期条目的间隔，默认只在访问时清理。
+// Cache 没有后台 goroutine，需要自己调用 RemoveExpired
+func WithCleanupInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// entry 缓存条目，同时是最近使用链表的节点和过期堆的元素
+type entry[K comparable, V any] struct {
+	key        K
+	value      V
+	expires    time.Time // 零值表示不过期
+	prev, next *entry[K, V]
+	index      int // 在过期堆中的下标，不在堆中时为 -1
+}
+
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// expiryHeap 按过期时间排序的最小堆，只包含有过期时间的条目
+type expiryHeap[K comparable, V any] []*entry[K, V]
+
+func (h expiryHeap[K, V]) Len() int           { return len(h) }
+func (h expiryHeap[K, V]) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap[K, V]) Push(x any) {
+	e := x.(*entry[K, V])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap[K, V]) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	e.index = -1
+	return e
+}
+
+// eviction 一次待通知的淘汰
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// Cache LRU 缓存。容量不大于 0 时不限制条目数，只按过期时间清理
+type Cache[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+	items    map[K]*entry[K, V]
+	root     entry[K, V] // 链表哨兵: root.next 是最近用的，root.prev 是最久没用的
+	expiry   expiryHeap[K, V]
+	stats    Stats
+	onEvict  []func(key K, value V, reason EvictReason)
+	now      func() time.Time
+
+	// deferred 时淘汰先记在 pending 里，由 SyncCache 解锁后再通知，回调中可以再访问缓存
+	deferred bool
+	pending  []eviction[K, V]
+}
+
+// New 创建容量为 capacity 的缓存
+func New[K comparable, V any](capacity int, opts ...Option) *Cache[K, V] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return newCache[K, V](capacity, o)
+}
+
+func newCache[K comparable, V any](capacity int, o options) *Cache[K, V] {
+	c := &Cache[K, V]{
+		capacity: capacity,
+		ttl:      o.ttl,
+		items:    make(map[K]*entry[K, V]),
+		now:      time.Now,
+	}
+	c.root.prev, c.root.next = &c.root, &c.root
+	return c
+}
+
+// OnEvict 注册条目离开缓存时的回调，按注册顺序调用。Add 覆盖已有的键不算离开。
+// Cache 在操作中途同步调用回调，回调中不能再修改同一个 Cache
+func (c *Cache[K, V]) OnEvict(fn func(key K, value V, reason EvictReason)) {
+	c.onEvict = append(c.onEvict, fn)
+}
+
+func (c *Cache[K, V]) unlink(e *entry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+}
+
+func (c *Cache[K, V]) pushFront(e *entry[K, V]) {
+	e.prev, e.next = &c.root, c.root.next
+	c.root.next.prev = e
+	c.root.next = e
+}
+
+func (c *Cache[K, V]) moveToFront(e *entry[K, V]) {
+	if c.root.next != e {
+		c.unlink(e)
+		c.pushFront(e)
+	}
+}
+
+// setExpiry 设置条目的过期时间并维护过期堆，ttl 不大于 0 表示不过期
+func (c *Cache[K, V]) setExpiry(e *entry[K, V], ttl time.Duration) {
+	if ttl <= 0 {
+		e.expires = time.Time{}
+		if e.index >= 0 {
+			heap.Remove(&c.expiry, e.index)
+		}
+		return
+	}
+	e.expires = c.now().Add(ttl)
+	if e.index >= 0 {
+		heap.Fix(&c.expiry, e.index)
+	} else {
+		heap.Push(&c.expiry, e)
+	}
+}
+
+// remove 删除条目并通知回调
+func (c *Cache[K, V]) remove(e *entry[K, V], reason EvictReason) {
+	c.unlink(e)
+	if e.index >= 0 {
+		heap.Remove(&c.expiry, e.index)
+	}
+	delete(c.items, e.key)
+	switch reason {
+	case Evicted:
+		c.stats.Evictions++
+	case Expired:
+		c.stats.Expirations++
+	}
+	if c.deferred {
+		c.pending = append(c.pending, eviction[K, V]{e.key, e.value, reason})
+		return
+	}
+	for _, fn := range c.onEvict {
+		fn(e.key, e.value, reason)
+	}
+}
+
+// Add 用默认的过期时间写入，返回是否因此淘汰了最久没用的条目
+func (c *Cache[K, V]) Add(key K, value V) bool {
+	return c.AddWithTTL(key, value, c.ttl)
+}
+
+// AddWithTTL 写入并设置过期时间，ttl 不大于 0 表示不过期，返回是否因此淘汰了最久没用的条目
+func (c *Cache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) bool {
+	if e, ok := c.items[key]; ok {
+		e.value = value
+		c.setExpiry(e, ttl)
+		c.moveToFront(e)
+		return false
+	}
+	e := &entry[K, V]{key: key, value: value, index: -1}
+	c.items[key] = e
+	c.pushFront(e)
+	c.setExpiry(e, ttl)
+	return c.shrink() > 0
+}
+
+// shrink 条目超出容量时先清理过期的，再淘汰最久没用的，返回淘汰的个数
+func (c *Cache[K, V]) shrink() int {
+	if c.capacity <= 0 || len(c.items) <= c.capacity {
+		return 0
+	}
+	c.RemoveExpired()
+	n := 0
+	for len(c.items) > c.capacity {
+		c.remove(c.root.prev, Evicted)
+		n++
+	}
+	return n
+}
+
+// Get 查找并标记为最近使用，过期的条目在这里删除
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	e, ok := c.items[key]
+	if ok && e.expired(c.now()) {
+		c.remove(e, Expired)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	c.stats.Hits++
+	c.moveToFront(e)
+	return e.value, true
+}
+
+// Peek 查找但不改变最近使用的顺序，也不计入命中统计
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	if e, ok := c.items[key]; ok && !e.expired(c.now()) {
+		return e.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Remove 删除 key，返回是否存在
+func (c *Cache[K, V]) Remove(key K) bool {
+	e, ok := c.items[key]
+	if ok {
+		c.remove(e, Removed)
+	}
+	return ok
+}
+
+// RemoveExpired 删除所有已过期的条目，返回删除的个数
+func (c *Cache[K, V]) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for len(c.expiry) > 0 && c.expiry[0].expired(now) {
+		c.remove(c.expiry[0], Expired)
+		n++
+	}
+	return n
+}
+
+// Purge 删除所有条目
+func (c *Cache[K, V]) Purge() {
+	for c.root.prev != &c.root {
+		c.remove(c.root.prev, Removed)
+	}
+}
+
+// Resize 修改容量，返回因此淘汰的条目数
+func (c *Cache[K, V]) Resize(capacity int) int {
+	c.capacity = capacity
+	return c.shrink()
+}
+
+// Len 条目数，包括已过期但还没有清理的
+func (c *Cache[K, V]) Len() int {
+	return len(c.items)
+}
+
+// Cap 容量
+func (c *Cache[K, V]) Cap() int {
+	return c.capacity
+}
+
+// Keys 没有过期的键，最近使用的在前
+func (c *Cache[K, V]) Keys() []K {
+	now := c.now()
+	keys := make([]K, 0, len(c.items))
+	for e := c.root.next; e != &c.root; e = e.next {
+		if !e.expired(now) {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
+
+// Stats 命中统计
+func (c *Cache[K, V]) Stats() Stats {
+	return c.stats
+}
+
+// takePending 取出待通知的淘汰和当前的回调
+func (c *Cache[K, V]) takePending() ([]eviction[K, V], []func(K, V, EvictReason)) {
+	pending := c.pending
+	c.pending = nil
+	return pending, c.onEvict
+}
@@ -0,0 +1,325 @@
+package lru
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动拨动的时钟
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func newClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// recorder 记录淘汰回调
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(key string, value int, reason EvictReason) {
+	r.mu.Lock()
+	r.events = append(r.events, fmt.Sprintf("%s=%d %v", key, value, reason))
+	r.mu.Unlock()
+}
+
+func (r *recorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := New[string, int](2)
+	var rec recorder
+	c.OnEvict(rec.record)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v", v, ok)
+	}
+	if !c.Add("c", 3) {
+		t.Fatal("Add(c) did not evict")
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b not evicted")
+	}
+	if got := rec.take(); !slices.Equal(got, []string{"b=2 evicted"}) {
+		t.Fatalf("events %q", got)
+	}
+	// 覆盖已有的键不淘汰也不回调
+	if c.Add("a", 10) || len(rec.take()) != 0 {
+		t.Fatal("overwriting a evicted something")
+	}
+	if got := c.Keys(); !slices.Equal(got, []string{"a", "c"}) {
+		t.Fatalf("Keys() = %q", got)
+	}
+	// Peek 不改变顺序
+	if v, ok := c.Peek("c"); !ok || v != 3 {
+		t.Fatalf("Peek(c) = %d, %v", v, ok)
+	}
+	c.Add("d", 4)
+	if got := c.Keys(); !slices.Equal(got, []string{"d", "a"}) {
+		t.Fatalf("Keys() after Peek = %q", got)
+	}
+	if !c.Remove("a") || c.Remove("a") {
+		t.Fatal("Remove(a) twice")
+	}
+	c.Purge()
+	if c.Len() != 0 {
+		t.Fatalf("Len() = %d after Purge", c.Len())
+	}
+	if got := rec.take(); !slices.Equal(got, []string{"c=3 evicted", "a=10 removed", "d=4 removed"}) {
+		t.Fatalf("events %q", got)
+	}
+	want := Stats{Hits: 1, Misses: 1, Evictions: 2}
+	if got := c.Stats(); got != want || got.HitRate() != 0.5 {
+		t.Fatalf("Stats() = %+v", got)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	clock := newClock()
+	c := New[string, int](0, WithTTL(time.Minute))
+	c.now = clock.now
+	var rec recorder
+	c.OnEvict(rec.record)
+	c.Add("a", 1)
+	c.AddWithTTL("b", 2, 2*time.Minute)
+	c.AddWithTTL("forever", 3, 0)
+	clock.advance(time.Minute)
+
+	// 过期后 Peek 和 Keys 看不到，但要等访问或清理时才删除
+	if _, ok := c.Peek("a"); ok {
+		t.Fatal("Peek(a) found an expired entry")
+	}
+	if got := c.Keys(); !slices.Equal(got, []string{"forever", "b"}) || c.Len() != 3 {
+		t.Fatalf("Keys() = %q, Len() = %d", got, c.Len())
+	}
+	if _, ok := c.Get("a"); ok || c.Len() != 2 {
+		t.Fatal("Get(a) did not expire it")
+	}
+	// 重新写入会刷新过期时间
+	c.AddWithTTL("b", 20, 2*time.Minute)
+	clock.advance(time.Minute + time.Second)
+	if v, ok := c.Get("b"); !ok || v != 20 {
+		t.Fatalf("Get(b) = %d, %v after refresh", v, ok)
+	}
+	clock.advance(time.Hour)
+	if n := c.RemoveExpired(); n != 1 || c.Len() != 1 {
+		t.Fatalf("RemoveExpired() = %d, Len() = %d", n, c.Len())
+	}
+	if got := rec.take(); !slices.Equal(got, []string{"a=1 expired", "b=20 expired"}) {
+		t.Fatalf("events %q", got)
+	}
+	if got := c.Stats(); got.Expirations != 2 || got.Misses != 1 || got.Hits != 1 {
+		t.Fatalf("Stats() = %+v", got)
+	}
+}
+
+// TestCacheFullPrefersExpired 超出容量时先清理过期的条目，而不是淘汰没过期的
+func TestCacheFullPrefersExpired(t *testing.T) {
+	clock := newClock()
+	c := New[string, int](2)
+	c.now = clock.now
+	c.Add("old", 1)
+	c.AddWithTTL("short", 2, time.Second)
+	clock.advance(time.Second)
+	if c.Add("new", 3) {
+		t.Fatal("Add(new) evicted a live entry")
+	}
+	if got := c.Keys(); !slices.Equal(got, []string{"new", "old"}) {
+		t.Fatalf("Keys() = %q", got)
+	}
+}
+
+func TestCacheResize(t *testing.T) {
+	c := New[int, int](5)
+	var evicted []int
+	c.OnEvict(func(key, _ int, reason EvictReason) { evicted = append(evicted, key) })
+	for i := range 5 {
+		c.Add(i, i)
+	}
+	c.Get(0)
+	if n := c.Resize(2); n != 3 || !slices.Equal(evicted, []int{1, 2, 3}) {
+		t.Fatalf("Resize(2) = %d, evicted %v", n, evicted)
+	}
+	if got := c.Keys(); !slices.Equal(got, []int{0, 4}) || c.Cap() != 2 {
+		t.Fatalf("Keys() = %v, Cap() = %d", got, c.Cap())
+	}
+	if n := c.Resize(10); n != 0 || c.Len() != 2 {
+		t.Fatalf("Resize(10) = %d", n)
+	}
+}
+
+// TestCacheRandom 随机操作，与按最近使用排序的切片对照
+func TestCacheRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	clock := newClock()
+	c := New[int, int](8)
+	c.now = clock.now
+	type item struct {
+		key, value int
+		expires    time.Time
+	}
+	var model []item // 最近使用的在前
+	find := func(key int) int {
+		return slices.IndexFunc(model, func(it item) bool { return it.key == key })
+	}
+	dropExpired := func() {
+		now := clock.now()
+		model = slices.DeleteFunc(model, func(it item) bool { return !it.expires.IsZero() && !now.Before(it.expires) })
+	}
+	for i := 0; i < 5000; i++ {
+		key := rng.Intn(16)
+		switch rng.Intn(6) {
+		case 0, 1:
+			ttl := time.Duration(rng.Intn(3)) * time.Second
+			c.AddWithTTL(key, i, ttl)
+			it := item{key: key, value: i}
+			if ttl > 0 {
+				it.expires = clock.now().Add(ttl)
+			}
+			if j := find(key); j >= 0 {
+				model = slices.Delete(model, j, j+1)
+			}
+			model = slices.Insert(model, 0, it)
+			if len(model) > 8 {
+				dropExpired()
+				if len(model) > 8 {
+					model = model[:8]
+				}
+			}
+		case 2, 3:
+			v, ok := c.Get(key)
+			j := find(key)
+			if j >= 0 && !model[j].expires.IsZero() && !clock.now().Before(model[j].expires) {
+				model = slices.Delete(model, j, j+1)
+				j = -1
+			}
+			if ok != (j >= 0) || ok && v != model[j].value {
+				t.Fatalf("step %d: Get(%d) = %d, %v", i, key, v, ok)
+			}
+			if ok {
+				it := model[j]
+				model = slices.Insert(slices.Delete(model, j, j+1), 0, it)
+			}
+		case 4:
+			if c.Remove(key) != (find(key) >= 0) {
+				t.Fatalf("step %d: Remove(%d)", i, key)
+			}
+			if j := find(key); j >= 0 {
+				model = slices.Delete(model, j, j+1)
+			}
+		case 5:
+			clock.advance(500 * time.Millisecond)
+		}
+		if c.Len() != len(model) {
+			t.Fatalf("step %d: Len() = %d, want %d", i, c.Len(), len(model))
+		}
+		var keys []int
+		now := clock.now()
+		for _, it := range model {
+			if it.expires.IsZero() || now.Before(it.expires) {
+				keys = append(keys, it.key)
+			}
+		}
+		if got := c.Keys(); !slices.Equal(got, keys) {
+			t.Fatalf("step %d: Keys() = %v, want %v", i, got, keys)
+		}
+	}
+}
+
+// TestSyncCacheConcurrent 多个 goroutine 同时读写，回调中再访问缓存不会死锁
+func TestSyncCacheConcurrent(t *testing.T) {
+	s := NewSync[int, int](64, WithTTL(time.Millisecond), WithCleanupInterval(time.Millisecond))
+	defer s.Close()
+	var evictions sync.Map
+	s.OnEvict(func(key, value int, reason EvictReason) {
+		s.Peek(key)
+		evictions.Store(key, reason)
+	})
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 2000; i++ {
+				key := rng.Intn(128)
+				switch rng.Intn(4) {
+				case 0:
+					s.Add(key, i)
+				case 1:
+					s.Get(key)
+				case 2:
+					s.Keys()
+				case 3:
+					if i%100 == 0 {
+						s.Resize(32 + rng.Intn(64))
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s.Len() > s.Cap() {
+		t.Fatalf("Len() %d > Cap() %d", s.Len(), s.Cap())
+	}
+	st := s.Stats()
+	if st.Hits+st.Misses == 0 {
+		t.Fatal("no lookups counted")
+	}
+}
+
+// TestSyncCacheBackground 后台清理在没有访问时也删除过期条目
+func TestSyncCacheBackground(t *testing.T) {
+	clock := newClock()
+	s := NewSync[string, int](0, WithCleanupInterval(time.Millisecond))
+	s.c.now = clock.now
+	expired := make(chan string, 1)
+	s.OnEvict(func(key string, _ int, reason EvictReason) {
+		if reason == Expired {
+			expired <- key
+		}
+	})
+	s.AddWithTTL("a", 1, time.Second)
+	clock.advance(time.Second)
+	select {
+	case key := <-expired:
+		if key != "a" || s.Len() != 0 {
+			t.Fatalf("expired %q, Len() = %d", key, s.Len())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("background cleanup did not run")
+	}
+	s.Close()
+	s.Close()
+	// 停止后台清理后缓存仍然可用
+	s.Add("b", 2)
+	if v, ok := s.Get("b"); !ok || v != 2 {
+		t.Fatalf("Get(b) = %d, %v after Close", v, ok)
+	}
+}
@@ -0,0 +1,159 @@
+package lru
+
+import (
+	"sync"
+	"time"
+)
+
+// SyncCache 用互斥锁保护的 Cache，可以被多个 goroutine 同时使用。
+// 淘汰回调在解锁之后调用，回调中可以再访问同一个缓存
+type SyncCache[K comparable, V any] struct {
+	mu   sync.Mutex
+	c    *Cache[K, V]
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewSync 创建容量为 capacity 的并发安全缓存。给出 WithCleanupInterval 时在后台定期清理过期条目，
+// 不再使用时要调用 Close 停止
+func NewSync[K comparable, V any](capacity int, opts ...Option) *SyncCache[K, V] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &SyncCache[K, V]{c: newCache[K, V](capacity, o)}
+	s.c.deferred = true
+	if o.interval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.cleanup(o.interval)
+	}
+	return s
+}
+
+func (s *SyncCache[K, V]) cleanup(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.RemoveExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close 停止后台清理并等待它退出，可以重复调用。缓存本身仍然可用
+func (s *SyncCache[K, V]) Close() {
+	s.once.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+			<-s.done
+		}
+	})
+}
+
+// unlock 解锁后通知加锁期间发生的淘汰
+func (s *SyncCache[K, V]) unlock() {
+	pending, callbacks := s.c.takePending()
+	s.mu.Unlock()
+	for _, ev := range pending {
+		for _, fn := range callbacks {
+			fn(ev.key, ev.value, ev.reason)
+		}
+	}
+}
+
+// OnEvict 见 Cache.OnEvict
+func (s *SyncCache[K, V]) OnEvict(fn func(key K, value V, reason EvictReason)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c.OnEvict(fn)
+}
+
+// Add 见 Cache.Add
+func (s *SyncCache[K, V]) Add(key K, value V) bool {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.c.Add(key, value)
+}
+
+// AddWithTTL 见 Cache.AddWithTTL
+func (s *SyncCache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.c.AddWithTTL(key, value, ttl)
+}
+
+// Get 见 Cache.Get
+func (s *SyncCache[K, V]) Get(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.c.Get(key)
+}
+
+// Peek 见 Cache.Peek
+func (s *SyncCache[K, V]) Peek(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Peek(key)
+}
+
+// Remove 见 Cache.Remove
+func (s *SyncCache[K, V]) Remove(key K) bool {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.c.Remove(key)
+}
+
+// RemoveExpired 见 Cache.RemoveExpired
+func (s *SyncCache[K, V]) RemoveExpired() int {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.c.RemoveExpired()
+}
+
+// Purge 见 Cache.Purge
+func (s *SyncCache[K, V]) Purge() {
+	s.mu.Lock()
+	defer s.unlock()
+	s.c.Purge()
+}
+
+// Resize 见 Cache.Resize
+func (s *SyncCache[K, V]) Resize(capacity int) int {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.c.Resize(capacity)
+}
+
+// Len 见 Cache.Len
+func (s *SyncCache[K, V]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Len()
+}
+
+// Cap 见 Cache.Cap
+func (s *SyncCache[K, V]) Cap() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Cap()
+}
+
+// Keys 见 Cache.Keys
+func (s *SyncCache[K, V]) Keys() []K {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Keys()
+}
+
+// Stats 见 Cache.Stats
+func (s *SyncCache[K, V]) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Stats()
+}
@@ -0,0 +1,296 @@
+// Package repl 数据结构命令行工具共用的命令解释器。
+//
+// 命令按行读取，参数用 Split 切分。交互时打印标题和提示符；
+// 用 -f 执行脚本文件或从管道读取时只输出命令的结果，出错的命令记下行号后继续执行。
+// --quiet 省略写操作的确认信息，--json 每条命令输出一行JSON
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnknownCommand = errors.New("未知命令")
+	ErrUsage          = errors.New("用法")
+	ErrFailed         = errors.New("有命令执行失败")
+)
+
+// Command 一条命令
+type Command struct {
+	Name  string
+	Usage string // 参数说明，如 "<key> <value>"
+	Help  string
+	Args  int // 至少需要的参数个数
+	Run   func(c *Context, args []string) error
+}
+
+// Context 一次命令执行的输出
+type Context struct {
+	w         io.Writer
+	quiet     bool
+	result    any
+	hasResult bool
+}
+
+// Printf 输出命令的结果
+func (c *Context) Printf(format string, a ...any) {
+	fmt.Fprintf(c.w, format, a...)
+}
+
+// Println 输出命令的结果
+func (c *Context) Println(a ...any) {
+	fmt.Fprintln(c.w, a...)
+}
+
+// Infof 输出确认等提示信息，安静模式下省略
+func (c *Context) Infof(format string, a ...any) {
+	if !c.quiet {
+		fmt.Fprintf(c.w, format, a...)
+	}
+}
+
+// Writer 命令结果的输出目标，供打印树结构等直接写入
+func (c *Context) Writer() io.Writer {
+	return c.w
+}
+
+// Result 设置JSON模式下的结构化结果，设置后不再输出文本
+func (c *Context) Result(v any) {
+	c.result, c.hasResult = v, true
+}
+
+// record JSON模式下一条命令的输出
+type record struct {
+	Line    int      `json:"line,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	OK      bool     `json:"ok"`
+	Result  any      `json:"result,omitempty"`
+	Output  string   `json:"output,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Interpreter 命令解释器
+type Interpreter struct {
+	Title       string        // 交互时启动打印的标题
+	Prompt      func() string // 交互时的提示符，为 nil 时是 "> "
+	Out         io.Writer     // 为 nil 时是标准输出
+	Quiet       bool          // 省略提示信息
+	JSON        bool          // 每条命令输出一行JSON
+	Echo        bool          // 执行前回显命令，脚本的输出更容易对照
+	Interactive bool          // 打印标题和提示符，错误不带行号
+
+	script   string
+	commands []*Command
+	byName   map[string]*Command
+	name     string // 正在读取的输入的名字，出错时与行号一起输出
+	line     int
+	failed   int
+	exited   bool
+}
+
+// New 创建解释器。help 和 exit(quit) 是内置命令
+func New(title string, commands ...Command) *Interpreter {
+	in := &Interpreter{Title: title, byName: make(map[string]*Command)}
+	for i := range commands {
+		in.add(&commands[i])
+	}
+	in.add(&Command{Name: "help", Help: "列出命令", Run: func(c *Context, _ []string) error {
+		in.help(c.w)
+		return nil
+	}})
+	exit := &Command{Name: "exit", Help: "退出", Run: func(c *Context, _ []string) error {
+		c.Infof("退出...\n")
+		in.exited = true
+		return nil
+	}}
+	in.add(exit)
+	in.byName["quit"] = exit
+	return in
+}
+
+func (in *Interpreter) add(cmd *Command) {
+	if _, ok := in.byName[cmd.Name]; ok {
+		panic("repl: duplicate command " + cmd.Name)
+	}
+	in.commands = append(in.commands, cmd)
+	in.byName[cmd.Name] = cmd
+}
+
+// Flags 在 fs 上注册 -f、-quiet 和 -json 选项
+func (in *Interpreter) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&in.script, "f", "", "执行脚本文件中的命令后退出，- 表示标准输入")
+	fs.BoolVar(&in.Quiet, "quiet", in.Quiet, "不输出标题、提示符和确认信息")
+	fs.BoolVar(&in.JSON, "json", in.JSON, "每条命令输出一行JSON")
+}
+
+// Main 在解析完命令行选项后调用: 有 -f 时执行脚本，否则读标准输入，
+// 标准输入是终端时进入交互模式
+func (in *Interpreter) Main() error {
+	r := io.Reader(os.Stdin)
+	name := "stdin"
+	if in.script != "" && in.script != "-" {
+		f, err := os.Open(in.script)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, name = f, in.script
+	}
+	if in.script == "" {
+		if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			in.Interactive = !in.JSON
+		}
+	}
+	if in.Interactive && !in.Quiet {
+		in.printf("%s\n", in.Title)
+		in.help(in.out())
+	}
+	return in.Run(name, r)
+}
+
+// Run 逐行执行 r 中的命令，直到读完或执行 exit。
+// 读取出错时返回该错误；非交互模式下有命令失败时返回 ErrFailed
+func (in *Interpreter) Run(name string, r io.Reader) error {
+	in.name, in.line, in.failed, in.exited = name, 0, 0, false
+	br := bufio.NewReader(r)
+	for !in.exited {
+		if in.Interactive && !in.Quiet {
+			in.printf("%s", in.prompt())
+		}
+		line, err := br.ReadString('\n')
+		if line != "" {
+			in.line++
+			in.Exec(line)
+		}
+		if err == io.EOF {
+			if in.Interactive && !in.Quiet && line == "" {
+				in.printf("\n")
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if in.failed > 0 && !in.Interactive {
+		return fmt.Errorf("%s: %w (%d 条)", name, ErrFailed, in.failed)
+	}
+	return nil
+}
+
+// Exec 执行一行命令，返回命令是否成功。空行和注释什么也不做
+func (in *Interpreter) Exec(line string) bool {
+	line = strings.TrimRight(line, "\r\n")
+	args, err := Split(line)
+	if err == nil && len(args) == 0 {
+		return true
+	}
+	if in.Echo && !in.JSON {
+		in.printf("%s%s\n", in.prompt(), line)
+	}
+
+	var buf bytes.Buffer
+	c := &Context{w: in.out(), quiet: in.Quiet}
+	if in.JSON {
+		c.w = &buf
+	}
+	if err == nil {
+		err = in.call(c, args)
+	}
+	if err != nil {
+		in.failed++
+	}
+
+	if in.JSON {
+		rec := record{Command: "", Args: []string{}, OK: err == nil}
+		if len(args) > 0 {
+			rec.Command, rec.Args = args[0], args[1:]
+		}
+		if !in.Interactive {
+			rec.Line = in.line
+		}
+		if c.hasResult {
+			rec.Result = c.result
+		} else {
+			rec.Output = buf.String()
+		}
+		if err != nil {
+			rec.Error = err.Error()
+		}
+		var data bytes.Buffer
+		enc := json.NewEncoder(&data)
+		enc.SetEscapeHTML(false)
+		if merr := enc.Encode(rec); merr != nil {
+			data.Reset()
+			enc.Encode(record{Line: rec.Line, Command: rec.Command, Args: rec.Args, Error: merr.Error()})
+		}
+		in.out().Write(data.Bytes())
+		return err == nil
+	}
+	if err != nil {
+		if in.Interactive {
+			in.printf("%v\n", err)
+		} else {
+			in.printf("%s:%d: %v\n", in.name, in.line, err)
+		}
+	}
+	return err == nil
+}
+
+// call 查找并执行命令
+func (in *Interpreter) call(c *Context, args []string) error {
+	cmd, ok := in.byName[args[0]]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+	}
+	if len(args)-1 < cmd.Args {
+		return fmt.Errorf("%w: %s", ErrUsage, cmd.synopsis())
+	}
+	return cmd.Run(c, args[1:])
+}
+
+func (cmd *Command) synopsis() string {
+	if cmd.Usage == "" {
+		return cmd.Name
+	}
+	return cmd.Name + " " + cmd.Usage
+}
+
+// help 按注册顺序列出命令，说明对齐
+func (in *Interpreter) help(w io.Writer) {
+	width := 0
+	for _, cmd := range in.commands {
+		width = max(width, len(cmd.synopsis()))
+	}
+	fmt.Fprintln(w, "命令:")
+	for _, cmd := range in.commands {
+		fmt.Fprintf(w, "  %-*s - %s\n", width, cmd.synopsis(), cmd.Help)
+	}
+}
+
+func (in *Interpreter) prompt() string {
+	if in.Prompt != nil {
+		return in.Prompt()
+	}
+	return "> "
+}
+
+func (in *Interpreter) out() io.Writer {
+	if in.Out != nil {
+		return in.Out
+	}
+	return os.Stdout
+}
+
+func (in *Interpreter) printf(format string, a ...any) {
+	fmt.Fprintf(in.out(), format, a...)
+}
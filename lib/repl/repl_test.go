@@ -0,0 +1,148 @@
+package repl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   \t ", nil},
+		{"insert 1 a", []string{"insert", "1", "a"}},
+		{"  insert\t1   a  ", []string{"insert", "1", "a"}},
+		{`insert 1 "hello world"`, []string{"insert", "1", "hello world"}},
+		{`insert 1 'a "b" \c'`, []string{"insert", "1", `a "b" \c`}},
+		{`insert "" x`, []string{"insert", "", "x"}},
+		{`a"b c"d`, []string{"ab cd"}},
+		{`"a\"b\\c\nd\te\x"`, []string{"a\"b\\c\nd\te\\x"}},
+		{`a\ b \"`, []string{"a b", `"`}},
+		{"search 中文 键", []string{"search", "中文", "键"}},
+		{"# comment", nil},
+		{"print # trailing", []string{"print"}},
+		{"a#b", []string{"a#b"}},
+		{`"#"`, []string{"#"}},
+	} {
+		got, err := Split(tc.line)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("Split(%q) = %q, %v; want %q", tc.line, got, err, tc.want)
+		}
+	}
+	for _, line := range []string{`"abc`, `'abc`, `a "b\"`} {
+		if _, err := Split(line); !errors.Is(err, ErrUnterminatedQuote) {
+			t.Errorf("Split(%q): got %v, want ErrUnterminatedQuote", line, err)
+		}
+	}
+}
+
+// newEcho 带有 echo 和 set 两条命令的解释器
+func newEcho(out io.Writer) *Interpreter {
+	var last string
+	in := New("test",
+		Command{Name: "echo", Usage: "<arg>...", Help: "输出参数", Run: func(c *Context, args []string) error {
+			c.Println(strings.Join(args, "|"))
+			return nil
+		}},
+		Command{Name: "set", Usage: "<value>", Help: "设置值", Args: 1, Run: func(c *Context, args []string) error {
+			if args[0] == "bad" {
+				return errors.New("无效值")
+			}
+			last = args[0]
+			c.Infof("已设置 %s\n", last)
+			c.Result(map[string]string{"value": last})
+			return nil
+		}},
+	)
+	in.Out = out
+	return in
+}
+
+func TestRunScript(t *testing.T) {
+	var out bytes.Buffer
+	in := newEcho(&out)
+	// 最后一行没有换行符
+	script := "echo a  'b c'\r\n\n# comment\nset\nfoo\nset bad\nset x\necho \"unterminated\nexit\necho after\n"
+	err := in.Run("s.txt", strings.NewReader(script))
+	if !errors.Is(err, ErrFailed) {
+		t.Fatalf("Run: got %v, want ErrFailed", err)
+	}
+	want := `a|b c
+s.txt:4: 用法: set <value>
+s.txt:5: 未知命令: foo
+s.txt:6: 无效值
+已设置 x
+s.txt:8: 引号不匹配
+退出...
+`
+	if out.String() != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	in.Quiet = true
+	if err := in.Run("s.txt", strings.NewReader("set y\necho done")); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "done\n" {
+		t.Fatalf("quiet output %q", out.String())
+	}
+}
+
+// TestRunEOF 输入读完或读取出错时 Run 返回，不会空转
+func TestRunEOF(t *testing.T) {
+	var out bytes.Buffer
+	in := newEcho(&out)
+	in.Interactive = true
+	if err := in.Run("stdin", strings.NewReader("echo 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "> 1\n> \n" {
+		t.Fatalf("interactive output %q", out.String())
+	}
+
+	readErr := errors.New("device gone")
+	r := io.MultiReader(strings.NewReader("echo 1\n"), iotest.ErrReader(readErr))
+	if err := in.Run("stdin", r); !errors.Is(err, readErr) {
+		t.Fatalf("Run: got %v, want %v", err, readErr)
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	var out bytes.Buffer
+	in := newEcho(&out)
+	in.JSON = true
+	in.Run("s.txt", strings.NewReader("echo a b\nset x\nset bad\nnope 1\n"))
+
+	var recs []record
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var rec record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 4 {
+		t.Fatalf("got %d records:\n%s", len(recs), out.String())
+	}
+	if r := recs[0]; r.Line != 1 || r.Command != "echo" || !slices.Equal(r.Args, []string{"a", "b"}) || !r.OK || r.Output != "a|b\n" {
+		t.Errorf("echo: %+v", r)
+	}
+	if r := recs[1]; !r.OK || r.Output != "" || r.Result.(map[string]any)["value"] != "x" {
+		t.Errorf("set: %+v", r)
+	}
+	if r := recs[2]; r.OK || r.Error != "无效值" {
+		t.Errorf("set bad: %+v", r)
+	}
+	if r := recs[3]; r.OK || r.Line != 4 || !strings.Contains(r.Error, "未知命令") {
+		t.Errorf("unknown: %+v", r)
+	}
+}
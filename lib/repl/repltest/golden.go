@@ -0,0 +1,99 @@
+// Package repltest 用命令脚本测试基于 repl 的命令行工具。
+//
+// testdata 下每个 *.txt 是一个脚本，执行输出与同名的 *.golden 文件对照，
+// go test -update 重新生成 *.golden。脚本开头形如 "# flags: --json --quiet" 的注释行
+// 设置解释器选项；文本模式下回显每条命令
+package repltest
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cg917658910/go-study/lib/repl"
+)
+
+var update = flag.Bool("update", false, "重新生成 testdata 下的 *.golden 文件")
+
+// Golden 对 dir 下的每个脚本用 newInterpreter 创建的新解释器执行并对照输出
+func Golden(t *testing.T, dir string, newInterpreter func(t *testing.T) *repl.Interpreter) {
+	t.Helper()
+	scripts, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatalf("no scripts in %s", dir)
+	}
+	for _, script := range scripts {
+		name := strings.TrimSuffix(filepath.Base(script), ".txt")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Run(t, newInterpreter(t), filepath.Base(script), src)
+
+			golden := strings.TrimSuffix(script, ".txt") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s:\n%s", golden, diff(string(want), string(got)))
+			}
+		})
+	}
+}
+
+// Run 按脚本开头的选项执行脚本，返回全部输出。有命令失败不算测试失败
+func Run(t *testing.T, in *repl.Interpreter, name string, src []byte) []byte {
+	t.Helper()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	in.Flags(fs)
+	for _, line := range strings.Split(string(src), "\n") {
+		if opts, ok := strings.CutPrefix(line, "# flags:"); ok {
+			if err := fs.Parse(strings.Fields(opts)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var out bytes.Buffer
+	in.Out = &out
+	in.Echo = true
+	in.Interactive = false
+	if err := in.Run(name, bytes.NewReader(src)); err != nil && !errors.Is(err, repl.ErrFailed) {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// diff 逐行对照，标出第一处不同以及前后几行
+func diff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	i := 0
+	for i < len(w) && i < len(g) && w[i] == g[i] {
+		i++
+	}
+	var b strings.Builder
+	for j := max(i-3, 0); j < i; j++ {
+		b.WriteString("  " + w[j] + "\n")
+	}
+	for j := i; j < min(i+5, len(w)); j++ {
+		b.WriteString("- " + w[j] + "\n")
+	}
+	for j := i; j < min(i+5, len(g)); j++ {
+		b.WriteString("+ " + g[j] + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package repl
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrUnterminatedQuote = errors.New("引号不匹配")
+
+// Split 把一行命令切分成参数: 以任意空白分隔，连续空白视为一个分隔符。
+// 双引号内可以用 \" \\ \n \t 转义，单引号内的内容原样保留，
+// 引号外的反斜杠转义下一个字符。引号可以与其他字符相连，"" 是一个空参数。
+// 参数开头的 # 注释掉该行剩余部分
+func Split(line string) ([]string, error) {
+	var (
+		args  []string
+		cur   strings.Builder
+		inArg bool // cur 中有参数，即使是空字符串
+	)
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case r == '#' && !inArg:
+			return args, nil
+		case r == '\\':
+			inArg = true
+			if i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			}
+		case r == '\'':
+			inArg = true
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, ErrUnterminatedQuote
+			}
+			cur.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inArg = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						cur.WriteByte('\n')
+					case 't':
+						cur.WriteByte('\t')
+					case '"', '\\':
+						cur.WriteRune(runes[i])
+					default:
+						cur.WriteByte('\\')
+						cur.WriteRune(runes[i])
+					}
+					continue
+				}
+				cur.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, ErrUnterminatedQuote
+			}
+		default:
+			inArg = true
+			cur.WriteRune(r)
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import "bytes"
+
+// nodeKind 子节点的存储布局，参照ART(自适应基数树)按子节点数在四种大小之间切换
+type nodeKind uint8
+
+const (
+	node4   nodeKind = iota // 至多4个: 有序首字节数组，逐个比较
+	node16                  // 至多16个: 有序首字节数组
+	node48                  // 至多48个: 256项的首字节索引指向48个槽
+	node256                 // 以首字节为下标的256项数组
+)
+
+// 各布局的容量，以及子节点减少到多少时换成小一级的布局。
+// 收缩阈值低于小一级的容量，避免在边界上反复增删时来回转换
+var (
+	kindCap    = [...]int{node4: 4, node16: 16, node48: 48, node256: 256}
+	kindShrink = [...]int{node16: 3, node48: 12, node256: 36}
+)
+
+// children 以前缀首字节索引的子节点。同一节点的子节点前缀首字节互不相同，
+// 零值是空的 node4
+type children struct {
+	kind  nodeKind
+	n     int
+	keys  []byte       // node4、node16: 有序的首字节
+	nodes []*RadixNode // node4、node16: 与 keys 一一对应；node48: 槽；node256: 以首字节为下标
+	index *[256]uint8  // node48: 首字节对应的槽位加一，0 表示没有
+}
+
+// len 子节点数
+func (c *children) len() int {
+	return c.n
+}
+
+// get 返回前缀以 b 开头的子节点，没有时返回 nil
+func (c *children) get(b byte) *RadixNode {
+	switch c.kind {
+	case node4, node16:
+		if i := bytes.IndexByte(c.keys, b); i >= 0 {
+			return c.nodes[i]
+		}
+		return nil
+	case node48:
+		if slot := c.index[b]; slot != 0 {
+			return c.nodes[slot-1]
+		}
+		return nil
+	default:
+		return c.nodes[b]
+	}
+}
+
+// set 放入前缀以 b 开头的子节点，已有时替换
+func (c *children) set(b byte, child *RadixNode) {
+	switch c.kind {
+	case node4, node16:
+		i := 0
+		for i < len(c.keys) && c.keys[i] < b {
+			i++
+		}
+		if i < len(c.keys) && c.keys[i] == b {
+			c.nodes[i] = child
+			return
+		}
+		if c.n == kindCap[c.kind] {
+			c.grow()
+			c.set(b, child)
+			return
+		}
+		if c.keys == nil {
+			c.keys = make([]byte, 0, kindCap[c.kind])
+			c.nodes = make([]*RadixNode, 0, kindCap[c.kind])
+		}
+		c.keys = append(c.keys, 0)
+		copy(c.keys[i+1:], c.keys[i:])
+		c.keys[i] = b
+		c.nodes = append(c.nodes, nil)
+		copy(c.nodes[i+1:], c.nodes[i:])
+		c.nodes[i] = child
+	case node48:
+		if slot := c.index[b]; slot != 0 {
+			c.nodes[slot-1] = child
+			return
+		}
+		if c.n == kindCap[node48] {
+			c.grow()
+			c.set(b, child)
+			return
+		}
+		// 删除会在槽中留下空位，找第一个空槽
+		slot := 0
+		for c.nodes[slot] != nil {
+			slot++
+		}
+		c.nodes[slot] = child
+		c.index[b] = uint8(slot + 1)
+	default:
+		exists := c.nodes[b] != nil
+		c.nodes[b] = child
+		if exists {
+			return
+		}
+	}
+	c.n++
+}
+
+// remove 删除前缀以 b 开头的子节点
+func (c *children) remove(b byte) {
+	switch c.kind {
+	case node4, node16:
+		i := bytes.IndexByte(c.keys, b)
+		if i < 0 {
+			return
+		}
+		c.keys = append(c.keys[:i], c.keys[i+1:]...)
+		copy(c.nodes[i:], c.nodes[i+1:])
+		c.nodes[len(c.nodes)-1] = nil
+		c.nodes = c.nodes[:len(c.nodes)-1]
+	case node48:
+		slot := c.index[b]
+		if slot == 0 {
+			return
+		}
+		c.nodes[slot-1] = nil
+		c.index[b] = 0
+	default:
+		if c.nodes[b] == nil {
+			return
+		}
+		c.nodes[b] = nil
+	}
+	c.n--
+	if c.kind != node4 && c.n <= kindShrink[c.kind] {
+		c.shrink()
+	}
+}
+
+// each 按首字节升序对每个子节点调用 fn，fn 返回 false 时停止并返回 false
+func (c *children) each(fn func(child *RadixNode) bool) bool {
+	switch c.kind {
+	case node4, node16:
+		for _, child := range c.nodes {
+			if !fn(child) {
+				return false
+			}
+		}
+	case node48:
+		for _, slot := range c.index {
+			if slot != 0 && !fn(c.nodes[slot-1]) {
+				return false
+			}
+		}
+	default:
+		for _, child := range c.nodes {
+			if child != nil && !fn(child) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// grow 换成大一级的布局
+func (c *children) grow() {
+	c.rebuild(c.kind + 1)
+}
+
+// shrink 换成小一级的布局
+func (c *children) shrink() {
+	c.rebuild(c.kind - 1)
+}
+
+// rebuild 把子节点按顺序搬到 kind 布局中
+func (c *children) rebuild(kind nodeKind) {
+	old := *c
+	*c = children{kind: kind}
+	switch kind {
+	case node4, node16:
+		c.keys = make([]byte, 0, kindCap[kind])
+		c.nodes = make([]*RadixNode, 0, kindCap[kind])
+	case node48:
+		c.index = new([256]uint8)
+		c.nodes = make([]*RadixNode, kindCap[node48])
+	default:
+		c.nodes = make([]*RadixNode, kindCap[node256])
+	}
+	old.each(func(child *RadixNode) bool {
+		c.set(child.prefix[0], child)
+		return true
+	})
+}
+
+// clone 复制子节点表，子节点本身仍然共享
+func (c *children) clone() children {
+	d := children{kind: c.kind, n: c.n}
+	if c.keys != nil {
+		d.keys = append(make([]byte, 0, cap(c.keys)), c.keys...)
+	}
+	if c.nodes != nil {
+		d.nodes = append(make([]*RadixNode, 0, cap(c.nodes)), c.nodes...)
+	}
+	if c.index != nil {
+		index := *c.index
+		d.index = &index
+	}
+	return d
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestChildrenLayouts 随机增删子节点，与 map 对照，并检查布局随子节点数增长和收缩
+func TestChildrenLayouts(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var c children
+	model := make(map[byte]*RadixNode)
+	seen := make(map[nodeKind]bool)
+	for i := 0; i < 20000; i++ {
+		b := byte(rng.Intn(256))
+		// 前一半偏向插入，子节点数涨到256；后一半偏向删除，降回空节点
+		insert := rng.Intn(10) < 7
+		if i >= 10000 {
+			insert = !insert
+		}
+		if insert {
+			child := &RadixNode{prefix: string([]byte{b, 'x'})}
+			c.set(b, child)
+			model[b] = child
+		} else {
+			c.remove(b)
+			delete(model, b)
+		}
+		seen[c.kind] = true
+
+		if c.len() != len(model) {
+			t.Fatalf("step %d: len %d, want %d", i, c.len(), len(model))
+		}
+		if c.len() > kindCap[c.kind] || c.kind > node4 && c.len() <= kindShrink[c.kind] {
+			t.Fatalf("step %d: %d children in layout %d", i, c.len(), c.kind)
+		}
+		if got := c.get(b); got != model[b] {
+			t.Fatalf("step %d: get(%d) = %v, want %v", i, b, got, model[b])
+		}
+		if i%97 == 0 {
+			last := -1
+			c.each(func(child *RadixNode) bool {
+				k := child.prefix[0]
+				if int(k) <= last || model[k] != child {
+					t.Fatalf("step %d: child %d out of order or stale", i, k)
+				}
+				last = int(k)
+				return true
+			})
+		}
+	}
+	for _, kind := range []nodeKind{node4, node16, node48, node256} {
+		if !seen[kind] {
+			t.Errorf("layout %d never used", kind)
+		}
+	}
+}
+
+// TestRadixWideFanout 同一节点下有上百个子节点时的增删查
+func TestRadixWideFanout(t *testing.T) {
+	rt := NewRadixTree()
+	for b := 255; b >= 0; b-- {
+		rt.Insert(string([]byte{'k', byte(b)}), fmt.Sprint(b))
+	}
+	checkTree(t, rt)
+	if kind := rt.root.children.get('k').children.kind; kind != node256 {
+		t.Fatalf("fan-out node has layout %d, want node256", kind)
+	}
+	keys := collect(rt, "k")
+	if len(keys) != 256 || keys[0] != "k\x00" || keys[255] != "k\xff" {
+		t.Fatalf("WalkPrefix(k) returned %d keys", len(keys))
+	}
+	for b := 0; b < 255; b++ {
+		if !rt.Delete(string([]byte{'k', byte(b)})) {
+			t.Fatalf("Delete(k%d) = false", b)
+		}
+		if b%16 == 0 {
+			checkTree(t, rt)
+		}
+	}
+	checkTree(t, rt)
+	if v, ok := rt.Search("k\xff"); !ok || v != "255" {
+		t.Fatalf("Search(k\\xff) = %q, %v", v, ok)
+	}
+}
+
+// mapNode 改用首字节索引之前的布局: 子节点放在以前缀为键的 map 中，查找时逐个比较。
+// 只用于基准测试对照
+type mapNode struct {
+	prefix   string
+	children map[string]*mapNode
+	isEnd    bool
+	value    string
+}
+
+func (n *mapNode) findChild(key string) (string, *mapNode) {
+	for prefix, child := range n.children {
+		if prefix[0] == key[0] {
+			return prefix, child
+		}
+	}
+	return "", nil
+}
+
+func (n *mapNode) insert(key, value string) {
+	node := n
+	for len(key) > 0 {
+		match, child := node.findChild(key)
+		if child == nil {
+			node.children[key] = &mapNode{prefix: key, children: map[string]*mapNode{}, isEnd: true, value: value}
+			return
+		}
+		common := 0
+		for common < len(key) && common < len(child.prefix) && key[common] == child.prefix[common] {
+			common++
+		}
+		if common < len(child.prefix) {
+			rest := &mapNode{prefix: child.prefix[common:], children: child.children, isEnd: child.isEnd, value: child.value}
+			child.prefix = child.prefix[:common]
+			child.children = map[string]*mapNode{rest.prefix: rest}
+			child.isEnd, child.value = false, ""
+			delete(node.children, match)
+			node.children[child.prefix] = child
+		}
+		key = key[common:]
+		node = child
+	}
+	node.isEnd, node.value = true, value
+}
+
+func (n *mapNode) search(key string) (string, bool) {
+	node := n
+	for len(key) > 0 {
+		_, child := node.findChild(key)
+		if child == nil || !strings.HasPrefix(key, child.prefix) {
+			return "", false
+		}
+		key = key[len(child.prefix):]
+		node = child
+	}
+	return node.value, node.isEnd
+}
+
+// dictionary 生成n个词: 一半是全新的随机词，一半沿用已有词的一段前缀再接随机后缀，
+// 使树既有宽的分叉又有长的公共前缀
+func dictionary(n int) []string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_/."
+	rng := rand.New(rand.NewSource(42))
+	suffix := func(b *strings.Builder) {
+		for l := 2 + rng.Intn(10); l > 0; l-- {
+			b.WriteByte(alphabet[rng.Intn(len(alphabet))])
+		}
+	}
+	words := make([]string, 0, n)
+	for len(words) < n {
+		var b strings.Builder
+		if len(words) > 0 && rng.Intn(2) == 0 {
+			w := words[rng.Intn(len(words))]
+			b.WriteString(w[:1+rng.Intn(len(w))])
+		}
+		suffix(&b)
+		words = append(words, b.String())
+	}
+	return words
+}
+
+var benchWords = sync.OnceValue(func() []string { return dictionary(200000) })
+
+func BenchmarkInsert(b *testing.B) {
+	words := benchWords()
+	b.Run("bytes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rt := NewRadixTree()
+			for _, w := range words {
+				rt.Insert(w, w)
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			root := &mapNode{children: map[string]*mapNode{}}
+			for _, w := range words {
+				root.insert(w, w)
+			}
+		}
+	})
+}
+
+func BenchmarkSearch(b *testing.B) {
+	words := benchWords()
+	rt := NewRadixTree()
+	root := &mapNode{children: map[string]*mapNode{}}
+	for _, w := range words {
+		rt.Insert(w, w)
+		root.insert(w, w)
+	}
+	b.Run("bytes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, ok := rt.Search(words[i%len(words)]); !ok {
+				b.Fatal("missing word")
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, ok := root.search(words[i%len(words)]); !ok {
+				b.Fatal("missing word")
+			}
+		}
+	})
+}
+
+func BenchmarkWalkPrefix(b *testing.B) {
+	words := benchWords()
+	rt := NewRadixTree()
+	for _, w := range words {
+		rt.Insert(w, w)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		rt.WalkPrefix(words[i%len(words)][:1], func(string, string) bool {
+			n++
+			return true
+		})
+	}
+}
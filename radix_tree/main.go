@@ -1,33 +1,43 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync/atomic"
+
+	"github.com/cg917658910/go-study/lib/repl"
 )
 
-// RadixNode 表示Radix树的节点
+// RadixNode 表示Radix树的节点。
+// 节点可能被多个版本的树共享，只有 gen 与写入方的代号相同的节点才能原地修改，其余的先复制
 type RadixNode struct {
-	prefix   string                // 节点存储的前缀
-	children map[string]*RadixNode // 子节点
-	isEnd    bool                  // 是否单词结束
-	value    string                // 存储的值
+	prefix   string   // 节点存储的前缀
+	children children // 按前缀首字节索引的子节点
+	isEnd    bool     // 是否单词结束
+	value    string   // 存储的值
+
+	gen   uint64                  // 创建节点的写入方的代号
+	watch atomic.Pointer[watcher] // 节点被替换或修改时关闭的通道，按需创建
 }
 
 // NewRadixNode 创建新的Radix节点
 func NewRadixNode(prefix string) *RadixNode {
 	return &RadixNode{
-		prefix:   prefix,
-		children: make(map[string]*RadixNode),
-		isEnd:    false,
-		value:    "",
+		prefix: prefix,
+		isEnd:  false,
+		value:  "",
 	}
 }
 
-// RadixTree 表示Radix树结构
+// RadixTree 表示Radix树结构。
+// Insert、Delete 直接修改树，需要外部同步；Txn 提交得到的新树与旧树共享未修改的节点，
+// 旧树不受影响，读者可以不加锁地继续使用
 type RadixTree struct {
 	root *RadixNode
+	gen  atomic.Uint64 // 直接修改时使用的代号，为 0 表示节点可能与其他版本共享，下次修改时分配新代号
 }
 
 // NewRadixTree 创建新的Radix树
@@ -35,207 +45,120 @@ func NewRadixTree() *RadixTree {
 	return &RadixTree{root: NewRadixNode("")}
 }
 
-// Insert 插入单词和值
+// Insert 插入键值，键已存在时更新值
 func (rt *RadixTree) Insert(key, value string) {
-	node := rt.root
-	for {
-		// 查找与当前key有共同前缀的子节点
-		_, child := rt.findChild(node, key)
-		if child == nil {
-			// 没有共同前缀的子节点，直接添加新节点
-			newNode := NewRadixNode(key)
-			newNode.isEnd = true
-			newNode.value = value
-			node.children[key] = newNode
-			return
-		}
-
-		commonPrefix := rt.longestCommonPrefix(key, child.prefix)
-		if commonPrefix == len(child.prefix) {
-			// 完全匹配当前子节点的前缀
-			key = key[commonPrefix:]
-			node = child
-			if len(key) == 0 {
-				// 完全匹配，更新值
-				child.isEnd = true
-				child.value = value
-				return
-			}
-		} else {
-			// 部分匹配，需要分裂节点
-			rt.splitNode(child, commonPrefix)
-			key = key[commonPrefix:]
-			node = child
-			if len(key) == 0 {
-				// 分裂后正好匹配
-				child.isEnd = true
-				child.value = value
-				return
-			}
-			// 添加剩余部分的新节点
-			newNode := NewRadixNode(key)
-			newNode.isEnd = true
-			newNode.value = value
-			child.children[key] = newNode
-			return
-		}
-	}
+	txn := rt.writer()
+	txn.Insert(key, value)
+	rt.apply(txn)
 }
 
-// findChild 查找与key有共同前缀的子节点
-func (rt *RadixTree) findChild(node *RadixNode, key string) (string, *RadixNode) {
-	for prefix, child := range node.children {
-		if commonLen := rt.longestCommonPrefix(key, prefix); commonLen > 0 {
-			return prefix, child
-		}
-	}
-	return "", nil
+// findChild 查找与非空的 key 有共同前缀的子节点，即前缀首字节相同的子节点
+func (rt *RadixTree) findChild(node *RadixNode, key string) *RadixNode {
+	return node.children.get(key[0])
 }
 
 // longestCommonPrefix 计算两个字符串的最长公共前缀长度
-func (rt *RadixTree) longestCommonPrefix(a, b string) int {
+func longestCommonPrefix(a, b string) int {
 	i := 0
 	for ; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
 	}
 	return i
 }
 
-// splitNode 分裂节点
-func (rt *RadixTree) splitNode(node *RadixNode, splitPos int) {
-	// 创建新节点保存分裂后的部分
-	newChild := NewRadixNode(node.prefix[splitPos:])
-	newChild.children = node.children
-	newChild.isEnd = node.isEnd
-	newChild.value = node.value
-
-	// 更新当前节点
-	node.prefix = node.prefix[:splitPos]
-	node.children = make(map[string]*RadixNode)
-	node.children[newChild.prefix] = newChild
-	node.isEnd = false
-	node.value = ""
-}
-
 // Search 精确查找单词
 func (rt *RadixTree) Search(key string) (string, bool) {
-	node := rt.root
-	for len(key) > 0 {
-		match, child := rt.findChild(node, key)
-		if child == nil {
-			return "", false
-		}
+	return search(rt.root, key)
+}
 
-		commonPrefix := rt.longestCommonPrefix(key, match)
-		if commonPrefix != len(match) {
+// search 在以 node 为根的树中精确查找
+func search(node *RadixNode, key string) (string, bool) {
+	for len(key) > 0 {
+		child := node.children.get(key[0])
+		if child == nil || !strings.HasPrefix(key, child.prefix) {
 			return "", false
 		}
-
-		key = key[commonPrefix:]
+		key = key[len(child.prefix):]
 		node = child
 	}
 	return node.value, node.isEnd
 }
 
-// StartsWith 查找前缀匹配的所有单词
+// StartsWith 查找前缀匹配的所有单词，按键排序
 func (rt *RadixTree) StartsWith(prefix string) []string {
-	node := rt.root
-	remaining := prefix
-	for len(remaining) > 0 {
-		match, child := rt.findChild(node, remaining)
-		if child == nil {
-			return nil
-		}
-
-		commonPrefix := rt.longestCommonPrefix(remaining, match)
-		if commonPrefix < len(match) {
-			if strings.HasPrefix(match, remaining) {
-				// 当前节点前缀以剩余前缀开头，收集所有子节点
-				var results []string
-				rt.collectWords(child, remaining, &results)
-				return results
-			}
-			return nil
-		}
-
-		remaining = remaining[commonPrefix:]
-		node = child
-	}
-
-	// 完全匹配前缀，收集所有子节点
 	var results []string
-	rt.collectWords(node, prefix[:len(prefix)-len(remaining)], &results)
+	rt.WalkPrefix(prefix, func(key, value string) bool {
+		results = append(results, key+" -> "+value)
+		return true
+	})
 	return results
 }
 
-// collectWords 递归收集单词
-func (rt *RadixTree) collectWords(node *RadixNode, prefix string, results *[]string) {
-	if node.isEnd {
-		*results = append(*results, prefix+node.prefix+" -> "+node.value)
-	}
-
-	for _, child := range node.children {
-		rt.collectWords(child, prefix+node.prefix, results)
-	}
-}
-
-// Delete 删除单词
-func (rt *RadixTree) Delete(key string) bool {
-	path := []*RadixNode{rt.root}
-	pathKeys := []string{""}
+// WalkPrefix 按键的字典序对以 prefix 开头的每个键值调用 fn，fn 返回 false 时停止
+func (rt *RadixTree) WalkPrefix(prefix string, fn func(key, value string) bool) {
 	node := rt.root
-
-	// 查找要删除的节点路径
-	for len(key) > 0 {
-		match, child := rt.findChild(node, key)
-		if child == nil {
-			return false
-		}
-
-		commonPrefix := rt.longestCommonPrefix(key, match)
-		if commonPrefix != len(match) {
-			return false
+	key := ""
+	for remaining := prefix; len(remaining) > 0; {
+		child := rt.findChild(node, remaining)
+		switch {
+		case child == nil:
+			return
+		case strings.HasPrefix(remaining, child.prefix):
+			remaining = remaining[len(child.prefix):]
+		case strings.HasPrefix(child.prefix, remaining):
+			// 前缀在子节点中间结束，子节点下的键都以它开头
+			remaining = ""
+		default:
+			return
 		}
-
-		path = append(path, child)
-		pathKeys = append(pathKeys, match)
-		key = key[commonPrefix:]
+		key += child.prefix
 		node = child
 	}
+	rt.walk(node, key, fn)
+}
 
-	if !node.isEnd {
+// walk 先序遍历以 node 为根的子树，key 是 node 对应的完整键。
+// 同一节点的子节点首字节互不相同，按首字节升序即按键排序
+func (rt *RadixTree) walk(node *RadixNode, key string, fn func(key, value string) bool) bool {
+	if node.isEnd && !fn(key, node.value) {
 		return false
 	}
+	return node.children.each(func(child *RadixNode) bool {
+		return rt.walk(child, key+child.prefix, fn)
+	})
+}
 
-	// 标记为非结束节点
-	node.isEnd = false
-	node.value = ""
-
-	// 向上合并无用节点
-	for i := len(path) - 1; i > 0; i-- {
-		node = path[i]
-		parent := path[i-1]
-
-		if len(node.children) == 0 && !node.isEnd {
-			delete(parent.children, pathKeys[i])
-		} else if len(node.children) == 1 && !node.isEnd {
-			// 合并单一子节点
-			var child *RadixNode
-			for _, v := range node.children {
-				child = v
-			}
-			mergedPrefix := node.prefix + child.prefix
-			mergedNode := NewRadixNode(mergedPrefix)
-			mergedNode.children = child.children
-			mergedNode.isEnd = child.isEnd
-			mergedNode.value = child.value
-			parent.children[mergedPrefix] = mergedNode
-			delete(parent.children, node.prefix)
-		} else {
+// LongestPrefix 查找是 key 的前缀的最长的已存键，返回该键和值
+func (rt *RadixTree) LongestPrefix(key string) (string, string, bool) {
+	node := rt.root
+	var best *RadixNode
+	bestLen := 0
+	if node.isEnd {
+		best = node
+	}
+	for matched := 0; matched < len(key); {
+		child := rt.findChild(node, key[matched:])
+		if child == nil || !strings.HasPrefix(key[matched:], child.prefix) {
 			break
 		}
+		matched += len(child.prefix)
+		node = child
+		if node.isEnd {
+			best, bestLen = node, matched
+		}
 	}
+	if best == nil {
+		return "", "", false
+	}
+	return key[:bestLen], best.value, true
+}
 
-	return true
+// Delete 删除单词。删除后没有子节点的节点被移除，
+// 不存值且只剩一个子节点的节点与子节点合并，保持树的压缩形态
+func (rt *RadixTree) Delete(key string) bool {
+	txn := rt.writer()
+	ok := txn.Delete(key)
+	rt.apply(txn)
+	return ok
 }
 
 // BatchInsert 批量插入
@@ -252,140 +175,122 @@ func (rt *RadixTree) BatchDelete(keys []string) {
 	}
 }
 
-// Print 打印Radix树结构
-func (rt *RadixTree) Print() {
-	fmt.Println("Radix树结构:")
-	rt.printNode(rt.root, 0)
+// Print 把Radix树结构打印到 w，子节点按首字节排序
+func (rt *RadixTree) Print(w io.Writer) {
+	fmt.Fprintln(w, "Radix树结构:")
+	rt.printNode(w, rt.root, 0)
 }
 
 // printNode 递归打印节点
-func (rt *RadixTree) printNode(node *RadixNode, level int) {
+func (rt *RadixTree) printNode(w io.Writer, node *RadixNode, level int) {
 	prefix := strings.Repeat("  ", level)
 	endMark := ""
 	if node.isEnd {
 		endMark = "*"
 	}
-	fmt.Printf("%s%s%s\n", prefix, node.prefix, endMark)
-	for _, child := range node.children {
-		rt.printNode(child, level+1)
-	}
+	fmt.Fprintf(w, "%s%s%s\n", prefix, node.prefix, endMark)
+	node.children.each(func(child *RadixNode) bool {
+		rt.printNode(w, child, level+1)
+		return true
+	})
 }
 
-func main() {
-	rt := NewRadixTree()
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Println("Radix树命令行工具")
-	fmt.Println("命令:")
-	fmt.Println("  insert <key> <value> - 插入键值")
-	fmt.Println("  batch_insert <key1:value1,key2:value2,...> - 批量插入")
-	fmt.Println("  search <key>        - 搜索键")
-	fmt.Println("  prefix <prefix>     - 前缀搜索")
-	fmt.Println("  delete <key>        - 删除键")
-	fmt.Println("  batch_delete <key1,key2,...> - 批量删除")
-	fmt.Println("  print               - 打印树结构")
-	fmt.Println("  exit                - 退出")
-
-	for {
-		fmt.Print("> ")
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		parts := strings.Split(input, " ")
-
-		if len(parts) == 0 {
-			continue
-		}
+// match JSON输出中 search 的结果
+type match struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Found bool   `json:"found"`
+}
 
-		switch parts[0] {
-		case "insert":
-			if len(parts) < 3 {
-				parts = append(parts, "v"+parts[1])
+// newCLI 创建操作 rt 的命令解释器
+func newCLI(rt *RadixTree) *repl.Interpreter {
+	return repl.New("Radix树命令行工具",
+		repl.Command{Name: "insert", Usage: "<key> [value]", Help: "插入键值，省略值时为 v<key>", Args: 1, Run: func(c *repl.Context, args []string) error {
+			key, value := args[0], "v"+args[0]
+			if len(args) > 1 {
+				value = strings.Join(args[1:], " ")
 			}
-			key := parts[1]
-			value := strings.Join(parts[2:], " ")
 			rt.Insert(key, value)
-			fmt.Printf("已插入: %s -> %s\n", key, value)
-			rt.Print()
-
-		case "batch_insert":
-			if len(parts) < 2 {
-				fmt.Println("Usage: batch_insert <key1:value1,key2:value2,...>")
-				continue
-			}
+			c.Infof("已插入: %s -> %s\n", key, value)
+			return nil
+		}},
+		repl.Command{Name: "batch_insert", Usage: "<key1:value1,key2:value2,...>", Help: "批量插入", Args: 1, Run: func(c *repl.Context, args []string) error {
 			items := make(map[string]string)
-			pairs := strings.Split(parts[1], ",")
-			for _, pair := range pairs {
-				kv := strings.Split(pair, ":")
-				if len(kv) != 2 {
-					fmt.Printf("无效键值对: %s\n", pair)
+			for _, pair := range strings.Split(args[0], ",") {
+				k, v, ok := strings.Cut(pair, ":")
+				if !ok {
+					c.Printf("无效键值对: %s\n", pair)
 					continue
 				}
-				items[kv[0]] = kv[1]
+				items[k] = v
 			}
 			rt.BatchInsert(items)
-			fmt.Printf("已批量插入 %d 个键值对\n", len(items))
-			rt.Print()
-
-		case "search":
-			if len(parts) < 2 {
-				fmt.Println("Usage: search <key>")
-				continue
-			}
-			key := parts[1]
-			if value, found := rt.Search(key); found {
-				fmt.Printf("找到: %s -> %s\n", key, value)
+			c.Infof("已批量插入 %d 个键值对\n", len(items))
+			return nil
+		}},
+		repl.Command{Name: "search", Usage: "<key>", Help: "搜索键", Args: 1, Run: func(c *repl.Context, args []string) error {
+			key := args[0]
+			value, found := rt.Search(key)
+			if found {
+				c.Printf("找到: %s -> %s\n", key, value)
 			} else {
-				fmt.Printf("未找到: %s\n", key)
-			}
-
-		case "prefix":
-			if len(parts) < 2 {
-				fmt.Println("Usage: prefix <prefix>")
-				continue
+				c.Printf("未找到: %s\n", key)
 			}
-			prefix := parts[1]
+			c.Result(match{key, value, found})
+			return nil
+		}},
+		repl.Command{Name: "prefix", Usage: "<prefix>", Help: "前缀搜索", Args: 1, Run: func(c *repl.Context, args []string) error {
+			prefix := args[0]
 			results := rt.StartsWith(prefix)
 			if len(results) > 0 {
-				fmt.Printf("前缀匹配 %s:\n", prefix)
+				c.Printf("前缀匹配 %s:\n", prefix)
 				for _, res := range results {
-					fmt.Println("  ", res)
+					c.Println("  ", res)
 				}
 			} else {
-				fmt.Printf("没有找到以 %s 开头的键\n", prefix)
+				c.Printf("没有找到以 %s 开头的键\n", prefix)
 			}
-
-		case "delete":
-			if len(parts) < 2 {
-				fmt.Println("Usage: delete <key>")
-				continue
+			c.Result(append([]string{}, results...))
+			return nil
+		}},
+		repl.Command{Name: "longest", Usage: "<key>", Help: "最长前缀匹配: 查找是 key 的前缀的最长的键", Args: 1, Run: func(c *repl.Context, args []string) error {
+			key, value, found := rt.LongestPrefix(args[0])
+			if found {
+				c.Printf("最长前缀: %s -> %s\n", key, value)
+			} else {
+				c.Printf("%s 没有前缀匹配的键\n", args[0])
 			}
-			key := parts[1]
+			c.Result(match{key, value, found})
+			return nil
+		}},
+		repl.Command{Name: "delete", Usage: "<key>", Help: "删除键", Args: 1, Run: func(c *repl.Context, args []string) error {
+			key := args[0]
 			if rt.Delete(key) {
-				fmt.Printf("已删除: %s\n", key)
-				rt.Print()
+				c.Infof("已删除: %s\n", key)
 			} else {
-				fmt.Printf("删除失败，未找到: %s\n", key)
+				c.Printf("删除失败，未找到: %s\n", key)
 			}
-
-		case "batch_delete":
-			if len(parts) < 2 {
-				fmt.Println("Usage: batch_delete <key1,key2,...>")
-				continue
-			}
-			keys := strings.Split(parts[1], ",")
+			return nil
+		}},
+		repl.Command{Name: "batch_delete", Usage: "<key1,key2,...>", Help: "批量删除", Args: 1, Run: func(c *repl.Context, args []string) error {
+			keys := strings.Split(args[0], ",")
 			rt.BatchDelete(keys)
-			fmt.Printf("已批量删除 %d 个键\n", len(keys))
-			rt.Print()
-
-		case "print":
-			rt.Print()
-
-		case "exit":
-			fmt.Println("退出...")
-			return
+			c.Infof("已批量删除 %d 个键\n", len(keys))
+			return nil
+		}},
+		repl.Command{Name: "print", Help: "打印树结构", Run: func(c *repl.Context, _ []string) error {
+			rt.Print(c.Writer())
+			return nil
+		}},
+	)
+}
 
-		default:
-			fmt.Println("未知命令")
-		}
+func main() {
+	cli := newCLI(NewRadixTree())
+	cli.Flags(flag.CommandLine)
+	flag.Parse()
+	if err := cli.Main(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cg917658910/go-study/lib/repl"
+	"github.com/cg917658910/go-study/lib/repl/repltest"
+)
+
+// TestScripts 执行 testdata 下的命令脚本，与 *.golden 对照输出
+func TestScripts(t *testing.T) {
+	repltest.Golden(t, "testdata", func(t *testing.T) *repl.Interpreter {
+		return newCLI(NewRadixTree())
+	})
+}
+
+// checkTree 校验树的压缩形态: 子节点按首字节升序、能按首字节找到，布局与子节点数相符，
+// 除根节点外不存在不存值又只有不到两个子节点的节点
+func checkTree(t *testing.T, rt *RadixTree) {
+	t.Helper()
+	var check func(node *RadixNode, root bool)
+	check = func(node *RadixNode, root bool) {
+		c := &node.children
+		if !root && !node.isEnd && c.len() < 2 {
+			t.Fatalf("node %q: not an end and has %d children", node.prefix, c.len())
+		}
+		if c.len() > kindCap[c.kind] || c.kind > node4 && c.len() <= kindShrink[c.kind] {
+			t.Fatalf("node %q: %d children in layout %d", node.prefix, c.len(), c.kind)
+		}
+		n, last := 0, -1
+		c.each(func(child *RadixNode) bool {
+			if child.prefix == "" || int(child.prefix[0]) <= last {
+				t.Fatalf("node %q: child %q out of order", node.prefix, child.prefix)
+			}
+			if c.get(child.prefix[0]) != child {
+				t.Fatalf("node %q: child %q not indexed", node.prefix, child.prefix)
+			}
+			last = int(child.prefix[0])
+			n++
+			check(child, false)
+			return true
+		})
+		if n != c.len() {
+			t.Fatalf("node %q: visited %d children, len %d", node.prefix, n, c.len())
+		}
+	}
+	check(rt.root, true)
+}
+
+// collect 按遍历顺序收集 WalkPrefix 给出的键
+func collect(rt *RadixTree, prefix string) []string {
+	var keys []string
+	rt.WalkPrefix(prefix, func(key, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// TestRadixRandom 随机增删，与 map 对照查询、前缀遍历和最长前缀匹配
+func TestRadixRandom(t *testing.T) {
+	alphabet := []string{"a", "b", "ab", "ba", "中", "文", ""}
+	rng := rand.New(rand.NewSource(1))
+	word := func() string {
+		var b strings.Builder
+		for n := rng.Intn(6); n > 0; n-- {
+			b.WriteString(alphabet[rng.Intn(len(alphabet))])
+		}
+		return b.String()
+	}
+	rt := NewRadixTree()
+	model := make(map[string]string)
+	for i := 0; i < 5000; i++ {
+		key := word()
+		if rng.Intn(3) == 0 {
+			_, exists := model[key]
+			if got := rt.Delete(key); got != exists {
+				t.Fatalf("Delete(%q) = %v, want %v", key, got, exists)
+			}
+			delete(model, key)
+		} else {
+			value := word()
+			rt.Insert(key, value)
+			model[key] = value
+		}
+		if i%100 == 0 {
+			checkTree(t, rt)
+		}
+	}
+	checkTree(t, rt)
+
+	for i := 0; i < 500; i++ {
+		key := word()
+		want, wantFound := model[key]
+		if got, found := rt.Search(key); got != want || found != wantFound {
+			t.Fatalf("Search(%q) = %q, %v; want %q, %v", key, got, found, want, wantFound)
+		}
+
+		var wantKeys []string
+		for _, k := range slices.Sorted(maps.Keys(model)) {
+			if strings.HasPrefix(k, key) {
+				wantKeys = append(wantKeys, k)
+			}
+		}
+		if got := collect(rt, key); !slices.Equal(got, wantKeys) {
+			t.Fatalf("WalkPrefix(%q) = %q, want %q", key, got, wantKeys)
+		}
+
+		wantLongest, wantOK := "", false
+		for k := range model {
+			if strings.HasPrefix(key, k) && (!wantOK || len(k) > len(wantLongest)) {
+				wantLongest, wantOK = k, true
+			}
+		}
+		got, value, ok := rt.LongestPrefix(key)
+		if got != wantLongest || ok != wantOK || value != model[wantLongest] {
+			t.Fatalf("LongestPrefix(%q) = %q, %q, %v; want %q, %v", key, got, value, ok, wantLongest, wantOK)
+		}
+	}
+}
+
+func TestWalkPrefixStop(t *testing.T) {
+	rt := NewRadixTree()
+	for _, key := range []string{"romane", "romanus", "romulus", "rubens", "ruber", "rubicon"} {
+		rt.Insert(key, "")
+	}
+	if got := collect(rt, "ro"); !slices.Equal(got, []string{"romane", "romanus", "romulus"}) {
+		t.Fatalf("WalkPrefix(ro) = %q", got)
+	}
+	// 前缀在节点中间结束
+	if got := collect(rt, "rubi"); !slices.Equal(got, []string{"rubicon"}) {
+		t.Fatalf("WalkPrefix(rubi) = %q", got)
+	}
+	var seen []string
+	rt.WalkPrefix("", func(key, _ string) bool {
+		seen = append(seen, key)
+		return len(seen) < 4
+	})
+	if !slices.Equal(seen, []string{"romane", "romanus", "romulus", "rubens"}) {
+		t.Fatalf("early stop: %q", seen)
+	}
+}
+
+// TestDeleteMerges 删除后剩下的单一子节点链合并回一个节点
+func TestDeleteMerges(t *testing.T) {
+	rt := NewRadixTree()
+	for _, key := range []string{"test", "team", "toast", "te"} {
+		rt.Insert(key, "v")
+	}
+	for _, key := range []string{"te", "team", "toast"} {
+		if !rt.Delete(key) {
+			t.Fatalf("Delete(%q) = false", key)
+		}
+		checkTree(t, rt)
+	}
+	if child := rt.root.children.get('t'); rt.root.children.len() != 1 || child.prefix != "test" {
+		t.Fatalf("root has %d children, want only \"test\"", rt.root.children.len())
+	}
+	if rt.Delete("tes") || rt.Delete("tests") {
+		t.Fatal("deleted a key that is not stored")
+	}
+	if !rt.Delete("test") || rt.root.children.len() != 0 {
+		t.Fatal("tree not empty after deleting every key")
+	}
+}
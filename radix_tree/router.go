@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// 基于Radix树的HTTP路由:
+//
+// 每个HTTP方法一棵 RadixTree，以路由模式本身为键、模式为值存入，
+// 参数段 :name 和通配段 *name 作为普通字符留在节点前缀中。
+// 匹配时沿树向下，遇到 ':' 消耗路径中到下一个 '/' 为止的一段，遇到 '*' 消耗剩余的全部路径。
+// 同一位置的候选按 静态 > 参数 > 通配 的优先级尝试，走不通时回溯尝试下一个。
+//
+// 注册时检查冲突，保证同一位置的参数名一致，通配段不与其他段并存，
+// 因此参数名不会被节点分裂切开。与 gin 不同，通配符必须占据路径中的一整段
+
+var (
+	ErrBadPattern    = errors.New("router: invalid route pattern")
+	ErrRouteConflict = errors.New("router: route conflict")
+)
+
+// Param 路径参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 按在路径中出现的顺序排列的路径参数
+type Params []Param
+
+// ByName 返回名为 name 的参数值，没有时返回空串
+func (ps Params) ByName(name string) string {
+	v, _ := ps.Get(name)
+	return v
+}
+
+// Get 返回名为 name 的参数值
+func (ps Params) Get(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+type paramsKey struct{}
+
+// ParamsFromContext 取出路由放进请求上下文的路径参数
+func ParamsFromContext(ctx context.Context) Params {
+	ps, _ := ctx.Value(paramsKey{}).(Params)
+	return ps
+}
+
+// methodRoutes 一个HTTP方法的路由
+type methodRoutes struct {
+	tree     *RadixTree
+	handlers map[string]http.Handler // 路由模式 -> 处理器
+	patterns map[string][]string     // 路由模式 -> 按 '/' 切开的段，用于冲突检查
+}
+
+// Router 按方法和路径分发请求的 http.Handler
+type Router struct {
+	routes map[string]*methodRoutes
+
+	// NotFound 没有匹配的路由时调用，为 nil 时使用 http.NotFound
+	NotFound http.Handler
+	// HandleMethodNotAllowed 为 true 时，路径能被其他方法匹配的请求返回 405 和 Allow 头，
+	// 否则与 gin 的默认行为一样按 404 处理
+	HandleMethodNotAllowed bool
+}
+
+// NewRouter 创建空路由
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]*methodRoutes)}
+}
+
+// Handle 注册方法 method 上路由模式 pattern 的处理器。
+// 模式以 '/' 开头，:name 匹配一个非空段，*name 匹配剩余的全部路径(含开头的 '/')且只能是最后一段
+func (r *Router) Handle(method, pattern string, h http.Handler) error {
+	segs, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	m := r.routes[method]
+	if m == nil {
+		m = &methodRoutes{tree: NewRadixTree(), handlers: make(map[string]http.Handler), patterns: make(map[string][]string)}
+		r.routes[method] = m
+	}
+	for existing, other := range m.patterns {
+		if conflicts(segs, other) {
+			return fmt.Errorf("%w: %s %s conflicts with %s", ErrRouteConflict, method, pattern, existing)
+		}
+	}
+	m.tree.Insert(pattern, pattern)
+	m.handlers[pattern] = h
+	m.patterns[pattern] = segs
+	return nil
+}
+
+// HandleFunc 以函数注册处理器
+func (r *Router) HandleFunc(method, pattern string, f http.HandlerFunc) error {
+	return r.Handle(method, pattern, f)
+}
+
+// Lookup 查找匹配的路由，返回处理器、路由模式和路径参数
+func (r *Router) Lookup(method, path string) (http.Handler, string, Params, bool) {
+	m := r.routes[method]
+	if m == nil {
+		return nil, "", nil, false
+	}
+	var ps Params
+	n := matchNode(m.tree.root, path, &ps)
+	if n == nil {
+		return nil, "", nil, false
+	}
+	return m.handlers[n.value], n.value, ps, true
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	if h, _, ps, ok := r.Lookup(req.Method, path); ok {
+		if len(ps) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), paramsKey{}, ps))
+		}
+		h.ServeHTTP(w, req)
+		return
+	}
+	if r.HandleMethodNotAllowed {
+		if allow := r.allowed(path); allow != "" {
+			w.Header().Set("Allow", allow)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+	}
+	if r.NotFound != nil {
+		r.NotFound.ServeHTTP(w, req)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// allowed 返回能匹配 path 的方法，以逗号分隔并排序
+func (r *Router) allowed(path string) string {
+	var methods []string
+	for method, m := range r.routes {
+		var ps Params
+		if matchNode(m.tree.root, path, &ps) != nil {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	slices.Sort(methods)
+	return strings.Join(methods, ", ")
+}
+
+// parsePattern 校验路由模式，返回按 '/' 切开的段
+func parsePattern(pattern string) ([]string, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("%w: %q must begin with '/'", ErrBadPattern, pattern)
+	}
+	segs := strings.Split(pattern[1:], "/")
+	names := make(map[string]bool)
+	for i, seg := range segs {
+		w := strings.IndexAny(seg, ":*")
+		switch {
+		case w < 0:
+			continue
+		case w > 0:
+			return nil, fmt.Errorf("%w: wildcard in %q must start the segment", ErrBadPattern, pattern)
+		case strings.ContainsAny(seg[1:], ":*"):
+			return nil, fmt.Errorf("%w: only one wildcard per segment in %q", ErrBadPattern, pattern)
+		case len(seg) == 1:
+			return nil, fmt.Errorf("%w: wildcard in %q needs a name", ErrBadPattern, pattern)
+		case seg[0] == '*' && i != len(segs)-1:
+			return nil, fmt.Errorf("%w: catch-all in %q must be the last segment", ErrBadPattern, pattern)
+		case names[seg[1:]]:
+			return nil, fmt.Errorf("%w: duplicate parameter %q in %q", ErrBadPattern, seg[1:], pattern)
+		}
+		names[seg[1:]] = true
+	}
+	return segs, nil
+}
+
+// conflicts 判断两个模式能否共存: 逐段比较，相同的段继续；
+// 静态段与参数段可以并存(静态优先)，不同名的参数、通配段与任何不同的段都冲突。
+// 两个模式完全相同也算冲突
+func conflicts(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := a[i], b[i]
+		if x == y {
+			continue
+		}
+		wx, wy := wildcard(x), wildcard(y)
+		switch {
+		case wx == '*' || wy == '*':
+			return true
+		case wx == ':' && wy == ':':
+			return true
+		default:
+			// 不同的静态段，或者静态段与参数段
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+// wildcard 返回段的通配符 ':' 或 '*'，静态段返回 0
+func wildcard(seg string) byte {
+	if seg != "" && (seg[0] == ':' || seg[0] == '*') {
+		return seg[0]
+	}
+	return 0
+}
+
+// matchNode 从节点 n 开始匹配 path，返回匹配到的存有路由的节点，匹配到的参数追加到 ps
+func matchNode(n *RadixNode, path string, ps *Params) *RadixNode {
+	rest, ok := matchPrefix(n.prefix, path, ps)
+	if !ok {
+		return nil
+	}
+	if rest == "" && n.isEnd {
+		return n
+	}
+	mark := len(*ps)
+	// 静态子节点优先，其次参数，最后通配，失败时撤销已追加的参数
+	if rest != "" && rest[0] != ':' && rest[0] != '*' {
+		if child := n.children.get(rest[0]); child != nil {
+			if m := matchNode(child, rest, ps); m != nil {
+				return m
+			}
+			*ps = (*ps)[:mark]
+		}
+	}
+	for _, w := range []byte{':', '*'} {
+		if child := n.children.get(w); child != nil {
+			if m := matchNode(child, rest, ps); m != nil {
+				return m
+			}
+			*ps = (*ps)[:mark]
+		}
+	}
+	return nil
+}
+
+// matchPrefix 用节点前缀 prefix 匹配 path 的开头，返回剩余的路径
+func matchPrefix(prefix, path string, ps *Params) (string, bool) {
+	for len(prefix) > 0 {
+		switch prefix[0] {
+		case ':':
+			end := strings.IndexByte(prefix, '/')
+			if end < 0 {
+				end = len(prefix)
+			}
+			n := strings.IndexByte(path, '/')
+			if n < 0 {
+				n = len(path)
+			}
+			if n == 0 {
+				return "", false
+			}
+			*ps = append(*ps, Param{Key: prefix[1:end], Value: path[:n]})
+			prefix, path = prefix[end:], path[n:]
+		case '*':
+			// 通配段之前的 '/' 已作为静态部分匹配过，参数值与 gin 一样带上它
+			*ps = append(*ps, Param{Key: prefix[1:], Value: "/" + path})
+			return "", true
+		default:
+			end := strings.IndexAny(prefix, ":*")
+			if end < 0 {
+				end = len(prefix)
+			}
+			if !strings.HasPrefix(path, prefix[:end]) {
+				return "", false
+			}
+			prefix, path = prefix[end:], path[end:]
+		}
+	}
+	return path, true
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// 仿照 gin 的 tree_test: 注册一组路由，再逐个请求检查匹配到的路由和参数
+
+type testRequest struct {
+	path       string
+	nilHandler bool   // 不应匹配任何路由
+	route      string // 匹配到的路由模式
+	params     Params
+}
+
+func newTestRouter(t *testing.T, routes []string) *Router {
+	t.Helper()
+	r := NewRouter()
+	for _, route := range routes {
+		if err := r.HandleFunc(http.MethodGet, route, func(http.ResponseWriter, *http.Request) {}); err != nil {
+			t.Fatalf("Handle(%q): %v", route, err)
+		}
+	}
+	return r
+}
+
+func checkRequests(t *testing.T, r *Router, requests []testRequest) {
+	t.Helper()
+	for _, req := range requests {
+		h, route, ps, ok := r.Lookup(http.MethodGet, req.path)
+		switch {
+		case req.nilHandler:
+			if ok {
+				t.Errorf("%s: matched %s, want no match", req.path, route)
+			}
+		case !ok || h == nil:
+			t.Errorf("%s: no match, want %s", req.path, req.route)
+		case route != req.route:
+			t.Errorf("%s: matched %s, want %s", req.path, route, req.route)
+		case !slices.Equal(ps, req.params):
+			t.Errorf("%s: params %v, want %v", req.path, ps, req.params)
+		}
+	}
+}
+
+func TestRouterStatic(t *testing.T) {
+	r := newTestRouter(t, []string{
+		"/hi", "/contact", "/co", "/c", "/a", "/ab", "/doc/", "/doc/go_faq.html", "/doc/go1.html", "/α", "/β",
+	})
+	checkRequests(t, r, []testRequest{
+		{path: "/a", route: "/a"},
+		{path: "/", nilHandler: true},
+		{path: "/hi", route: "/hi"},
+		{path: "/contact", route: "/contact"},
+		{path: "/co", route: "/co"},
+		{path: "/con", nilHandler: true},
+		{path: "/cona", nilHandler: true},
+		{path: "/no", nilHandler: true},
+		{path: "/ab", route: "/ab"},
+		{path: "/doc", nilHandler: true},
+		{path: "/doc/go1.html", route: "/doc/go1.html"},
+		{path: "/α", route: "/α"},
+		{path: "/β", route: "/β"},
+	})
+}
+
+func TestRouterWildcard(t *testing.T) {
+	r := newTestRouter(t, []string{
+		"/",
+		"/cmd/:tool/",
+		"/cmd/:tool/:sub",
+		"/cmd/whoami",
+		"/cmd/whoami/root",
+		"/cmd/whoami/root/",
+		"/src/*filepath",
+		"/search/",
+		"/search/:query",
+		"/search/gin-gonic",
+		"/search/google",
+		"/user/:name",
+		"/user/:name/about",
+		"/files/:dir/*filepath",
+		"/doc/",
+		"/doc/go_faq.html",
+		"/doc/go1.html",
+		"/info/:user/public",
+		"/info/:user/project/:project",
+		"/info/:user/project/golang",
+		"/aa/*xx",
+		"/ab/*xx",
+		"/:cc",
+		"/c1/:dd/e",
+		"/c1/:dd/e1",
+		"/:cc/cc",
+		"/:cc/:dd/ee",
+		"/:cc/:dd/:ee/ff",
+		"/:cc/:dd/:ee/:ff/gg",
+		"/:cc/:dd/:ee/:ff/:gg/hh",
+		"/get/test/abc/",
+		"/get/:param/abc/",
+		"/something/:paramname/thirdthing",
+		"/something/secondthing/test",
+		"/get/abc",
+		"/get/:param",
+		"/get/abc/123abc",
+		"/get/abc/:param",
+		"/get/abc/123abc/xxx8",
+		"/get/abc/123abc/:param",
+		"/get/abc/123abc/xxx8/1234",
+		"/get/abc/123abc/xxx8/:param",
+	})
+	checkRequests(t, r, []testRequest{
+		{path: "/", route: "/"},
+		{path: "/cmd/test", nilHandler: true},
+		{path: "/cmd/test/", route: "/cmd/:tool/", params: Params{{"tool", "test"}}},
+		{path: "/cmd/test/3", route: "/cmd/:tool/:sub", params: Params{{"tool", "test"}, {"sub", "3"}}},
+		{path: "/cmd/who", nilHandler: true},
+		{path: "/cmd/who/", route: "/cmd/:tool/", params: Params{{"tool", "who"}}},
+		{path: "/cmd/whoami", route: "/cmd/whoami"},
+		{path: "/cmd/whoami/", route: "/cmd/:tool/", params: Params{{"tool", "whoami"}}},
+		{path: "/cmd/whoami/r", route: "/cmd/:tool/:sub", params: Params{{"tool", "whoami"}, {"sub", "r"}}},
+		{path: "/cmd/whoami/root", route: "/cmd/whoami/root"},
+		{path: "/cmd/whoami/root/", route: "/cmd/whoami/root/"},
+		{path: "/src/", route: "/src/*filepath", params: Params{{"filepath", "/"}}},
+		{path: "/src/some/file.png", route: "/src/*filepath", params: Params{{"filepath", "/some/file.png"}}},
+		{path: "/search/", route: "/search/"},
+		{path: "/search/someth!ng+in+ünìcodé", route: "/search/:query", params: Params{{"query", "someth!ng+in+ünìcodé"}}},
+		{path: "/search/someth!ng+in+ünìcodé/", nilHandler: true},
+		{path: "/search/gin", route: "/search/:query", params: Params{{"query", "gin"}}},
+		{path: "/search/gin-gonic", route: "/search/gin-gonic"},
+		{path: "/search/google", route: "/search/google"},
+		{path: "/user/gopher", route: "/user/:name", params: Params{{"name", "gopher"}}},
+		{path: "/user/gopher/about", route: "/user/:name/about", params: Params{{"name", "gopher"}}},
+		{path: "/files/js/inc/framework.js", route: "/files/:dir/*filepath", params: Params{{"dir", "js"}, {"filepath", "/inc/framework.js"}}},
+		{path: "/info/gordon/public", route: "/info/:user/public", params: Params{{"user", "gordon"}}},
+		{path: "/info/gordon/project/go", route: "/info/:user/project/:project", params: Params{{"user", "gordon"}, {"project", "go"}}},
+		{path: "/info/gordon/project/golang", route: "/info/:user/project/golang", params: Params{{"user", "gordon"}}},
+		{path: "/aa/aa", route: "/aa/*xx", params: Params{{"xx", "/aa"}}},
+		{path: "/ab/ab", route: "/ab/*xx", params: Params{{"xx", "/ab"}}},
+		{path: "/a", route: "/:cc", params: Params{{"cc", "a"}}},
+		// 静态前缀走不通时回溯到参数
+		{path: "/all", route: "/:cc", params: Params{{"cc", "all"}}},
+		{path: "/d", route: "/:cc", params: Params{{"cc", "d"}}},
+		{path: "/ad", route: "/:cc", params: Params{{"cc", "ad"}}},
+		{path: "/dd", route: "/:cc", params: Params{{"cc", "dd"}}},
+		{path: "/dddaa", route: "/:cc", params: Params{{"cc", "dddaa"}}},
+		{path: "/aa", route: "/:cc", params: Params{{"cc", "aa"}}},
+		{path: "/aaa", route: "/:cc", params: Params{{"cc", "aaa"}}},
+		{path: "/aaa/cc", route: "/:cc/cc", params: Params{{"cc", "aaa"}}},
+		{path: "/ab", route: "/:cc", params: Params{{"cc", "ab"}}},
+		{path: "/abb", route: "/:cc", params: Params{{"cc", "abb"}}},
+		{path: "/abb/cc", route: "/:cc/cc", params: Params{{"cc", "abb"}}},
+		{path: "/allxxxx", route: "/:cc", params: Params{{"cc", "allxxxx"}}},
+		{path: "/alldd", route: "/:cc", params: Params{{"cc", "alldd"}}},
+		{path: "/all/cc", route: "/:cc/cc", params: Params{{"cc", "all"}}},
+		{path: "/a/cc", route: "/:cc/cc", params: Params{{"cc", "a"}}},
+		{path: "/c1/d/e", route: "/c1/:dd/e", params: Params{{"dd", "d"}}},
+		{path: "/c1/d/e1", route: "/c1/:dd/e1", params: Params{{"dd", "d"}}},
+		{path: "/c1/d/ee", route: "/:cc/:dd/ee", params: Params{{"cc", "c1"}, {"dd", "d"}}},
+		{path: "/cc/cc", route: "/:cc/cc", params: Params{{"cc", "cc"}}},
+		{path: "/ccc/cc", route: "/:cc/cc", params: Params{{"cc", "ccc"}}},
+		{path: "/deedwjfs/cc", route: "/:cc/cc", params: Params{{"cc", "deedwjfs"}}},
+		{path: "/acllcc/cc", route: "/:cc/cc", params: Params{{"cc", "acllcc"}}},
+		{path: "/get/test/abc/", route: "/get/test/abc/"},
+		{path: "/get/te/abc/", route: "/get/:param/abc/", params: Params{{"param", "te"}}},
+		{path: "/get/testaa/abc/", route: "/get/:param/abc/", params: Params{{"param", "testaa"}}},
+		{path: "/get/xx/abc/", route: "/get/:param/abc/", params: Params{{"param", "xx"}}},
+		{path: "/get/tt/abc/", route: "/get/:param/abc/", params: Params{{"param", "tt"}}},
+		{path: "/get/a/abc/", route: "/get/:param/abc/", params: Params{{"param", "a"}}},
+		{path: "/get/t/abc/", route: "/get/:param/abc/", params: Params{{"param", "t"}}},
+		{path: "/get/aa/abc/", route: "/get/:param/abc/", params: Params{{"param", "aa"}}},
+		{path: "/get/abas/abc/", route: "/get/:param/abc/", params: Params{{"param", "abas"}}},
+		{path: "/something/secondthing/test", route: "/something/secondthing/test"},
+		{path: "/something/abcdad/thirdthing", route: "/something/:paramname/thirdthing", params: Params{{"paramname", "abcdad"}}},
+		{path: "/something/secondthingaaaa/thirdthing", route: "/something/:paramname/thirdthing", params: Params{{"paramname", "secondthingaaaa"}}},
+		{path: "/something/se/thirdthing", route: "/something/:paramname/thirdthing", params: Params{{"paramname", "se"}}},
+		{path: "/something/s/thirdthing", route: "/something/:paramname/thirdthing", params: Params{{"paramname", "s"}}},
+		{path: "/c/d/ee", route: "/:cc/:dd/ee", params: Params{{"cc", "c"}, {"dd", "d"}}},
+		{path: "/c/d/e/ff", route: "/:cc/:dd/:ee/ff", params: Params{{"cc", "c"}, {"dd", "d"}, {"ee", "e"}}},
+		{path: "/c/d/e/f/gg", route: "/:cc/:dd/:ee/:ff/gg", params: Params{{"cc", "c"}, {"dd", "d"}, {"ee", "e"}, {"ff", "f"}}},
+		{path: "/c/d/e/f/g/hh", route: "/:cc/:dd/:ee/:ff/:gg/hh", params: Params{{"cc", "c"}, {"dd", "d"}, {"ee", "e"}, {"ff", "f"}, {"gg", "g"}}},
+		{path: "/cc/dd/ee/ff/gg/hh", route: "/:cc/:dd/:ee/:ff/:gg/hh", params: Params{{"cc", "cc"}, {"dd", "dd"}, {"ee", "ee"}, {"ff", "ff"}, {"gg", "gg"}}},
+		{path: "/get/abc", route: "/get/abc"},
+		{path: "/get/a", route: "/get/:param", params: Params{{"param", "a"}}},
+		{path: "/get/abz", route: "/get/:param", params: Params{{"param", "abz"}}},
+		{path: "/get/12a", route: "/get/:param", params: Params{{"param", "12a"}}},
+		{path: "/get/abcd", route: "/get/:param", params: Params{{"param", "abcd"}}},
+		{path: "/get/abc/123abc", route: "/get/abc/123abc"},
+		{path: "/get/abc/12", route: "/get/abc/:param", params: Params{{"param", "12"}}},
+		{path: "/get/abc/123ab", route: "/get/abc/:param", params: Params{{"param", "123ab"}}},
+		{path: "/get/abc/xyz", route: "/get/abc/:param", params: Params{{"param", "xyz"}}},
+		{path: "/get/abc/123abcddxx", route: "/get/abc/:param", params: Params{{"param", "123abcddxx"}}},
+		{path: "/get/abc/123abc/xxx8", route: "/get/abc/123abc/xxx8"},
+		{path: "/get/abc/123abc/x", route: "/get/abc/123abc/:param", params: Params{{"param", "x"}}},
+		{path: "/get/abc/123abc/xxx", route: "/get/abc/123abc/:param", params: Params{{"param", "xxx"}}},
+		{path: "/get/abc/123abc/abc", route: "/get/abc/123abc/:param", params: Params{{"param", "abc"}}},
+		{path: "/get/abc/123abc/xxx8xxas", route: "/get/abc/123abc/:param", params: Params{{"param", "xxx8xxas"}}},
+		{path: "/get/abc/123abc/xxx8/1234", route: "/get/abc/123abc/xxx8/1234"},
+		{path: "/get/abc/123abc/xxx8/1", route: "/get/abc/123abc/xxx8/:param", params: Params{{"param", "1"}}},
+		{path: "/get/abc/123abc/xxx8/123", route: "/get/abc/123abc/xxx8/:param", params: Params{{"param", "123"}}},
+		{path: "/get/abc/123abc/xxx8/78k", route: "/get/abc/123abc/xxx8/:param", params: Params{{"param", "78k"}}},
+		{path: "/get/abc/123abc/xxx8/1234xxxd", route: "/get/abc/123abc/xxx8/:param", params: Params{{"param", "1234xxxd"}}},
+	})
+}
+
+// TestRouterConflicts 仿照 gin 的 TestTreeWildcardConflict，按顺序注册，检查哪些路由冲突
+func TestRouterConflicts(t *testing.T) {
+	r := NewRouter()
+	for _, tc := range []struct {
+		route    string
+		conflict bool
+	}{
+		{"/cmd/:tool/:sub", false},
+		{"/cmd/vet", false},
+		{"/foo/bar", false},
+		{"/foo/:name", false},
+		{"/foo/:names", true},
+		{"/cmd/*path", true},
+		{"/cmd/:badvar", true},
+		{"/cmd/:tool/names", false},
+		{"/cmd/:tool/:badsub/details", true},
+		{"/src/*filepath", false},
+		{"/src/:file", true},
+		{"/src/static.json", true},
+		{"/src/*filepathx", true},
+		{"/src/", true},
+		{"/src/foo/bar", true},
+		{"/src1/", false},
+		{"/src1/*filepath", true},
+		{"/src2/*filepath", false},
+		{"/search/:query", false},
+		{"/search/valid", false},
+		{"/id/:id", false},
+		{"/id/:id", true},
+		{"/id/:id/", false},
+	} {
+		err := r.HandleFunc(http.MethodGet, tc.route, func(http.ResponseWriter, *http.Request) {})
+		if got := errors.Is(err, ErrRouteConflict); got != tc.conflict {
+			t.Errorf("Handle(%q): %v, want conflict=%v", tc.route, err, tc.conflict)
+		}
+	}
+	// 冲突只在同一方法内检查
+	if err := r.HandleFunc(http.MethodPost, "/src/static.json", func(http.ResponseWriter, *http.Request) {}); err != nil {
+		t.Errorf("POST /src/static.json: %v", err)
+	}
+}
+
+func TestRouterBadPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		"", "noslash", "/user_:name", "/src2*filepath", "/:", "/*", "/a/:b:c", "/src/*filepath/x", "/:id/:id",
+	} {
+		if err := NewRouter().HandleFunc(http.MethodGet, pattern, nil); !errors.Is(err, ErrBadPattern) {
+			t.Errorf("Handle(%q): got %v, want ErrBadPattern", pattern, err)
+		}
+	}
+}
+
+func TestRouterServeHTTP(t *testing.T) {
+	r := NewRouter()
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprintf(w, "%s %v", name, ParamsFromContext(req.Context()))
+		}
+	}
+	for _, route := range []struct{ method, pattern string }{
+		{http.MethodGet, "/users/:id"},
+		{http.MethodPut, "/users/:id"},
+		{http.MethodGet, "/users/new"},
+		{http.MethodPost, "/users"},
+		{http.MethodGet, "/static/*path"},
+	} {
+		if err := r.Handle(route.method, route.pattern, handler(route.method+" "+route.pattern)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	do := func(method, path string) (int, string, http.Header) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Code, string(body), w.Result().Header
+	}
+	for _, tc := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/users/42", 200, "GET /users/:id [{id 42}]"},
+		{http.MethodPut, "/users/42", 200, "PUT /users/:id [{id 42}]"},
+		{http.MethodGet, "/users/new", 200, "GET /users/new []"},
+		{http.MethodPost, "/users", 200, "POST /users []"},
+		{http.MethodGet, "/static/css/app.css", 200, "GET /static/*path [{path /css/app.css}]"},
+		{http.MethodGet, "/nope", 404, "404 page not found\n"},
+		{http.MethodDelete, "/users/42", 404, "404 page not found\n"},
+	} {
+		code, body, _ := do(tc.method, tc.path)
+		if code != tc.code || body != tc.body {
+			t.Errorf("%s %s: %d %q, want %d %q", tc.method, tc.path, code, body, tc.code, tc.body)
+		}
+	}
+
+	r.HandleMethodNotAllowed = true
+	if code, _, header := do(http.MethodDelete, "/users/42"); code != 405 || header.Get("Allow") != "GET, PUT" {
+		t.Errorf("DELETE /users/42: %d, Allow %q", code, header.Get("Allow"))
+	}
+	r.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	if code, _, _ := do(http.MethodGet, "/nope"); code != http.StatusTeapot {
+		t.Errorf("custom NotFound: %d", code)
+	}
+}
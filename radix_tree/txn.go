@@ -0,0 +1,262 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 持久化的Radix树:
+//
+// 写事务从某个版本的根开始，沿修改路径复制节点(路径复制)，未修改的子树在新旧版本间共享，
+// 提交时只需换上新的根，持有旧树的读者看到的内容不变，读取不需要加锁。
+// 每个写入方有一个代号，它创建的节点记下这个代号，在提交之前只属于它，可以原地修改，
+// 同一事务中对同一路径的多次修改只复制一次。
+//
+// 观察者在节点上等待通道关闭。修改总会复制或改动从根到被修改节点的整条路径，
+// 因此等在某个节点上就能收到它整棵子树的变化
+
+// lastGen 最近分配的写入方代号，0 不分配给任何写入方
+var lastGen atomic.Uint64
+
+func nextGen() uint64 {
+	return lastGen.Add(1)
+}
+
+// watcher 只关闭一次的通知通道。一个版本可能派生出多个事务，它们都会通知同一个旧节点
+type watcher struct {
+	ch   chan struct{}
+	once sync.Once
+}
+
+func (w *watcher) notify() {
+	w.once.Do(func() { close(w.ch) })
+}
+
+// watchCh 返回节点的通知通道，没有时创建。读者可能并发调用
+func (n *RadixNode) watchCh() <-chan struct{} {
+	for {
+		if w := n.watch.Load(); w != nil {
+			return w.ch
+		}
+		if w := (&watcher{ch: make(chan struct{})}); n.watch.CompareAndSwap(nil, w) {
+			return w.ch
+		}
+	}
+}
+
+// WatchPrefix 返回一个通道，以 prefix 开头的键在之后的修改或提交中变化时关闭。
+// 通道属于路径上最深的、以 prefix 开头的键都要经过的节点，该节点下其他键变化时也会关闭，
+// 调用方收到通知后应重新读取再判断。prefix 在某个节点中间结束或与节点的前缀分叉时等在这个节点上；
+// 没有子节点以 prefix 的下一个字节开头时只能等在父节点上，父节点是根时任何写入都会关闭通道
+func (rt *RadixTree) WatchPrefix(prefix string) <-chan struct{} {
+	node := rt.root
+	for len(prefix) > 0 {
+		child := node.children.get(prefix[0])
+		if child == nil {
+			break
+		}
+		// 以 prefix 开头的键都在 child 下，写入它们要复制或修改 child
+		node = child
+		if !strings.HasPrefix(prefix, child.prefix) {
+			break
+		}
+		prefix = prefix[len(child.prefix):]
+	}
+	return node.watchCh()
+}
+
+// Txn 写事务。事务不是并发安全的，同一版本可以同时开始多个事务
+type Txn struct {
+	root    *RadixNode
+	gen     uint64     // 本事务创建的节点的代号
+	changed []*watcher // 被复制、修改或移除的节点的观察者，提交时通知
+}
+
+// Txn 以树的当前内容开始写事务，提交前事务中的修改对树不可见
+func (rt *RadixTree) Txn() *Txn {
+	// 事务与树共享全部节点，之后对树的直接修改不能再原地进行
+	if rt.gen.Load() != 0 {
+		rt.gen.Store(0)
+	}
+	return &Txn{root: rt.root, gen: nextGen()}
+}
+
+// writer 返回直接修改树用的事务，它原地修改树独有的节点
+func (rt *RadixTree) writer() *Txn {
+	gen := rt.gen.Load()
+	if gen == 0 {
+		gen = nextGen()
+		rt.gen.Store(gen)
+	}
+	return &Txn{root: rt.root, gen: gen}
+}
+
+// apply 换上 writer 修改后的根并通知观察者
+func (rt *RadixTree) apply(txn *Txn) {
+	rt.root = txn.root
+	txn.notify()
+}
+
+// Commit 返回包含事务中全部修改的新树，并通知被修改的节点的观察者。
+// 提交后事务可以继续使用，之后的修改不影响已提交的树
+func (t *Txn) Commit() *RadixTree {
+	tree := &RadixTree{root: t.root}
+	t.gen = nextGen()
+	t.notify()
+	return tree
+}
+
+func (t *Txn) notify() {
+	for _, w := range t.changed {
+		w.notify()
+	}
+	t.changed = nil
+}
+
+// Search 精确查找，能看到事务中尚未提交的修改
+func (t *Txn) Search(key string) (string, bool) {
+	return search(t.root, key)
+}
+
+// newNode 创建属于本事务的节点
+func (t *Txn) newNode(prefix string) *RadixNode {
+	n := NewRadixNode(prefix)
+	n.gen = t.gen
+	return n
+}
+
+// writable 返回可以原地修改的 n: 属于本事务的节点直接返回，否则返回副本。
+// 两种情况下 n 的观察者都会收到通知
+func (t *Txn) writable(n *RadixNode) *RadixNode {
+	if n.gen == t.gen {
+		if w := n.watch.Swap(nil); w != nil {
+			t.changed = append(t.changed, w)
+		}
+		return n
+	}
+	if w := n.watch.Load(); w != nil {
+		t.changed = append(t.changed, w)
+	}
+	return &RadixNode{
+		prefix:   n.prefix,
+		children: n.children.clone(),
+		isEnd:    n.isEnd,
+		value:    n.value,
+		gen:      t.gen,
+	}
+}
+
+// writableChild 把 node 中首字节为 b 的子节点换成可修改的版本并返回。node 必须可修改
+func (t *Txn) writableChild(node *RadixNode, b byte) *RadixNode {
+	child := node.children.get(b)
+	if c := t.writable(child); c != child {
+		node.children.set(b, c)
+		child = c
+	}
+	return child
+}
+
+// Insert 插入键值，键已存在时更新值
+func (t *Txn) Insert(key, value string) {
+	t.root = t.writable(t.root)
+	node := t.root
+	for len(key) > 0 {
+		// 查找与当前key有共同前缀的子节点
+		if node.children.get(key[0]) == nil {
+			// 没有共同前缀的子节点，直接添加新节点
+			newNode := t.newNode(key)
+			newNode.isEnd = true
+			newNode.value = value
+			node.children.set(key[0], newNode)
+			return
+		}
+		child := t.writableChild(node, key[0])
+
+		commonPrefix := longestCommonPrefix(key, child.prefix)
+		if commonPrefix < len(child.prefix) {
+			// 部分匹配，分裂子节点。首字节不变，父节点中的索引仍然有效
+			t.splitNode(child, commonPrefix)
+		}
+		key = key[commonPrefix:]
+		node = child
+	}
+	node.isEnd = true
+	node.value = value
+}
+
+// splitNode 分裂可修改的节点
+func (t *Txn) splitNode(node *RadixNode, splitPos int) {
+	// 创建新节点保存分裂后的部分
+	newChild := t.newNode(node.prefix[splitPos:])
+	newChild.children = node.children
+	newChild.isEnd = node.isEnd
+	newChild.value = node.value
+
+	// 更新当前节点
+	node.prefix = node.prefix[:splitPos]
+	node.children = children{}
+	node.children.set(newChild.prefix[0], newChild)
+	node.isEnd = false
+	node.value = ""
+}
+
+// Delete 删除键。删除后没有子节点的节点被移除，
+// 不存值且只剩一个子节点的节点与子节点合并，保持树的压缩形态
+func (t *Txn) Delete(key string) bool {
+	// 先确认键存在，避免为不存在的键复制路径和误发通知
+	if _, ok := search(t.root, key); !ok {
+		return false
+	}
+
+	var parents []*RadixNode
+	t.root = t.writable(t.root)
+	node := t.root
+	for len(key) > 0 {
+		child := t.writableChild(node, key[0])
+		parents = append(parents, node)
+		key = key[len(child.prefix):]
+		node = child
+	}
+
+	// 标记为非结束节点
+	node.isEnd = false
+	node.value = ""
+
+	// 向上删除空节点，合并单一子节点。根节点不参与合并
+	for i := len(parents) - 1; i >= 0 && !node.isEnd; i-- {
+		parent := parents[i]
+		switch node.children.len() {
+		case 0:
+			parent.children.remove(node.prefix[0])
+		case 1:
+			t.mergeChild(node)
+			return true
+		default:
+			return true
+		}
+		node = parent
+	}
+	return true
+}
+
+// mergeChild 把只有一个子节点的可修改节点与子节点合并成一个节点
+func (t *Txn) mergeChild(node *RadixNode) {
+	var child *RadixNode
+	node.children.each(func(c *RadixNode) bool {
+		child = c
+		return false
+	})
+	node.prefix += child.prefix
+	if child.gen == t.gen {
+		node.children = child.children
+	} else {
+		node.children = child.children.clone()
+	}
+	node.isEnd = child.isEnd
+	node.value = child.value
+	// 子节点不会出现在新版本中，之后的修改不会再经过它
+	if w := child.watch.Load(); w != nil {
+		t.changed = append(t.changed, w)
+	}
+}
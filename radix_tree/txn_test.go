@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// checkContents 校验树的内容与 model 完全相同
+func checkContents(t *testing.T, rt *RadixTree, model map[string]string) {
+	t.Helper()
+	checkTree(t, rt)
+	if got, want := collect(rt, ""), slices.Sorted(maps.Keys(model)); !slices.Equal(got, want) {
+		t.Fatalf("keys = %q, want %q", got, want)
+	}
+	for k, v := range model {
+		if got, ok := rt.Search(k); !ok || got != v {
+			t.Fatalf("Search(%q) = %q, %v; want %q", k, got, ok, v)
+		}
+	}
+}
+
+// TestTxnSnapshots 每个版本上随机开始事务增删后提交，
+// 所有提交过的版本都必须保持提交时的内容
+func TestTxnSnapshots(t *testing.T) {
+	alphabet := []string{"a", "b", "ab", "ba", "中", ""}
+	rng := rand.New(rand.NewSource(1))
+	word := func() string {
+		var b strings.Builder
+		for n := rng.Intn(6); n > 0; n-- {
+			b.WriteString(alphabet[rng.Intn(len(alphabet))])
+		}
+		return b.String()
+	}
+
+	trees := []*RadixTree{NewRadixTree()}
+	models := []map[string]string{{}}
+	for i := 0; i < 300; i++ {
+		// 从随机的旧版本派生，使多个事务共享同一批节点
+		base := rng.Intn(len(trees))
+		txn := trees[base].Txn()
+		model := maps.Clone(models[base])
+		for n := rng.Intn(20); n > 0; n-- {
+			key := word()
+			if rng.Intn(3) == 0 {
+				_, exists := model[key]
+				if got := txn.Delete(key); got != exists {
+					t.Fatalf("Delete(%q) = %v, want %v", key, got, exists)
+				}
+				delete(model, key)
+			} else {
+				value := fmt.Sprint(i)
+				txn.Insert(key, value)
+				model[key] = value
+			}
+		}
+		trees = append(trees, txn.Commit())
+		models = append(models, model)
+		if i%50 == 0 {
+			for j := range trees {
+				checkContents(t, trees[j], models[j])
+			}
+		}
+	}
+	for j := range trees {
+		checkContents(t, trees[j], models[j])
+	}
+}
+
+// TestTxnIsolation 提交前修改不可见，提交后新旧两棵树各自的修改互不影响
+func TestTxnIsolation(t *testing.T) {
+	rt := NewRadixTree()
+	for _, key := range []string{"romane", "romanus", "romulus", "rubens"} {
+		rt.Insert(key, "old")
+	}
+	txn := rt.Txn()
+	txn.Insert("roman", "new")
+	txn.Delete("romulus")
+	if _, ok := rt.Search("roman"); ok {
+		t.Fatal("uncommitted insert visible in tree")
+	}
+	if v, ok := txn.Search("roman"); !ok || v != "new" {
+		t.Fatalf("txn.Search(roman) = %q, %v", v, ok)
+	}
+	next := txn.Commit()
+
+	// 直接修改旧树不能改动与新树共享的节点
+	rt.Insert("romanesque", "old")
+	rt.Delete("rubens")
+	// 提交后继续使用事务也不能改动已提交的树
+	txn.Insert("rubicon", "later")
+	txn.Delete("romane")
+
+	checkContents(t, rt, map[string]string{"romane": "old", "romanus": "old", "romulus": "old", "romanesque": "old"})
+	checkContents(t, next, map[string]string{"roman": "new", "romane": "old", "romanus": "old", "rubens": "old"})
+	checkContents(t, txn.Commit(), map[string]string{"roman": "new", "romanus": "old", "rubens": "old", "rubicon": "later"})
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWatchPrefix(t *testing.T) {
+	rt := NewRadixTree()
+	for _, key := range []string{"api/users", "api/users/1", "api/orders", "web/index"} {
+		rt.Insert(key, "")
+	}
+	api, users, web := rt.WatchPrefix("api/"), rt.WatchPrefix("api/users"), rt.WatchPrefix("web/")
+	missing, diverged := rt.WatchPrefix("static/"), rt.WatchPrefix("apx")
+
+	txn := rt.Txn()
+	txn.Insert("api/orders/7", "")
+	txn.Delete("nope")
+	if closed(api) {
+		t.Fatal("watch fired before commit")
+	}
+	next := txn.Commit()
+	if !closed(api) {
+		t.Fatal("api/ watch not fired")
+	}
+	if closed(users) || closed(web) {
+		t.Fatal("unrelated watches fired")
+	}
+	// 没有子节点以 's' 开头，只能等在根上，任何写入都会通知
+	if !closed(missing) {
+		t.Fatal("static/ watch on the root not fired")
+	}
+	// "apx" 与 "ap" 开头的节点分叉，等在该节点上，其他子树的写入不通知
+	if !closed(diverged) {
+		t.Fatal("apx watch not fired by a write under the same node")
+	}
+	diverged = next.WatchPrefix("apx")
+	txn = next.Txn()
+	txn.Insert("web/x", "")
+	next = txn.Commit()
+	if closed(diverged) {
+		t.Fatal("apx watch fired by a write under web/")
+	}
+	txn = next.Txn()
+	txn.Insert("apx/1", "")
+	next = txn.Commit()
+	if !closed(diverged) {
+		t.Fatal("apx watch not fired")
+	}
+
+	// 键不存在时等在最近的祖先上，插入它也会通知
+	missing = next.WatchPrefix("static/")
+	txn = next.Txn()
+	txn.Insert("static/app.js", "")
+	next = txn.Commit()
+	if !closed(missing) {
+		t.Fatal("static/ watch not fired")
+	}
+
+	// 直接修改立即通知，合并节点也通知等在被合并节点上的观察者
+	users = next.WatchPrefix("api/users/")
+	next.Delete("api/users")
+	if !closed(users) {
+		t.Fatal("api/users/ watch not fired by merge")
+	}
+	web = next.WatchPrefix("web")
+	if closed(web) {
+		t.Fatal("fresh watch already closed")
+	}
+	next.Insert("web/about", "")
+	if !closed(web) {
+		t.Fatal("web watch not fired by direct insert")
+	}
+}
+
+// TestTxnConcurrentReaders 一个写者不断提交，读者不加锁地读取当前版本。
+// 版本 n 恰好含有 k0..k(n-1)，count 记录 n。用 -race 运行
+func TestTxnConcurrentReaders(t *testing.T) {
+	var current atomic.Pointer[RadixTree]
+	current.Store(NewRadixTree())
+	const versions = 500
+
+	var wg sync.WaitGroup
+	var done atomic.Bool
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !done.Load() {
+				tree := current.Load()
+				v, _ := tree.Search("count")
+				var n int
+				fmt.Sscan(v, &n)
+				keys := 0
+				tree.WalkPrefix("k", func(string, string) bool {
+					keys++
+					return true
+				})
+				if keys != n {
+					t.Errorf("snapshot with count %d has %d keys", n, keys)
+					return
+				}
+				tree.WatchPrefix("k")
+			}
+		}()
+	}
+	for i := 0; i < versions; i++ {
+		txn := current.Load().Txn()
+		txn.Insert(fmt.Sprintf("k%d", i), "")
+		txn.Insert("count", fmt.Sprint(i+1))
+		current.Store(txn.Commit())
+	}
+	done.Store(true)
+	wg.Wait()
+	if keys := collect(current.Load(), "k"); len(keys) != versions {
+		t.Fatalf("final tree has %d keys", len(keys))
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"iter"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// 无锁跳表，按 Herlihy 和 Shavit《多处理器编程的艺术》中的 LockFreeSkipList 实现:
+// 插入先用 CAS 链入第 0 层再逐层向上链接；删除先从上到下给节点每一层的 next 打上删除标记
+// (逻辑删除，第 0 层打上标记的时刻即删除生效的时刻)，之后由 find 在遍历时用 CAS 摘除(物理删除)。
+// Go 的指针不能借用低位做标记，next 存放不可变的 (节点, 标记) 对，CAS 比较的是这个对的地址
+
+// markedRef 带删除标记的 next 指针
+type markedRef struct {
+	node   *cnode
+	marked bool
+}
+
+type cnode struct {
+	key   int
+	value atomic.Pointer[string]
+	next  []atomic.Pointer[markedRef]
+}
+
+func newCNode(level int, key int, value string) *cnode {
+	x := &cnode{key: key, next: make([]atomic.Pointer[markedRef], level)}
+	x.value.Store(&value)
+	for i := range x.next {
+		x.next[i].Store(&markedRef{})
+	}
+	return x
+}
+
+// casNext 当第 level 层的 next 为 (old, oldMark) 时替换成 (new, newMark)
+func (x *cnode) casNext(level int, old *cnode, oldMark bool, new *cnode, newMark bool) bool {
+	ref := x.next[level].Load()
+	return ref.node == old && ref.marked == oldMark &&
+		x.next[level].CompareAndSwap(ref, &markedRef{new, newMark})
+}
+
+// ConcurrentSkipList 可以被多个 goroutine 同时读写的跳表，所有操作都不加锁。
+// Insert、Delete、Search 是可线性化的，Len 和 All 只反映某个时刻前后的近似状态
+type ConcurrentSkipList struct {
+	head   *cnode       // 哨兵节点，不存键
+	level  atomic.Int32 // 用到过的最高层数，查找从这一层开始，只增不减
+	seed   atomic.Uint64
+	length atomic.Int64
+}
+
+// concurrentMaxLevel 节点层数的上限，按概率 1/2 足够容纳百万量级的键。
+// 无锁跳表不便在运行中扩大头节点，层数固定
+const concurrentMaxLevel = 20
+
+// NewConcurrentSkipList seed 决定节点层数的随机序列，为 0 时取当前时间
+func NewConcurrentSkipList(seed uint64) *ConcurrentSkipList {
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	csl := &ConcurrentSkipList{head: newCNode(concurrentMaxLevel, 0, "")}
+	csl.level.Store(1)
+	csl.seed.Store(seed)
+	return csl
+}
+
+// randomLevel 用 splitmix64 生成随机数，状态只有一个原子计数器，并发调用不需要加锁。
+// 每升一层的概率为 1/2，即 Probability
+func (csl *ConcurrentSkipList) randomLevel() int {
+	z := csl.seed.Add(0x9e3779b97f4a7c15)
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return min(bits.TrailingZeros64(z)+1, concurrentMaxLevel)
+}
+
+// raiseLevel 把用到过的最高层数提高到 level
+func (csl *ConcurrentSkipList) raiseLevel(level int) {
+	for {
+		cur := csl.level.Load()
+		if int32(level) <= cur || csl.level.CompareAndSwap(cur, int32(level)) {
+			return
+		}
+	}
+}
+
+// Len 节点数
+func (csl *ConcurrentSkipList) Len() int {
+	return int(csl.length.Load())
+}
+
+// find 找出每一层 key 的前驱和后继，途中摘除已被逻辑删除的节点。
+// 摘除失败说明前驱也在变化，从头重来。返回第 0 层的后继是否就是 key。
+// 高于 level 的层当作是空的: 插入在查找前已经把自己的层数计入 level，只会在这些层之下链接
+func (csl *ConcurrentSkipList) find(key int, preds, succs *[concurrentMaxLevel]*cnode) bool {
+retry:
+	pred := csl.head
+	var curr *cnode
+	top := int(csl.level.Load())
+	for i := top; i < concurrentMaxLevel; i++ {
+		preds[i], succs[i] = csl.head, nil
+	}
+	for i := top - 1; i >= 0; i-- {
+		curr = pred.next[i].Load().node
+		for curr != nil {
+			ref := curr.next[i].Load()
+			for ref.marked {
+				if !pred.casNext(i, curr, false, ref.node, false) {
+					goto retry
+				}
+				if curr = ref.node; curr == nil {
+					break
+				}
+				ref = curr.next[i].Load()
+			}
+			if curr == nil || curr.key >= key {
+				break
+			}
+			pred, curr = curr, ref.node
+		}
+		preds[i], succs[i] = pred, curr
+	}
+	return curr != nil && curr.key == key
+}
+
+// Insert 插入或更新 key，返回是否新插入
+func (csl *ConcurrentSkipList) Insert(key int, value string) bool {
+	var preds, succs [concurrentMaxLevel]*cnode
+	level := csl.randomLevel()
+	csl.raiseLevel(level)
+	for {
+		if csl.find(key, &preds, &succs) {
+			// 与并发的删除相比，更新排在删除之前
+			succs[0].value.Store(&value)
+			return false
+		}
+		x := newCNode(level, key, value)
+		for i := 0; i < level; i++ {
+			x.next[i].Store(&markedRef{node: succs[i]})
+		}
+		// 链入第 0 层即插入生效
+		if !preds[0].casNext(0, succs[0], false, x, false) {
+			continue
+		}
+		csl.length.Add(1)
+		for i := 1; i < level; i++ {
+			for {
+				ref := x.next[i].Load()
+				// 已经被并发删除，不再链接更高的层
+				if ref.marked {
+					return true
+				}
+				if ref.node != succs[i] && !x.casNext(i, ref.node, false, succs[i], false) {
+					continue
+				}
+				if preds[i].casNext(i, succs[i], false, x, false) {
+					break
+				}
+				csl.find(key, &preds, &succs)
+			}
+		}
+		return true
+	}
+}
+
+// Delete 删除 key，返回是否由本次调用删除
+func (csl *ConcurrentSkipList) Delete(key int) bool {
+	var preds, succs [concurrentMaxLevel]*cnode
+	if !csl.find(key, &preds, &succs) {
+		return false
+	}
+	victim := succs[0]
+	for i := len(victim.next) - 1; i >= 1; i-- {
+		for ref := victim.next[i].Load(); !ref.marked; ref = victim.next[i].Load() {
+			victim.casNext(i, ref.node, false, ref.node, true)
+		}
+	}
+	for {
+		ref := victim.next[0].Load()
+		if ref.marked {
+			// 被别的 goroutine 抢先删除
+			return false
+		}
+		if victim.casNext(0, ref.node, false, ref.node, true) {
+			csl.length.Add(-1)
+			csl.find(key, &preds, &succs) // 物理删除
+			return true
+		}
+	}
+}
+
+// Search 查找 key，只读不写，跳过已被逻辑删除的节点
+func (csl *ConcurrentSkipList) Search(key int) (string, bool) {
+	pred := csl.head
+	var curr *cnode
+	for i := int(csl.level.Load()) - 1; i >= 0; i-- {
+		curr = pred.next[i].Load().node
+		for curr != nil {
+			ref := curr.next[i].Load()
+			for ref.marked && ref.node != nil {
+				curr = ref.node
+				ref = curr.next[i].Load()
+			}
+			if ref.marked || curr.key >= key {
+				break
+			}
+			pred, curr = curr, ref.node
+		}
+	}
+	if curr == nil || curr.key != key || curr.next[0].Load().marked {
+		return "", false
+	}
+	return *curr.value.Load(), true
+}
+
+// All 按键升序遍历第 0 层上没有被删除的节点，遍历期间的并发修改可能看得到也可能看不到
+func (csl *ConcurrentSkipList) All() iter.Seq2[int, string] {
+	return func(yield func(int, string) bool) {
+		for x := csl.head.next[0].Load().node; x != nil; {
+			ref := x.next[0].Load()
+			if !ref.marked && !yield(x.key, *x.value.Load()) {
+				return
+			}
+			x = ref.node
+		}
+	}
+}
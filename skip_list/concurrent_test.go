@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// checkConcurrent 在没有并发操作时校验结构: 每一层按键严格升序，
+// 第 0 层上没有删除标记的节点与 model 一致，更高层的节点都在第 0 层上
+func checkConcurrent(t *testing.T, csl *ConcurrentSkipList, model map[int]string) {
+	t.Helper()
+	live := make(map[*cnode]bool)
+	got := make(map[int]string)
+	for x := csl.head.next[0].Load().node; x != nil; x = x.next[0].Load().node {
+		if !x.next[0].Load().marked {
+			live[x] = true
+			got[x.key] = *x.value.Load()
+		}
+	}
+	if !maps.Equal(got, model) || csl.Len() != len(model) {
+		t.Fatalf("contents %v (Len %d), want %v", got, csl.Len(), model)
+	}
+	for i := concurrentMaxLevel - 1; i >= 0; i-- {
+		var prev *cnode
+		for x := csl.head.next[i].Load().node; x != nil; x = x.next[i].Load().node {
+			if x.next[0].Load().marked {
+				continue
+			}
+			if prev != nil && x.key <= prev.key || !live[x] {
+				t.Fatalf("level %d: node %d out of order or not on level 0", i, x.key)
+			}
+			prev = x
+		}
+	}
+}
+
+// TestConcurrentSequential 单个 goroutine 下与 map 对照
+func TestConcurrentSequential(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	csl := NewConcurrentSkipList(1)
+	model := make(map[int]string)
+	for i := 0; i < 5000; i++ {
+		key := rng.Intn(200) - 100 // 负数键也可以
+		_, exists := model[key]
+		if rng.Intn(3) == 0 {
+			if got := csl.Delete(key); got != exists {
+				t.Fatalf("Delete(%d) = %v, want %v", key, got, exists)
+			}
+			delete(model, key)
+		} else {
+			value := fmt.Sprint(i)
+			if got := csl.Insert(key, value); got == exists {
+				t.Fatalf("Insert(%d) = %v, want %v", key, got, !exists)
+			}
+			model[key] = value
+		}
+		want, wantOK := model[key]
+		if got, ok := csl.Search(key); got != want || ok != wantOK {
+			t.Fatalf("Search(%d) = %q, %v; want %q, %v", key, got, ok, want, wantOK)
+		}
+	}
+	checkConcurrent(t, csl, model)
+	keys := slices.Sorted(maps.Keys(model))
+	var got []int
+	for key := range csl.All() {
+		got = append(got, key)
+	}
+	if !slices.Equal(got, keys) {
+		t.Fatalf("All() = %v, want %v", got, keys)
+	}
+}
+
+// TestConcurrentStress 多个 goroutine 各自读写互不相交的键，结束后与各自的 map 合并对照
+func TestConcurrentStress(t *testing.T) {
+	const workers, ops = 8, 3000
+	csl := NewConcurrentSkipList(0)
+	models := make([]map[int]string, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		models[w] = make(map[int]string)
+		wg.Add(1)
+		go func(model map[int]string) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < ops; i++ {
+				key := rng.Intn(100)*workers + w
+				_, exists := model[key]
+				if rng.Intn(2) == 0 {
+					if csl.Delete(key) != exists {
+						t.Errorf("Delete(%d) = %v", key, !exists)
+						return
+					}
+					delete(model, key)
+				} else {
+					value := fmt.Sprint(w, i)
+					if csl.Insert(key, value) == exists {
+						t.Errorf("Insert(%d) = %v", key, exists)
+						return
+					}
+					model[key] = value
+				}
+				if got, ok := csl.Search(key); got != model[key] {
+					t.Errorf("Search(%d) = %q, %v; want %q", key, got, ok, model[key])
+					return
+				}
+			}
+		}(models[w])
+	}
+	wg.Wait()
+	all := make(map[int]string)
+	for _, model := range models {
+		maps.Copy(all, model)
+	}
+	checkConcurrent(t, csl, all)
+}
+
+// 操作的种类
+const (
+	opInsert = iota
+	opDelete
+	opSearch
+)
+
+// histOp 历史中的一次操作: 调用和返回的时间戳来自同一个原子时钟
+type histOp struct {
+	kind      int
+	value     string // Insert 写入的值或 Search 读到的值
+	ok        bool
+	call, ret int64
+}
+
+// keyState 单个键的顺序规格: 是否存在及其值
+type keyState struct {
+	present bool
+	value   string
+}
+
+// apply 在状态 s 上按顺序执行 op，返回 op 的结果是否与规格相符以及之后的状态
+func (s keyState) apply(op histOp) (keyState, bool) {
+	switch op.kind {
+	case opInsert:
+		return keyState{true, op.value}, op.ok == !s.present
+	case opDelete:
+		return keyState{}, op.ok == s.present
+	default:
+		return s, op.ok == s.present && (!op.ok || op.value == s.value)
+	}
+}
+
+// linearizable 用 Wing 和 Gong 的回溯搜索判断单个键的历史是否可线性化:
+// 每一步从尚未线性化的操作中选一个在所有未完成操作返回之前就已调用的，
+// 已经搜索过的 (已线性化集合, 状态) 组合不再重复
+func linearizable(ops []histOp) bool {
+	sort.Slice(ops, func(i, j int) bool { return ops[i].call < ops[j].call })
+	type memoKey struct {
+		done  uint64
+		state keyState
+	}
+	seen := make(map[memoKey]bool)
+	all := uint64(1)<<len(ops) - 1
+	var search func(done uint64, s keyState) bool
+	search = func(done uint64, s keyState) bool {
+		if done == all {
+			return true
+		}
+		if seen[memoKey{done, s}] {
+			return false
+		}
+		seen[memoKey{done, s}] = true
+		minRet := int64(1<<63 - 1)
+		for i, op := range ops {
+			if done&(1<<i) == 0 {
+				minRet = min(minRet, op.ret)
+			}
+		}
+		for i, op := range ops {
+			if done&(1<<i) != 0 || op.call > minRet {
+				continue
+			}
+			if next, ok := s.apply(op); ok && search(done|1<<i, next) {
+				return true
+			}
+		}
+		return false
+	}
+	return search(0, keyState{})
+}
+
+// TestConcurrentLinearizable 多个 goroutine 对少量的键随机读写并记录历史，
+// 按键分别检查可线性化(可线性化是局部性质，各个键的历史都可线性化则整体可线性化)。
+// 每一轮换用新的键，单个键的历史不超过 64 个操作。
+// 只有一个 CPU 时操作很少真正重叠，可以用 -cpu 4 -race 多跑几次
+func TestConcurrentLinearizable(t *testing.T) {
+	const workers, keys, opsPerWorker, rounds = 4, 2, 16, 200
+	csl := NewConcurrentSkipList(0)
+	var clock atomic.Int64
+	for round := range rounds {
+		histories := make([][][]histOp, workers)
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for w := range workers {
+			histories[w] = make([][]histOp, keys)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start // 同时开始，尽量让操作重叠
+				rng := rand.New(rand.NewSource(int64(round*workers + w)))
+				for i := 0; i < opsPerWorker; i++ {
+					k := rng.Intn(keys)
+					key := round*keys + k
+					op := histOp{kind: rng.Intn(3), call: clock.Add(1)}
+					switch op.kind {
+					case opInsert:
+						op.value = fmt.Sprintf("%d-%d", w, i)
+						op.ok = csl.Insert(key, op.value)
+					case opDelete:
+						op.ok = csl.Delete(key)
+					default:
+						op.value, op.ok = csl.Search(key)
+					}
+					op.ret = clock.Add(1)
+					histories[w][k] = append(histories[w][k], op)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		for k := range keys {
+			var ops []histOp
+			for w := range workers {
+				ops = append(ops, histories[w][k]...)
+			}
+			if len(ops) > 64 {
+				t.Fatalf("round %d key %d: %d operations, at most 64", round, k, len(ops))
+			}
+			if !linearizable(ops) {
+				t.Fatalf("round %d key %d: history not linearizable: %+v", round, k, ops)
+			}
+		}
+	}
+}
+
+// TestLinearizableChecker 检查器本身能识别出不可线性化的历史
+func TestLinearizableChecker(t *testing.T) {
+	// 插入已经返回之后，后开始的查找没有看到
+	bad := []histOp{
+		{kind: opInsert, value: "a", ok: true, call: 1, ret: 2},
+		{kind: opSearch, ok: false, call: 3, ret: 4},
+	}
+	if linearizable(bad) {
+		t.Fatal("stale read accepted")
+	}
+	// 两个并发的删除不能都成功
+	bad = []histOp{
+		{kind: opInsert, value: "a", ok: true, call: 1, ret: 2},
+		{kind: opDelete, ok: true, call: 3, ret: 6},
+		{kind: opDelete, ok: true, call: 4, ret: 5},
+	}
+	if linearizable(bad) {
+		t.Fatal("double delete accepted")
+	}
+	// 与插入重叠的查找看到或看不到都可以
+	for _, found := range []bool{true, false} {
+		good := []histOp{
+			{kind: opInsert, value: "a", ok: true, call: 1, ret: 4},
+			{kind: opSearch, value: map[bool]string{true: "a"}[found], ok: found, call: 2, ret: 3},
+		}
+		if !linearizable(good) {
+			t.Fatalf("overlapping search (found %v) rejected", found)
+		}
+	}
+}
+
+// lockedSkipList 用读写锁保护的 SkipList，作为基准测试的对照
+type lockedSkipList struct {
+	mu sync.RWMutex
+	sl *SkipList[int, string]
+}
+
+func (l *lockedSkipList) Insert(key int, value string) {
+	l.mu.Lock()
+	l.sl.Insert(key, value)
+	l.mu.Unlock()
+}
+
+func (l *lockedSkipList) Delete(key int) {
+	l.mu.Lock()
+	l.sl.Delete(key)
+	l.mu.Unlock()
+}
+
+func (l *lockedSkipList) Search(key int) (string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sl.Search(key)
+}
+
+// benchSkipList 并发执行 readPct% 的查找，其余一半插入一半删除
+func benchSkipList(b *testing.B, readPct int, insert func(int, string), del func(int), search func(int) (string, bool)) {
+	const keys = 1 << 10
+	for i := 0; i < keys; i += 2 {
+		insert(i, "v")
+	}
+	var seed atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(seed.Add(1)))
+		for pb.Next() {
+			key := rng.Intn(keys)
+			switch n := rng.Intn(100); {
+			case n < readPct:
+				search(key)
+			case n < readPct+(100-readPct)/2:
+				insert(key, "v")
+			default:
+				del(key)
+			}
+		}
+	})
+}
+
+func BenchmarkSkipListConcurrency(b *testing.B) {
+	for _, readPct := range []int{100, 90, 50} {
+		b.Run(fmt.Sprintf("lockfree/read%d", readPct), func(b *testing.B) {
+			csl := NewConcurrentSkipList(1)
+			benchSkipList(b, readPct, func(k int, v string) { csl.Insert(k, v) }, func(k int) { csl.Delete(k) }, csl.Search)
+		})
+		b.Run(fmt.Sprintf("mutex/read%d", readPct), func(b *testing.B) {
+			l := &lockedSkipList{sl: NewSkipList()}
+			benchSkipList(b, readPct, l.Insert, l.Delete, l.Search)
+		})
+	}
+}
@@ -1,90 +1,209 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"iter"
+	"math"
 	"math/rand"
 	"time"
 )
 
 const (
-	MaxLevel    = 6   // 跳表最大层数
-	Probability = 0.5 // 每升一层的概率
+	Probability     = 0.5 // 默认每升一层的概率
+	defaultExpected = 32  // 没有给出期望大小时按这么多节点确定初始的最大层数
+	maxLevelLimit   = 64  // 最大层数的上限
 )
 
-type Node struct {
-	key   int
-	value string
-	next  []*Node // 每一层的 next 指针
+type Node[K, V any] struct {
+	key   K
+	value V
+	next  []*Node[K, V] // 每一层的 next 指针
+	span  []int         // 每一层到 next 跨过的节点数(含 next 本身)，next 为空时是到表尾剩余的节点数
+	prev  *Node[K, V]   // 第 0 层的前驱，第一个节点的 prev 为空，用于反向遍历
 }
 
-type SkipList struct {
-	head  *Node
-	level int
+// SkipList 按 cmp 排序的跳表。头节点是哨兵，只用它的 next 和 span，不占用任何键
+type SkipList[K, V any] struct {
+	head     *Node[K, V]
+	tail     *Node[K, V]
+	level    int // 当前用到的层数
+	maxLevel int // 节点层数的上限，随节点数增长
+	length   int
+	cmp      func(a, b K) int
+	p        float64
+	rng      *rand.Rand // 每个跳表自己的层数随机数，不共享全局的
+
+	// findLess 的结果，长度为 maxLevel，复用以免每次操作都分配
+	update []*Node[K, V]
+	rank   []int
 }
 
-func NewNode(level int, key int, value string) *Node {
-	return &Node{
-		key:   key,
-		value: value,
-		next:  make([]*Node, level),
+// Entry 跳表中的一个键值
+type Entry[K, V any] struct {
+	Key   K
+	Value V
+}
+
+type options struct {
+	p        float64
+	expected int
+	seed     int64
+}
+
+// Option 配置 New 创建的跳表
+type Option func(o *options)
+
+// WithProbability 设置每升一层的概率，不在 (0, 1) 内时使用默认的 Probability。
+// p 越小层数越少、占用内存越少，查找要比较的次数越多
+func WithProbability(p float64) Option {
+	return func(o *options) {
+		o.p = p
+	}
+}
+
+// WithExpectedSize 按期望的节点数确定初始的最大层数，节点数超出后最大层数仍会增长
+func WithExpectedSize(n int) Option {
+	return func(o *options) {
+		o.expected = n
+	}
+}
+
+// WithSeed 设置层数随机数的种子，相同的种子和操作序列得到相同的结构，默认取当前时间
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = seed
 	}
 }
 
-func NewSkipList() *SkipList {
-	rand.NewSource(time.Now().UnixNano())
-	return &SkipList{
-		head:  NewNode(MaxLevel, -1, ""), // head 为哨兵节点
+// NewSkipList 创建以 int 为键、string 为值的跳表
+func NewSkipList() *SkipList[int, string] {
+	return New[int, string](cmp.Compare[int])
+}
+
+// New 创建跳表，键按 compare 排序
+func New[K, V any](compare func(a, b K) int, opts ...Option) *SkipList[K, V] {
+	o := options{p: Probability, expected: defaultExpected, seed: time.Now().UnixNano()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !(o.p > 0 && o.p < 1) {
+		o.p = Probability
+	}
+	sl := &SkipList[K, V]{
+		head:  &Node[K, V]{},
 		level: 1,
+		cmp:   compare,
+		p:     o.p,
+		rng:   rand.New(rand.NewSource(o.seed)),
+	}
+	sl.grow(levelFor(max(o.expected, defaultExpected), o.p))
+	return sl
+}
+
+// levelFor 容纳 n 个节点合适的最大层数 log_{1/p}(n)
+func levelFor(n int, p float64) int {
+	level := int(math.Ceil(math.Log(float64(n)) / math.Log(1/p)))
+	return min(max(level, 1), maxLevelLimit)
+}
+
+// grow 把最大层数提高到 level，头节点新增的层在 Insert 用到时再设置跨度
+func (sl *SkipList[K, V]) grow(level int) {
+	for sl.maxLevel < level {
+		sl.head.next = append(sl.head.next, nil)
+		sl.head.span = append(sl.head.span, 0)
+		sl.update = append(sl.update, nil)
+		sl.rank = append(sl.rank, 0)
+		sl.maxLevel++
+	}
+}
+
+func NewNode[K, V any](level int, key K, value V) *Node[K, V] {
+	return &Node[K, V]{
+		key:   key,
+		value: value,
+		next:  make([]*Node[K, V], level),
+		span:  make([]int, level),
 	}
 }
 
 // 随机生成节点的层数
-func randomLevel() int {
+func (sl *SkipList[K, V]) randomLevel() int {
 	level := 1
-	for rand.Float64() < Probability && level < MaxLevel {
+	for sl.rng.Float64() < sl.p && level < sl.maxLevel {
 		level++
 	}
 	return level
 }
 
+// Len 节点数
+func (sl *SkipList[K, V]) Len() int {
+	return sl.length
+}
+
 // 查找 key
-func (sl *SkipList) Search(key int) (string, bool) {
+func (sl *SkipList[K, V]) Search(key K) (V, bool) {
 	curr := sl.head
 	for i := sl.level - 1; i >= 0; i-- {
-		for curr.next[i] != nil && curr.next[i].key < key {
+		for curr.next[i] != nil && sl.cmp(curr.next[i].key, key) < 0 {
 			curr = curr.next[i]
 		}
 	}
 	curr = curr.next[0]
-	if curr != nil && curr.key == key {
+	if curr != nil && sl.cmp(curr.key, key) == 0 {
 		return curr.value, true
 	}
-	return "", false
+	var zero V
+	return zero, false
 }
 
-// 插入 key-value
-func (sl *SkipList) Insert(key int, value string) {
-	update := make([]*Node, MaxLevel)
+// findLess 找出每一层最后一个键小于 key 的节点，rank[i] 为 update[i] 的排名(头节点为 0)。
+// 返回的切片是 sl 复用的，下一次调用前有效
+func (sl *SkipList[K, V]) findLess(key K) (update []*Node[K, V], rank []int) {
+	update, rank = sl.update, sl.rank
 	curr := sl.head
-
-	// 记录每一层应该更新的前驱节点
 	for i := sl.level - 1; i >= 0; i-- {
-		for curr.next[i] != nil && curr.next[i].key < key {
+		rank[i] = 0
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for curr.next[i] != nil && sl.cmp(curr.next[i].key, key) < 0 {
+			rank[i] += curr.span[i]
 			curr = curr.next[i]
 		}
 		update[i] = curr
 	}
+	return update, rank
+}
+
+// seek 返回第一个 before 为假的节点，before 须对升序的键先真后假
+func (sl *SkipList[K, V]) seek(before func(key K) bool) *Node[K, V] {
+	curr := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for curr.next[i] != nil && before(curr.next[i].key) {
+			curr = curr.next[i]
+		}
+	}
+	return curr.next[0]
+}
+
+// 插入 key-value
+func (sl *SkipList[K, V]) Insert(key K, value V) {
+	// 记录每一层应该更新的前驱节点和它们的排名
+	update, rank := sl.findLess(key)
 
 	// 如果 key 已存在，则更新
-	if curr.next[0] != nil && curr.next[0].key == key {
-		curr.next[0].value = value
+	if next := update[0].next[0]; next != nil && sl.cmp(next.key, key) == 0 {
+		next.value = value
 		return
 	}
 
-	newLevel := randomLevel()
+	newLevel := sl.randomLevel()
 	if newLevel > sl.level {
 		for i := sl.level; i < newLevel; i++ {
+			rank[i] = 0
 			update[i] = sl.head
+			update[i].span[i] = sl.length
 		}
 		sl.level = newLevel
 	}
@@ -93,48 +212,196 @@ func (sl *SkipList) Insert(key int, value string) {
 	for i := 0; i < newLevel; i++ {
 		newNode.next[i] = update[i].next[i]
 		update[i].next[i] = newNode
+		// update[i] 与新节点之间隔着 rank[0]-rank[i] 个节点
+		newNode.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = rank[0] - rank[i] + 1
+	}
+	// 更高层的指针跨过了新节点
+	for i := newLevel; i < sl.level; i++ {
+		update[i].span[i]++
 	}
-}
 
-// 删除节点
-func (sl *SkipList) Delete(key int) bool {
-	update := make([]*Node, MaxLevel)
-	curr := sl.head
-	for i := sl.level - 1; i >= 0; i-- {
-		for curr.next[i] != nil && curr.next[i].key < key {
-			curr = curr.next[i]
-		}
-		update[i] = curr
+	if update[0] != sl.head {
+		newNode.prev = update[0]
+	}
+	if newNode.next[0] != nil {
+		newNode.next[0].prev = newNode
+	} else {
+		sl.tail = newNode
 	}
+	sl.length++
+	sl.grow(levelFor(sl.length, sl.p))
+}
 
-	target := curr.next[0]
-	if target == nil || target.key != key {
+// 删除节点
+func (sl *SkipList[K, V]) Delete(key K) bool {
+	update, _ := sl.findLess(key)
+	target := update[0].next[0]
+	if target == nil || sl.cmp(target.key, key) != 0 {
 		return false
 	}
+	sl.deleteNode(target, update)
+	return true
+}
 
+// deleteNode 摘除节点 x，update 是各层 x 之前的节点
+func (sl *SkipList[K, V]) deleteNode(x *Node[K, V], update []*Node[K, V]) {
 	for i := 0; i < sl.level; i++ {
-		if update[i].next[i] != target {
-			break
+		if update[i].next[i] == x {
+			update[i].span[i] += x.span[i] - 1
+			update[i].next[i] = x.next[i]
+		} else {
+			update[i].span[i]--
 		}
-		update[i].next[i] = target.next[i]
+	}
+	if x.next[0] != nil {
+		x.next[0].prev = x.prev
+	} else {
+		sl.tail = x.prev
 	}
 
 	// 如果最高层没有节点了，降低 level
 	for sl.level > 1 && sl.head.next[sl.level-1] == nil {
 		sl.level--
 	}
+	sl.length--
+}
 
-	return true
+// Rank 返回 key 的排名，从 0 开始
+func (sl *SkipList[K, V]) Rank(key K) (int, bool) {
+	curr := sl.head
+	rank := 0
+	for i := sl.level - 1; i >= 0; i-- {
+		for curr.next[i] != nil && sl.cmp(curr.next[i].key, key) <= 0 {
+			rank += curr.span[i]
+			curr = curr.next[i]
+		}
+		if curr != sl.head && sl.cmp(curr.key, key) == 0 {
+			return rank - 1, true
+		}
+	}
+	return 0, false
+}
+
+// nodeByRank 返回排名为 rank(从 0 开始)的节点，越界时返回 nil
+func (sl *SkipList[K, V]) nodeByRank(rank int) *Node[K, V] {
+	if rank < 0 || rank >= sl.length {
+		return nil
+	}
+	curr := sl.head
+	traversed := 0
+	for i := sl.level - 1; i >= 0; i-- {
+		for curr.next[i] != nil && traversed+curr.span[i] <= rank+1 {
+			traversed += curr.span[i]
+			curr = curr.next[i]
+		}
+		if traversed == rank+1 {
+			return curr
+		}
+	}
+	return nil
+}
+
+// ByRank 返回排名为 rank(从 0 开始)的键值
+func (sl *SkipList[K, V]) ByRank(rank int) (Entry[K, V], bool) {
+	if node := sl.nodeByRank(rank); node != nil {
+		return Entry[K, V]{node.key, node.value}, true
+	}
+	return Entry[K, V]{}, false
+}
+
+// RangeByScore 按键升序返回键在 [min, max] 中的键值
+func (sl *SkipList[K, V]) RangeByScore(min, max K) []Entry[K, V] {
+	update, _ := sl.findLess(min)
+	var entries []Entry[K, V]
+	for x := update[0].next[0]; x != nil && sl.cmp(x.key, max) <= 0; x = x.next[0] {
+		entries = append(entries, Entry[K, V]{x.key, x.value})
+	}
+	return entries
+}
+
+// rankRange 按 Redis 的规则把可能为负(从尾部数)的闭区间 [start, stop] 换成有效的排名，区间为空时 ok 为 false
+func (sl *SkipList[K, V]) rankRange(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += sl.length
+	}
+	if stop < 0 {
+		stop += sl.length
+	}
+	start = max(start, 0)
+	stop = min(stop, sl.length-1)
+	return start, stop, start <= stop
+}
+
+// RangeByRank 按键升序返回排名在 [start, stop] 中的键值，负数表示从尾部数，-1 为最后一个
+func (sl *SkipList[K, V]) RangeByRank(start, stop int) []Entry[K, V] {
+	start, stop, ok := sl.rankRange(start, stop)
+	if !ok {
+		return nil
+	}
+	entries := make([]Entry[K, V], 0, stop-start+1)
+	for x := sl.nodeByRank(start); len(entries) < cap(entries); x = x.next[0] {
+		entries = append(entries, Entry[K, V]{x.key, x.value})
+	}
+	return entries
+}
+
+// RevRangeByRank 按键降序排名，返回排名在 [start, stop] 中的键值，如取排行榜前十为 RevRangeByRank(0, 9)
+func (sl *SkipList[K, V]) RevRangeByRank(start, stop int) []Entry[K, V] {
+	start, stop, ok := sl.rankRange(start, stop)
+	if !ok {
+		return nil
+	}
+	entries := make([]Entry[K, V], 0, stop-start+1)
+	for x := sl.nodeByRank(sl.length - 1 - start); len(entries) < cap(entries); x = x.prev {
+		entries = append(entries, Entry[K, V]{x.key, x.value})
+	}
+	return entries
+}
+
+// DeleteRange 删除键在 [min, max] 中的节点，返回删除的个数
+func (sl *SkipList[K, V]) DeleteRange(min, max K) int {
+	update, _ := sl.findLess(min)
+	n := 0
+	for x := update[0].next[0]; x != nil && sl.cmp(x.key, max) <= 0; {
+		next := x.next[0]
+		sl.deleteNode(x, update)
+		x = next
+		n++
+	}
+	return n
+}
+
+// All 按键升序遍历
+func (sl *SkipList[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for x := sl.head.next[0]; x != nil; x = x.next[0] {
+			if !yield(x.key, x.value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward 按键降序遍历
+func (sl *SkipList[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for x := sl.tail; x != nil; x = x.prev {
+			if !yield(x.key, x.value) {
+				return
+			}
+		}
+	}
 }
 
 // 打印结构（从高层到底层）
-func (sl *SkipList) Print() {
+func (sl *SkipList[K, V]) Print() {
 	fmt.Println("\n--- SkipList Structure ---")
 	for i := sl.level - 1; i >= 0; i-- {
 		curr := sl.head
 		fmt.Printf("Level %d: ", i)
 		for curr.next[i] != nil {
-			fmt.Printf("%d:%s → ", curr.next[i].key, curr.next[i].value)
+			fmt.Printf("%v:%v → ", curr.next[i].key, curr.next[i].value)
 			curr = curr.next[i]
 		}
 		fmt.Println("NULL")
@@ -161,4 +428,16 @@ func main() {
 
 	skipList.Delete(3)
 	skipList.Print()
+
+	rank, _ := skipList.Rank(4)
+	fmt.Printf("Rank(4) = %d, top 2 = %v\n", rank, skipList.RevRangeByRank(0, 1))
+	for key, value := range skipList.Backward() {
+		fmt.Printf("%d:%s ", key, value)
+	}
+	fmt.Println()
+
+	zset := NewSortedSet()
+	zset.ZAdd(ZAddOptions{}, ZMember{"alice", 10}, ZMember{"bob", 20}, ZMember{"carol", 10})
+	zset.ZAdd(ZAddOptions{GT: true}, ZMember{"alice", 5}, ZMember{"bob", 30})
+	fmt.Println(zset.ZRange(0, -1, false))
 }
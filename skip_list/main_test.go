@@ -0,0 +1,300 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// checkSpans 校验每一层的 span 等于到 next 之间实际的节点数，prev、tail 与第 0 层一致
+func checkSpans[K, V any](t *testing.T, sl *SkipList[K, V]) {
+	t.Helper()
+	pos := map[*Node[K, V]]int{sl.head: 0}
+	var last *Node[K, V]
+	for x, i := sl.head.next[0], 1; x != nil; x, i = x.next[0], i+1 {
+		pos[x] = i
+		if x.prev != last {
+			t.Fatalf("node %v: wrong prev", x.key)
+		}
+		last = x
+	}
+	if sl.tail != last || len(pos)-1 != sl.length {
+		t.Fatalf("tail or length out of sync: length %d, %d nodes", sl.length, len(pos)-1)
+	}
+	for i := 0; i < sl.level; i++ {
+		for x := sl.head; x != nil; x = x.next[i] {
+			want := sl.length - pos[x]
+			if x.next[i] != nil {
+				want = pos[x.next[i]] - pos[x]
+			}
+			if x.span[i] != want {
+				t.Fatalf("level %d node %v: span %d, want %d", i, x.key, x.span[i], want)
+			}
+		}
+	}
+}
+
+// TestSkipListRandom 随机增删，与排好序的 map 对照排名和范围查询
+func TestSkipListRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sl := NewSkipList()
+	model := make(map[int]string)
+	for step := 0; step < 5000; step++ {
+		key := rng.Intn(300)
+		switch op := rng.Intn(10); {
+		case op < 5:
+			value := fmt.Sprint(step)
+			sl.Insert(key, value)
+			model[key] = value
+		case op < 9:
+			_, exists := model[key]
+			if got := sl.Delete(key); got != exists {
+				t.Fatalf("step %d: Delete(%d) = %v, want %v", step, key, got, exists)
+			}
+			delete(model, key)
+		default:
+			hi := key + rng.Intn(20)
+			n := 0
+			for k := range model {
+				if k >= key && k <= hi {
+					delete(model, k)
+					n++
+				}
+			}
+			if got := sl.DeleteRange(key, hi); got != n {
+				t.Fatalf("step %d: DeleteRange(%d, %d) = %d, want %d", step, key, hi, got, n)
+			}
+		}
+		if step%50 != 0 {
+			continue
+		}
+		checkSpans(t, sl)
+
+		keys := slices.Sorted(maps.Keys(model))
+		entries := make([]Entry[int, string], len(keys))
+		for i, k := range keys {
+			entries[i] = Entry[int, string]{k, model[k]}
+		}
+		for i, e := range entries {
+			if r, ok := sl.Rank(e.Key); !ok || r != i {
+				t.Fatalf("Rank(%d) = %d, %v; want %d", e.Key, r, ok, i)
+			}
+			if got, ok := sl.ByRank(i); !ok || got != e {
+				t.Fatalf("ByRank(%d) = %v, %v; want %v", i, got, ok, e)
+			}
+		}
+		if _, ok := sl.Rank(-5); ok {
+			t.Fatal("Rank of missing key found")
+		}
+		if _, ok := sl.ByRank(len(entries)); ok {
+			t.Fatal("ByRank past the end found")
+		}
+
+		lo, hi := rng.Intn(300), rng.Intn(300)
+		var want []Entry[int, string]
+		for _, e := range entries {
+			if e.Key >= lo && e.Key <= hi {
+				want = append(want, e)
+			}
+		}
+		if got := sl.RangeByScore(lo, hi); !slices.Equal(got, want) {
+			t.Fatalf("RangeByScore(%d, %d) = %v, want %v", lo, hi, got, want)
+		}
+
+		start, stop := rng.Intn(40)-20, rng.Intn(40)-20
+		want = redisRange(entries, start, stop)
+		if got := sl.RangeByRank(start, stop); !slices.Equal(got, want) {
+			t.Fatalf("RangeByRank(%d, %d) = %v, want %v", start, stop, got, want)
+		}
+		reversed := slices.Clone(entries)
+		slices.Reverse(reversed)
+		want = redisRange(reversed, start, stop)
+		if got := sl.RevRangeByRank(start, stop); !slices.Equal(got, want) {
+			t.Fatalf("RevRangeByRank(%d, %d) = %v, want %v", start, stop, got, want)
+		}
+
+		var forward, backward []Entry[int, string]
+		for k, v := range sl.All() {
+			forward = append(forward, Entry[int, string]{k, v})
+		}
+		for k, v := range sl.Backward() {
+			backward = append(backward, Entry[int, string]{k, v})
+		}
+		if !slices.Equal(forward, entries) || !slices.Equal(backward, reversed) {
+			t.Fatalf("iteration out of order")
+		}
+	}
+}
+
+// redisRange 按 ZRANGE 的规则取 entries 的 [start, stop]
+func redisRange(entries []Entry[int, string], start, stop int) []Entry[int, string] {
+	n := len(entries)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start, stop = max(start, 0), min(stop, n-1)
+	if start > stop {
+		return nil
+	}
+	return entries[start : stop+1]
+}
+
+// slOp 一次随机操作，Kind 为 0 插入、1 删除、2 删除 [Key, Key2] 的区间
+type slOp struct {
+	Kind      int
+	Key, Key2 int
+	Value     string
+}
+
+// slOps 随机操作序列。键集中在 -1 附近并夹杂 int 的两端，覆盖原来哨兵占用的 -1
+type slOps []slOp
+
+func (slOps) Generate(rng *rand.Rand, size int) reflect.Value {
+	key := func() int {
+		switch rng.Intn(10) {
+		case 0:
+			return math.MinInt + rng.Intn(3)
+		case 1:
+			return math.MaxInt - rng.Intn(3)
+		}
+		return rng.Intn(60) - 30
+	}
+	ops := make(slOps, size*10)
+	for i := range ops {
+		op := slOp{Key: key(), Value: fmt.Sprint(i)}
+		switch n := rng.Intn(10); {
+		case n < 6:
+			op.Kind = 0
+		case n < 9:
+			op.Kind = 1
+		default:
+			op.Kind = 2
+			op.Key2 = op.Key + rng.Intn(10)
+			if op.Key2 < op.Key {
+				op.Key2 = math.MaxInt // 溢出
+			}
+		}
+		ops[i] = op
+	}
+	return reflect.ValueOf(ops)
+}
+
+// TestSkipListProperties 随机操作序列和随机的 p 下跳表与排好序的切片行为一致
+func TestSkipListProperties(t *testing.T) {
+	cmpEntry := func(e Entry[int, string], key int) int { return cmp.Compare(e.Key, key) }
+	property := func(ops slOps, pIndex uint8, seed int64) bool {
+		p := []float64{0.25, 0.5, 0.75, 0.9}[pIndex%4]
+		sl := New[int, string](cmp.Compare[int], WithProbability(p), WithSeed(seed), WithExpectedSize(1))
+		var model []Entry[int, string]
+		for _, op := range ops {
+			i, found := slices.BinarySearchFunc(model, op.Key, cmpEntry)
+			switch op.Kind {
+			case 0:
+				sl.Insert(op.Key, op.Value)
+				if found {
+					model[i].Value = op.Value
+				} else {
+					model = slices.Insert(model, i, Entry[int, string]{op.Key, op.Value})
+				}
+			case 1:
+				if sl.Delete(op.Key) != found {
+					t.Logf("p %v: Delete(%d) != %v", p, op.Key, found)
+					return false
+				}
+				if found {
+					model = slices.Delete(model, i, i+1)
+				}
+			case 2:
+				j, _ := slices.BinarySearchFunc(model, op.Key2, cmpEntry)
+				for j < len(model) && model[j].Key <= op.Key2 {
+					j++
+				}
+				if got := sl.DeleteRange(op.Key, op.Key2); got != j-i {
+					t.Logf("p %v: DeleteRange(%d, %d) = %d, want %d", p, op.Key, op.Key2, got, j-i)
+					return false
+				}
+				model = slices.Delete(model, i, j)
+			}
+			got, ok := sl.Search(op.Key)
+			if i, found := slices.BinarySearchFunc(model, op.Key, cmpEntry); ok != found || found && got != model[i].Value {
+				t.Logf("p %v: Search(%d) = %q, %v", p, op.Key, got, ok)
+				return false
+			}
+		}
+		checkSpans(t, sl)
+		if sl.Len() != len(model) || sl.maxLevel < levelFor(len(model), p) {
+			t.Logf("p %v: Len %d, maxLevel %d for %d entries", p, sl.Len(), sl.maxLevel, len(model))
+			return false
+		}
+		var all []Entry[int, string]
+		for k, v := range sl.All() {
+			all = append(all, Entry[int, string]{k, v})
+		}
+		if !slices.Equal(all, model) {
+			t.Logf("p %v: All() = %v, want %v", p, all, model)
+			return false
+		}
+		for i, e := range model {
+			if r, ok := sl.Rank(e.Key); !ok || r != i {
+				return false
+			}
+		}
+		return slices.Equal(sl.RangeByRank(1, -2), redisRange(model, 1, -2))
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 300, Rand: rand.New(rand.NewSource(1))}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSkipListComparator 比较函数决定顺序和键的相等
+func TestSkipListComparator(t *testing.T) {
+	sl := New[string, int](func(a, b string) int { return strings.Compare(strings.ToLower(b), strings.ToLower(a)) })
+	for i, key := range []string{"b", "A", "c", "B", "a"} {
+		sl.Insert(key, i)
+	}
+	var keys []string
+	var values []int
+	for k, v := range sl.All() {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	// 大小写不同的键视为同一个，保留先插入的键、后插入的值
+	if !slices.Equal(keys, []string{"c", "b", "A"}) || !slices.Equal(values, []int{2, 3, 4}) {
+		t.Fatalf("All() = %q %v", keys, values)
+	}
+	if v, ok := sl.Search("C"); !ok || v != 2 {
+		t.Fatalf("Search(C) = %d, %v", v, ok)
+	}
+}
+
+// TestSkipListGrows 最大层数随节点数增长，不再被固定的常数限制
+func TestSkipListGrows(t *testing.T) {
+	const n = 1 << 14
+	sl := New[int, int](cmp.Compare[int], WithSeed(1))
+	start := sl.maxLevel
+	for i := range n {
+		sl.Insert(i, i)
+	}
+	if want := levelFor(n, Probability); sl.maxLevel < want || sl.maxLevel <= start || sl.level <= start {
+		t.Fatalf("maxLevel %d (started at %d), level %d; want at least %d", sl.maxLevel, start, sl.level, want)
+	}
+	checkSpans(t, sl)
+	if r, ok := sl.Rank(n / 3); !ok || r != n/3 {
+		t.Fatalf("Rank(%d) = %d, %v", n/3, r, ok)
+	}
+
+	small := New[int, int](cmp.Compare[int], WithProbability(0.25), WithExpectedSize(1<<20))
+	if small.maxLevel != levelFor(1<<20, 0.25) {
+		t.Fatalf("expected size 1<<20 at p 0.25: maxLevel %d", small.maxLevel)
+	}
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server 在进程内执行 Redis 有序集合命令的一个子集，回复按 RESP2 编码，与 Redis 7 逐字节一致，
+// 单元测试里可以代替 Redis: 直接调用 Do，或者用 Serve 接受 Redis 客户端的连接。
+// 支持 PING、DEL、ZADD、ZINCRBY、ZSCORE、ZREM、ZCARD、ZRANK、ZRANGE [REV] [WITHSCORES]
+// 和 ZRANGEBYLEX [LIMIT]，其他命令和选项回复错误
+type Server struct {
+	mu   sync.Mutex
+	sets map[string]*SortedSet
+}
+
+func NewServer() *Server {
+	return &Server{sets: make(map[string]*SortedSet)}
+}
+
+var (
+	errSyntax    = errors.New("ERR syntax error")
+	errNotInt    = errors.New("ERR value is not an integer or out of range")
+	errProtocol  = errors.New("ERR Protocol error")
+	errEmptyArgs = errors.New("ERR empty command")
+	errLexScores = errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+)
+
+// command 一条命令: arity 为参数个数(含命令名)，负数表示至少 -arity 个
+type command struct {
+	arity int
+	run   func(s *Server, w *respWriter, args []string) error
+}
+
+var commands = map[string]command{
+	"ping":        {-1, (*Server).ping},
+	"del":         {-2, (*Server).del},
+	"zadd":        {-4, (*Server).zadd},
+	"zincrby":     {4, (*Server).zincrby},
+	"zscore":      {3, (*Server).zscore},
+	"zrem":        {-3, (*Server).zrem},
+	"zcard":       {2, (*Server).zcard},
+	"zrank":       {3, (*Server).zrank},
+	"zrange":      {-4, (*Server).zrange},
+	"zrangebylex": {-4, (*Server).zrangebylex},
+}
+
+// Do 执行一条命令，返回 RESP 编码的回复
+func (s *Server) Do(args ...string) []byte {
+	var w respWriter
+	s.do(&w, args)
+	return w.Bytes()
+}
+
+func (s *Server) do(w *respWriter, args []string) {
+	if len(args) == 0 {
+		w.error(errEmptyArgs)
+		return
+	}
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		var b strings.Builder
+		fmt.Fprintf(&b, "ERR unknown command '%s', with args beginning with: ", args[0])
+		for _, arg := range args[1:] {
+			fmt.Fprintf(&b, "'%s' ", arg)
+		}
+		w.error(errors.New(b.String()))
+		return
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || len(args) < -cmd.arity {
+		w.error(fmt.Errorf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := cmd.run(s, w, args); err != nil {
+		w.error(err)
+	}
+}
+
+// Serve 在 l 上接受连接，每个连接按顺序读取命令并回复，直到 l 关闭
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	bw := bufio.NewWriter(conn)
+	var w respWriter
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				w.Reset()
+				w.error(fmt.Errorf("%w: %v", errProtocol, err))
+				bw.Write(w.Bytes())
+				bw.Flush()
+			}
+			return
+		}
+		w.Reset()
+		quit := len(args) > 0 && strings.EqualFold(args[0], "quit")
+		switch {
+		case quit:
+			w.status("OK")
+		case len(args) > 0:
+			s.do(&w, args)
+		}
+		bw.Write(w.Bytes())
+		// 客户端流水线发来的命令全部执行完再一起发送回复
+		if r.Buffered() == 0 || quit {
+			if err := bw.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// readCommand 读取一条命令: RESP 的批量字符串数组，或者以空白分隔的一行内联命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1<<20 {
+		return nil, fmt.Errorf("invalid multibulk length %q", line[1:])
+	}
+	args := make([]string, 0, max(n, 0))
+	for range n {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected '$', got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > 512<<20 {
+			return nil, fmt.Errorf("invalid bulk length %q", line[1:])
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, noEOF(err)
+		}
+		if !bytes.HasSuffix(buf, []byte("\r\n")) {
+			return nil, errors.New("bulk string not terminated by CRLF")
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine 读取一行，去掉结尾的 \r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if line != "" {
+			return "", noEOF(err)
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(line[:len(line)-1], "\r"), nil
+}
+
+// noEOF 命令读到一半时的 EOF 是协议错误
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// respWriter 按 RESP2 编码回复
+type respWriter struct {
+	bytes.Buffer
+}
+
+func (w *respWriter) status(s string) {
+	fmt.Fprintf(w, "+%s\r\n", s)
+}
+
+func (w *respWriter) error(err error) {
+	fmt.Fprintf(w, "-%s\r\n", err)
+}
+
+func (w *respWriter) integer(n int) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func (w *respWriter) bulk(s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (w *respWriter) null() {
+	w.WriteString("$-1\r\n")
+}
+
+func (w *respWriter) array(n int) {
+	fmt.Fprintf(w, "*%d\r\n", n)
+}
+
+func (w *respWriter) score(f float64) {
+	w.bulk(formatScore(f))
+}
+
+// formatScore 按 Redis 的格式输出分值: 整数不带小数点和指数，无穷大为 inf 和 -inf
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1<<52:
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseScore 按 Redis 的规则解析分值: 接受 inf、+inf、-inf，不接受 NaN 和溢出
+func parseScore(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, ErrNotFloat
+	}
+	return f, nil
+}
+
+func parseInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errNotInt
+	}
+	return n, nil
+}
+
+// lookup 取出 key 对应的有序集合，create 时不存在就创建
+func (s *Server) lookup(key string, create bool) *SortedSet {
+	z := s.sets[key]
+	if z == nil && create {
+		z = NewSortedSet()
+		s.sets[key] = z
+	}
+	return z
+}
+
+// cleanup 和 Redis 一样删除空的有序集合
+func (s *Server) cleanup(key string) {
+	if z := s.sets[key]; z != nil && z.ZCard() == 0 {
+		delete(s.sets, key)
+	}
+}
+
+func (s *Server) ping(w *respWriter, args []string) error {
+	switch len(args) {
+	case 1:
+		w.status("PONG")
+	case 2:
+		w.bulk(args[1])
+	default:
+		return fmt.Errorf("ERR wrong number of arguments for 'ping' command")
+	}
+	return nil
+}
+
+func (s *Server) del(w *respWriter, args []string) error {
+	n := 0
+	for _, key := range args[1:] {
+		if _, ok := s.sets[key]; ok {
+			delete(s.sets, key)
+			n++
+		}
+	}
+	w.integer(n)
+	return nil
+}
+
+// zadd ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]，
+// 错误的检查顺序与 Redis 相同
+func (s *Server) zadd(w *respWriter, args []string) error {
+	var opts ZAddOptions
+	incr := false
+	i := 2
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return errSyntax
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if incr && len(rest) > 2 {
+		return ErrZAddIncr
+	}
+	members := make([]ZMember, 0, len(rest)/2)
+	for j := 0; j < len(rest); j += 2 {
+		score, err := parseScore(rest[j])
+		if err != nil {
+			return err
+		}
+		members = append(members, ZMember{rest[j+1], score})
+	}
+
+	key := args[1]
+	z := s.lookup(key, true)
+	defer s.cleanup(key)
+	if incr {
+		score, ok, err := z.ZAddIncr(opts, members[0].Member, members[0].Score)
+		switch {
+		case err != nil:
+			return err
+		case ok:
+			w.score(score)
+		default:
+			w.null()
+		}
+		return nil
+	}
+	n, err := z.ZAdd(opts, members...)
+	if err != nil {
+		return err
+	}
+	w.integer(n)
+	return nil
+}
+
+func (s *Server) zincrby(w *respWriter, args []string) error {
+	incr, err := parseScore(args[2])
+	if err != nil {
+		return err
+	}
+	key := args[1]
+	defer s.cleanup(key)
+	score, err := s.lookup(key, true).ZIncrBy(args[3], incr)
+	if err != nil {
+		return err
+	}
+	w.score(score)
+	return nil
+}
+
+func (s *Server) zscore(w *respWriter, args []string) error {
+	score, ok := 0.0, false
+	if z := s.lookup(args[1], false); z != nil {
+		score, ok = z.ZScore(args[2])
+	}
+	if ok {
+		w.score(score)
+	} else {
+		w.null()
+	}
+	return nil
+}
+
+func (s *Server) zrem(w *respWriter, args []string) error {
+	n := 0
+	if z := s.lookup(args[1], false); z != nil {
+		n = z.ZRem(args[2:]...)
+		s.cleanup(args[1])
+	}
+	w.integer(n)
+	return nil
+}
+
+func (s *Server) zcard(w *respWriter, args []string) error {
+	n := 0
+	if z := s.lookup(args[1], false); z != nil {
+		n = z.ZCard()
+	}
+	w.integer(n)
+	return nil
+}
+
+func (s *Server) zrank(w *respWriter, args []string) error {
+	rank, ok := 0, false
+	if z := s.lookup(args[1], false); z != nil {
+		rank, ok = z.ZRank(args[2])
+	}
+	if ok {
+		w.integer(rank)
+	} else {
+		w.null()
+	}
+	return nil
+}
+
+// zrange ZRANGE key start stop [REV] [WITHSCORES]
+func (s *Server) zrange(w *respWriter, args []string) error {
+	rev, withScores := false, false
+	for _, arg := range args[4:] {
+		switch strings.ToUpper(arg) {
+		case "REV":
+			rev = true
+		case "WITHSCORES":
+			withScores = true
+		default:
+			return errSyntax
+		}
+	}
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	var members []ZMember
+	if z := s.lookup(args[1], false); z != nil {
+		members = z.ZRange(start, stop, rev)
+	}
+	if withScores {
+		w.array(2 * len(members))
+	} else {
+		w.array(len(members))
+	}
+	for _, m := range members {
+		w.bulk(m.Member)
+		if withScores {
+			w.score(m.Score)
+		}
+	}
+	return nil
+}
+
+// zrangebylex ZRANGEBYLEX key min max [LIMIT offset count]
+func (s *Server) zrangebylex(w *respWriter, args []string) error {
+	offset, count := 0, -1
+	withScores := false
+	for i := 4; i < len(args); i++ {
+		if strings.EqualFold(args[i], "WITHSCORES") {
+			withScores = true
+			continue
+		}
+		if !strings.EqualFold(args[i], "LIMIT") || i+2 >= len(args) {
+			return errSyntax
+		}
+		var err error
+		if offset, err = parseInt(args[i+1]); err != nil {
+			return err
+		}
+		if count, err = parseInt(args[i+2]); err != nil {
+			return err
+		}
+		i += 2
+	}
+	if withScores {
+		return errLexScores
+	}
+	z := s.lookup(args[1], false)
+	if z == nil {
+		z = NewSortedSet()
+	}
+	members, err := z.ZRangeByLex(args[2], args[3], offset, count)
+	if err != nil {
+		return err
+	}
+	w.array(len(members))
+	for _, m := range members {
+		w.bulk(m)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cg917658910/go-study/lib/repl"
+	"github.com/redis/go-redis/v9"
+)
+
+var redisAddr = flag.String("redis", "", "对照该地址上真实的 Redis 重新录制 testdata/zset.resp")
+
+// step 对照记录中的一条命令和期望的回复
+type step struct {
+	line  int
+	args  []string
+	reply []string // 回复的各行，不含 \r\n
+}
+
+// readTranscript 读取对照记录，同时返回原文各行以便重新录制
+func readTranscript(t *testing.T, path string) ([]step, []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var steps []step
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "> "):
+			args, err := repl.Split(line[2:])
+			if err != nil {
+				t.Fatalf("%s:%d: %v", path, i+1, err)
+			}
+			steps = append(steps, step{line: i + 1, args: args})
+		case line == "" || strings.HasPrefix(line, "#"):
+		case len(steps) == 0:
+			t.Fatalf("%s:%d: reply before the first command", path, i+1)
+		default:
+			s := &steps[len(steps)-1]
+			s.reply = append(s.reply, line)
+		}
+	}
+	return steps, lines
+}
+
+// encodeCommand 把命令编码成 RESP 数组
+func encodeCommand(args []string) []byte {
+	var w respWriter
+	w.array(len(args))
+	for _, arg := range args {
+		w.bulk(arg)
+	}
+	return w.Bytes()
+}
+
+// readReply 读取一个完整的回复，按行返回
+func readReply(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("empty reply line")
+	}
+	reply := []string{line}
+	n, _ := strconv.Atoi(line[1:])
+	switch line[0] {
+	case '$':
+		if n >= 0 {
+			buf := make([]byte, n+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, err
+			}
+			reply = append(reply, string(buf[:n]))
+		}
+	case '*':
+		for range n {
+			elem, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			reply = append(reply, elem...)
+		}
+	}
+	return reply, nil
+}
+
+// replay 在连接上依次发送命令，返回每条命令的回复
+func replay(t *testing.T, conn net.Conn, steps []step) [][]string {
+	t.Helper()
+	r := bufio.NewReader(conn)
+	replies := make([][]string, len(steps))
+	for i, s := range steps {
+		if _, err := conn.Write(encodeCommand(s.args)); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := readReply(r)
+		if err != nil {
+			t.Fatalf("line %d %q: %v", s.line, s.args, err)
+		}
+		replies[i] = reply
+	}
+	return replies
+}
+
+// startServer 在本机随机端口上启动 Server，测试结束时关闭
+func startServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := NewServer()
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+// TestRESPTranscript 重放 testdata/zset.resp，回复要与记录逐行一致。
+// 给出 -redis 时改为对照真实的 Redis 执行，并用它的回复重写记录
+func TestRESPTranscript(t *testing.T) {
+	const path = "testdata/zset.resp"
+	steps, lines := readTranscript(t, path)
+	if *redisAddr != "" {
+		conn, err := net.Dial("tcp", *redisAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		replies := replay(t, conn, steps)
+		// 保留注释和空行，用新的回复替换原来的
+		var out []string
+		next := 0
+		for i, line := range lines {
+			switch {
+			case next < len(steps) && steps[next].line == i+1:
+				out = append(out, line)
+				out = append(out, replies[next]...)
+				next++
+			case line == "" || strings.HasPrefix(line, "#"):
+				out = append(out, line)
+			}
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(out, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	check := func(t *testing.T, replies [][]string) {
+		for i, s := range steps {
+			if !slices.Equal(replies[i], s.reply) {
+				t.Errorf("%s:%d: %q\ngot  %q\nwant %q", path, s.line, s.args, replies[i], s.reply)
+			}
+		}
+	}
+	t.Run("Do", func(t *testing.T) {
+		s := NewServer()
+		replies := make([][]string, len(steps))
+		for i, st := range steps {
+			reply, err := readReply(bufio.NewReader(strings.NewReader(string(s.Do(st.args...)))))
+			if err != nil {
+				t.Fatalf("line %d: %v", st.line, err)
+			}
+			replies[i] = reply
+		}
+		check(t, replies)
+	})
+	t.Run("Serve", func(t *testing.T) {
+		_, addr := startServer(t)
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		check(t, replay(t, conn, steps))
+	})
+}
+
+// TestGoRedisClient 用 go-redis 客户端连接 Server，包括流水线
+func TestGoRedisClient(t *testing.T) {
+	_, addr := startServer(t)
+	rdb := redis.NewClient(&redis.Options{Addr: addr, Protocol: 2, DisableIdentity: true})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := rdb.ZAdd(ctx, "lb", redis.Z{Score: 2, Member: "b"}, redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: "aa"}).Result()
+	if err != nil || n != 3 {
+		t.Fatalf("ZAdd = %d, %v", n, err)
+	}
+	// ZAddArgs 会丢掉和 NX 冲突的 GT，直接发送命令
+	if err := rdb.Do(ctx, "zadd", "lb", "nx", "gt", 1, "x").Err(); err == nil ||
+		err.Error() != ErrZAddGTLT.Error() {
+		t.Fatalf("ZADD NX GT error = %v", err)
+	}
+	score, err := rdb.ZIncrBy(ctx, "lb", 0.5, "a").Result()
+	if err != nil || score != 1.5 {
+		t.Fatalf("ZIncrBy = %v, %v", score, err)
+	}
+	if _, err := rdb.ZScore(ctx, "lb", "nobody").Result(); err != redis.Nil {
+		t.Fatalf("ZScore(nobody) error = %v, want redis.Nil", err)
+	}
+
+	pipe := rdb.Pipeline()
+	withScores := pipe.ZRangeWithScores(ctx, "lb", 0, -1)
+	rank := pipe.ZRank(ctx, "lb", "b")
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []redis.Z{{Score: 1.5, Member: "a"}, {Score: 2, Member: "aa"}, {Score: 2, Member: "b"}}
+	if got := withScores.Val(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ZRangeWithScores = %v, want %v", got, want)
+	}
+	if rank.Val() != 2 {
+		t.Fatalf("ZRank(b) = %d, want 2", rank.Val())
+	}
+}
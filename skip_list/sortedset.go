@@ -0,0 +1,261 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"strings"
+)
+
+// 有序集合，对应 Redis 的 ZSET: 成员到分值的 map 加上以 (分值, 成员) 为键的跳表。
+// map 用于按成员查分值，跳表用于排名和范围查询，分值相同的成员按字节序排列
+
+var (
+	ErrZAddNXXX = errors.New("ERR XX and NX options at the same time are not compatible")
+	ErrZAddGTLT = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	ErrZAddIncr = errors.New("ERR INCR option supports a single increment-element pair")
+	ErrNaNScore = errors.New("ERR resulting score is not a number (NaN)")
+	ErrLexRange = errors.New("ERR min or max not valid string range item")
+	ErrNotFloat = errors.New("ERR value is not a valid float")
+)
+
+// ZMember 有序集合的成员和分值
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZAddOptions ZADD 的选项
+type ZAddOptions struct {
+	NX bool // 只添加新成员，不更新已有成员
+	XX bool // 只更新已有成员，不添加新成员
+	GT bool // 已有成员只在新分值更大时更新，不影响添加
+	LT bool // 已有成员只在新分值更小时更新，不影响添加
+	CH bool // 返回值包括分值被修改的成员数，而不只是新添加的
+}
+
+func (o ZAddOptions) validate() error {
+	if o.NX && o.XX {
+		return ErrZAddNXXX
+	}
+	if o.NX && (o.GT || o.LT) || o.GT && o.LT {
+		return ErrZAddGTLT
+	}
+	return nil
+}
+
+// zkey 跳表中的键，先按分值再按成员排序
+type zkey struct {
+	score  float64
+	member string
+}
+
+func compareZKey(a, b zkey) int {
+	return cmp.Or(cmp.Compare(a.score, b.score), strings.Compare(a.member, b.member))
+}
+
+// SortedSet 有序集合
+type SortedSet struct {
+	dict map[string]float64
+	zsl  *SkipList[zkey, struct{}]
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{dict: make(map[string]float64), zsl: New[zkey, struct{}](compareZKey)}
+}
+
+// ZCard 成员数
+func (z *SortedSet) ZCard() int {
+	return len(z.dict)
+}
+
+// ZAdd 按 opts 添加或更新成员，返回新添加的成员数，opts.CH 时再加上分值被修改的成员数
+func (z *SortedSet) ZAdd(opts ZAddOptions, members ...ZMember) (int, error) {
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNotFloat
+		}
+	}
+	added, changed := 0, 0
+	for _, m := range members {
+		switch ok, isNew := z.add(opts, m.Member, m.Score); {
+		case isNew:
+			added++
+		case ok:
+			changed++
+		}
+	}
+	if opts.CH {
+		return added + changed, nil
+	}
+	return added, nil
+}
+
+// ZAddIncr 即 ZADD ... INCR: 把成员的分值加上 incr(不存在时视为 0)，返回新分值。
+// 因 NX、XX、GT、LT 没有执行时 ok 为 false
+func (z *SortedSet) ZAddIncr(opts ZAddOptions, member string, incr float64) (score float64, ok bool, err error) {
+	if err := opts.validate(); err != nil {
+		return 0, false, err
+	}
+	if math.IsNaN(incr) {
+		return 0, false, ErrNotFloat
+	}
+	cur, exists := z.dict[member]
+	if opts.NX && exists || opts.XX && !exists {
+		return 0, false, nil
+	}
+	score = cur + incr
+	if math.IsNaN(score) {
+		return 0, false, ErrNaNScore
+	}
+	if exists && (opts.GT && score <= cur || opts.LT && score >= cur) {
+		return 0, false, nil
+	}
+	z.set(member, score)
+	return score, true, nil
+}
+
+// ZIncrBy 把成员的分值加上 incr，返回新分值
+func (z *SortedSet) ZIncrBy(member string, incr float64) (float64, error) {
+	score, _, err := z.ZAddIncr(ZAddOptions{}, member, incr)
+	return score, err
+}
+
+// add 按 opts 设置成员的分值，返回是否修改了集合以及成员是否新添加的
+func (z *SortedSet) add(opts ZAddOptions, member string, score float64) (changed, isNew bool) {
+	cur, exists := z.dict[member]
+	switch {
+	case !exists:
+		if opts.XX {
+			return false, false
+		}
+		z.set(member, score)
+		return true, true
+	case opts.NX, cur == score, opts.GT && score < cur, opts.LT && score > cur:
+		return false, false
+	}
+	z.set(member, score)
+	return true, false
+}
+
+// set 设置成员的分值
+func (z *SortedSet) set(member string, score float64) {
+	if cur, ok := z.dict[member]; ok {
+		z.zsl.Delete(zkey{cur, member})
+	}
+	z.dict[member] = score
+	z.zsl.Insert(zkey{score, member}, struct{}{})
+}
+
+// ZScore 成员的分值
+func (z *SortedSet) ZScore(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// ZRem 删除成员，返回实际删除的个数
+func (z *SortedSet) ZRem(members ...string) int {
+	n := 0
+	for _, m := range members {
+		if score, ok := z.dict[m]; ok {
+			delete(z.dict, m)
+			z.zsl.Delete(zkey{score, m})
+			n++
+		}
+	}
+	return n
+}
+
+// ZRank 成员按分值升序的排名，从 0 开始
+func (z *SortedSet) ZRank(member string) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	return z.zsl.Rank(zkey{score, member})
+}
+
+// ZRange 返回排名在 [start, stop] 中的成员，负数表示从尾部数。rev 时按分值降序排名
+func (z *SortedSet) ZRange(start, stop int, rev bool) []ZMember {
+	var entries []Entry[zkey, struct{}]
+	if rev {
+		entries = z.zsl.RevRangeByRank(start, stop)
+	} else {
+		entries = z.zsl.RangeByRank(start, stop)
+	}
+	if entries == nil {
+		return nil
+	}
+	members := make([]ZMember, len(entries))
+	for i, e := range entries {
+		members[i] = ZMember{e.Key.member, e.Key.score}
+	}
+	return members
+}
+
+// lexBound ZRANGEBYLEX 的一端: "-" 和 "+" 为负无穷和正无穷，"[x" 包含 x，"(x" 不包含 x
+type lexBound struct {
+	value     string
+	inclusive bool
+	inf       int // -1 负无穷，1 正无穷
+}
+
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{inf: -1}, nil
+	case s == "+":
+		return lexBound{inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:], inclusive: true}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:]}, nil
+	}
+	return lexBound{}, ErrLexRange
+}
+
+// aboveMin member 是否在下界 b 之上
+func (b lexBound) aboveMin(member string) bool {
+	if b.inf != 0 {
+		return b.inf < 0
+	}
+	return member > b.value || b.inclusive && member == b.value
+}
+
+// belowMax member 是否在上界 b 之下
+func (b lexBound) belowMax(member string) bool {
+	if b.inf != 0 {
+		return b.inf > 0
+	}
+	return member < b.value || b.inclusive && member == b.value
+}
+
+// ZRangeByLex 返回成员在 [min, max] 中的成员，端点用 Redis 的写法。
+// 跳过前 offset 个，count 为负时不限个数。和 Redis 一样只在所有成员分值相同时有意义
+func (z *SortedSet) ZRangeByLex(min, max string, offset, count int) ([]string, error) {
+	lo, err := parseLexBound(min)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseLexBound(max)
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	if offset < 0 {
+		return members, nil
+	}
+	first := z.zsl.seek(func(k zkey) bool { return !lo.aboveMin(k.member) })
+	for x := first; x != nil && hi.belowMax(x.key.member) && count != 0; x = x.next[0] {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		members = append(members, x.key.member)
+		count--
+	}
+	return members, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sortedMembers 把 model 按 (分值, 成员) 排序
+func sortedMembers(model map[string]float64) []ZMember {
+	var members []ZMember
+	for m, score := range model {
+		members = append(members, ZMember{m, score})
+	}
+	slices.SortFunc(members, func(a, b ZMember) int {
+		return cmp.Or(cmp.Compare(a.Score, b.Score), strings.Compare(a.Member, b.Member))
+	})
+	return members
+}
+
+// TestSortedSetRandom 随机执行 ZADD 的各种选项和 ZREM，与 map 对照顺序、排名和跨度
+func TestSortedSetRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	z := NewSortedSet()
+	model := make(map[string]float64)
+	member := func() string { return string(rune('a'+rng.Intn(8))) + string(rune('a'+rng.Intn(8))) }
+	for i := 0; i < 5000; i++ {
+		m, score := member(), float64(rng.Intn(10))
+		cur, exists := model[m]
+		switch rng.Intn(6) {
+		case 0:
+			want := 0
+			if exists {
+				want = 1
+			}
+			if got := z.ZRem(m); got != want {
+				t.Fatalf("ZRem(%q) = %d, want %d", m, got, want)
+			}
+			delete(model, m)
+		case 1:
+			opts := ZAddOptions{GT: rng.Intn(2) == 0, XX: rng.Intn(2) == 0}
+			opts.LT = !opts.GT
+			got, ok, err := z.ZAddIncr(opts, m, score-5)
+			next := cur + score - 5
+			wantOK := !(opts.XX && !exists) && !(exists && (opts.GT && next <= cur || opts.LT && next >= cur))
+			if err != nil || ok != wantOK || ok && got != next {
+				t.Fatalf("ZAddIncr(%+v, %q, %v) = %v, %v, %v", opts, m, score-5, got, ok, err)
+			}
+			if ok {
+				model[m] = next
+			}
+		default:
+			opts := ZAddOptions{CH: true}
+			switch rng.Intn(4) {
+			case 0:
+				opts.NX = true
+			case 1:
+				opts.XX = true
+			case 2:
+				opts.GT = true
+			case 3:
+				opts.LT = true
+			}
+			want := 0
+			switch {
+			case !exists && !opts.XX:
+				want = 1
+				model[m] = score
+			case exists && !opts.NX && cur != score && !(opts.GT && score < cur) && !(opts.LT && score > cur):
+				want = 1
+				model[m] = score
+			}
+			if got, err := z.ZAdd(opts, ZMember{m, score}); got != want || err != nil {
+				t.Fatalf("ZAdd(%+v, %q, %v) = %d, %v; want %d", opts, m, score, got, err, want)
+			}
+		}
+		if i%100 == 0 {
+			checkZSet(t, z, model)
+		}
+	}
+	checkZSet(t, z, model)
+}
+
+// checkZSet 校验顺序、排名、按排名取范围和跨度
+func checkZSet(t *testing.T, z *SortedSet, model map[string]float64) {
+	t.Helper()
+	want := sortedMembers(model)
+	if got := z.ZRange(0, -1, false); !slices.Equal(got, want) || z.ZCard() != len(want) {
+		t.Fatalf("ZRange(0, -1) = %v, want %v", got, want)
+	}
+	rev := slices.Clone(want)
+	slices.Reverse(rev)
+	if got := z.ZRange(0, -1, true); !slices.Equal(got, rev) {
+		t.Fatalf("ZRange(0, -1, rev) = %v", got)
+	}
+	for i, m := range want {
+		if rank, ok := z.ZRank(m.Member); !ok || rank != i {
+			t.Fatalf("ZRank(%q) = %d, %v; want %d", m.Member, rank, ok, i)
+		}
+	}
+	checkSpans(t, z.zsl)
+}
+
+// TestZRangeByLex 分值都相同时与排好序的成员对照
+func TestZRangeByLex(t *testing.T) {
+	z := NewSortedSet()
+	words := []string{"", "a", "ab", "abc", "b", "ba", "c", "中"}
+	for _, w := range words {
+		z.ZAdd(ZAddOptions{}, ZMember{w, 0})
+	}
+	bounds := []string{"-", "+", "[", "(", "[a", "(a", "[ab", "(ab", "[b", "(bb", "[中", "(中", "[z"}
+	for _, lo := range bounds {
+		for _, hi := range bounds {
+			min, _ := parseLexBound(lo)
+			max, _ := parseLexBound(hi)
+			var want []string
+			for _, w := range words {
+				if min.aboveMin(w) && max.belowMax(w) {
+					want = append(want, w)
+				}
+			}
+			got, err := z.ZRangeByLex(lo, hi, 0, -1)
+			if err != nil || !slices.Equal(got, want) {
+				t.Fatalf("ZRangeByLex(%q, %q) = %q, %v; want %q", lo, hi, got, err, want)
+			}
+			if len(want) > 1 {
+				if got, _ := z.ZRangeByLex(lo, hi, 1, 1); !slices.Equal(got, want[1:2]) {
+					t.Fatalf("ZRangeByLex(%q, %q) LIMIT 1 1 = %q", lo, hi, got)
+				}
+			}
+		}
+	}
+	if _, err := z.ZRangeByLex("a", "+", 0, -1); err != ErrLexRange {
+		t.Fatalf("ZRangeByLex(a) error = %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"unicode/utf8"
+)
+
+// Aho-Corasick多模式匹配:
+//
+// 以Trie中的单词为模式，按层遍历Trie给每个节点编号，并算出失败链接:
+// 节点对应的字符串的最长真后缀中仍是某个模式前缀的那个节点。
+// 匹配时沿文本逐字符转移，走不通就沿失败链接回退，一遍扫描找出所有模式的出现位置。
+// 每个状态还记着失败链上第一个模式结尾的状态(输出链接)，报告匹配时不必走完整条失败链
+
+// Match 一处匹配。Start、End 是文本中的字节偏移，text[Start:End] 就是 Pattern
+type Match[V any] struct {
+	Pattern string `json:"pattern"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Value   V      `json:"value"`
+}
+
+// matchKind FindAll 报告哪些匹配
+type matchKind int
+
+const (
+	matchOverlapping     matchKind = iota // 全部匹配，可能重叠
+	matchNonOverlapping                   // 最先结束的匹配，之后从它的结尾继续
+	matchLeftmostLongest                  // 起点最靠左的匹配中最长的，之后从它的结尾继续
+)
+
+type matcherOptions struct {
+	kind matchKind
+}
+
+// MatchOption 配置 Compile 得到的匹配器
+type MatchOption func(o *matcherOptions)
+
+// NonOverlapping 只报告互不重叠的匹配: 从左到右取最先结束的匹配(同一位置结束的取最长的)，
+// 然后从它的结尾重新开始
+func NonOverlapping() MatchOption {
+	return func(o *matcherOptions) {
+		o.kind = matchNonOverlapping
+	}
+}
+
+// LeftmostLongest 只报告互不重叠的匹配: 取起点最靠左的匹配，起点相同时取最长的，
+// 然后从它的结尾继续。关键词过滤通常需要这种方式，"中华人民共和国" 不会被拆成 "中华" 和 "人民"
+func LeftmostLongest() MatchOption {
+	return func(o *matcherOptions) {
+		o.kind = matchLeftmostLongest
+	}
+}
+
+// acState 自动机的状态，对应Trie中的一个节点
+type acState[V any] struct {
+	next    map[rune]int32
+	fail    int32  // 失败链接
+	out     int32  // 失败链上第一个模式结尾的状态，不含自己，-1 表示没有
+	size    int    // 对应的字符串的字节长度
+	end     bool   // 是否模式结尾
+	pattern string // 模式结尾时为模式本身
+	value   V
+}
+
+// Matcher 编译好的Aho-Corasick自动机。它不引用原来的Trie，之后修改Trie不影响它，
+// 可以被多个 goroutine 同时使用
+type Matcher[V any] struct {
+	states []acState[V]
+	kind   matchKind
+}
+
+// Compile 以Trie中当前的单词为模式构建匹配器，空串不作为模式
+func (t *Trie[V]) Compile(opts ...MatchOption) *Matcher[V] {
+	var o matcherOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := &Matcher[V]{kind: o.kind, states: []acState[V]{{out: -1}}}
+
+	type pending struct {
+		node *TrieNode[V]
+		id   int32
+		word string
+	}
+	queue := []pending{{node: t.root}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, ch := range slices.Sorted(maps.Keys(p.node.children)) {
+			child := p.node.children[ch]
+			id := int32(len(m.states))
+			word := p.word + string(ch)
+			s := acState[V]{size: len(word), out: -1}
+			if child.isEnd {
+				s.end, s.pattern, s.value = true, word, child.value
+			}
+			// 父节点的失败链上第一个能接受 ch 的状态，按层遍历保证它们都已建好
+			if p.id != 0 {
+				f := m.states[p.id].fail
+				for m.states[f].next[ch] == 0 && f != 0 {
+					f = m.states[f].fail
+				}
+				s.fail = m.states[f].next[ch]
+			}
+			if fail := &m.states[s.fail]; fail.end {
+				s.out = s.fail
+			} else {
+				s.out = fail.out
+			}
+			m.states = append(m.states, s)
+			if m.states[p.id].next == nil {
+				m.states[p.id].next = make(map[rune]int32, len(p.node.children))
+			}
+			m.states[p.id].next[ch] = id
+			queue = append(queue, pending{node: child, id: id, word: word})
+		}
+	}
+	return m
+}
+
+// step 从状态 s 读入字符 r 后的状态
+func (m *Matcher[V]) step(s int32, r rune) int32 {
+	for {
+		if next, ok := m.states[s].next[r]; ok {
+			return next
+		}
+		if s == 0 {
+			return 0
+		}
+		s = m.states[s].fail
+	}
+}
+
+// FindAll 在 text 中查找模式，按编译时的选项报告匹配。
+// 全部匹配按结尾排序，同一位置结束的长的在前；不重叠的匹配按在文本中的位置排序。
+// text 中不是合法 UTF-8 的字节不属于任何匹配，也不会匹配模式中的 U+FFFD
+func (m *Matcher[V]) FindAll(text string) []Match[V] {
+	var matches []Match[V]
+	s := int32(0)
+	for i := 0; i < len(text); {
+		r, n := utf8.DecodeRuneInString(text[i:])
+		i += n
+		if r == utf8.RuneError && n == 1 {
+			// 状态的 size 按模式的字节数算，跨过非法字节的匹配会算错起点，从根重新开始
+			s = 0
+			continue
+		}
+		s = m.step(s, r)
+		found := s
+		if !m.states[found].end {
+			found = m.states[found].out
+		}
+		for f := found; f >= 0; f = m.states[f].out {
+			st := &m.states[f]
+			matches = append(matches, Match[V]{Pattern: st.pattern, Start: i - st.size, End: i, Value: st.value})
+			if m.kind == matchNonOverlapping {
+				// 只要最长的一个，从根重新开始，之后的匹配都在它之后
+				s = 0
+				break
+			}
+		}
+	}
+	if m.kind == matchLeftmostLongest {
+		matches = leftmostLongest(matches)
+	}
+	return matches
+}
+
+// leftmostLongest 从全部匹配中按起点从左到右、同一起点取最长的方式选出互不重叠的匹配
+func leftmostLongest[V any](matches []Match[V]) []Match[V] {
+	slices.SortFunc(matches, func(a, b Match[V]) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(b.End, a.End))
+	})
+	selected := matches[:0]
+	last := 0
+	for _, match := range matches {
+		if match.Start >= last {
+			selected = append(selected, match)
+			last = match.End
+		}
+	}
+	return selected
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// naiveMatches 逐个起点逐个模式比较，按 FindAll 的顺序返回全部匹配
+func naiveMatches(patterns map[string]string, text string) []Match[string] {
+	var matches []Match[string]
+	for start := 0; start < len(text); start++ {
+		for p, v := range patterns {
+			if p != "" && strings.HasPrefix(text[start:], p) {
+				matches = append(matches, Match[string]{Pattern: p, Start: start, End: start + len(p), Value: v})
+			}
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match[string]) int {
+		return cmp.Or(cmp.Compare(a.End, b.End), cmp.Compare(a.Start, b.Start))
+	})
+	return matches
+}
+
+// firstMatches 从全部匹配中依次选起点不早于上一个结尾、结尾最早(同结尾最长)的匹配
+func firstMatches(all []Match[string]) []Match[string] {
+	var selected []Match[string]
+	last := 0
+	for _, m := range all {
+		if m.Start >= last {
+			selected = append(selected, m)
+			last = m.End
+		}
+	}
+	return selected
+}
+
+func TestMatcherRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	letters := []rune("ab中c")
+	word := func(n int) string {
+		var b strings.Builder
+		for ; n > 0; n-- {
+			b.WriteRune(letters[rng.Intn(len(letters))])
+		}
+		return b.String()
+	}
+	for round := 0; round < 200; round++ {
+		trie := NewTrie[string]()
+		patterns := make(map[string]string)
+		for n := 1 + rng.Intn(12); n > 0; n-- {
+			p := word(rng.Intn(5))
+			trie.Insert(p, fmt.Sprint(n))
+			patterns[p] = fmt.Sprint(n)
+		}
+		text := word(rng.Intn(40))
+		all := naiveMatches(patterns, text)
+
+		if got := trie.Compile().FindAll(text); !slices.Equal(got, all) {
+			t.Fatalf("patterns %v, text %q:\nall = %v\nwant  %v", patterns, text, got, all)
+		}
+		if got, want := trie.Compile(NonOverlapping()).FindAll(text), firstMatches(all); !slices.Equal(got, want) {
+			t.Fatalf("patterns %v, text %q:\nfirst = %v\nwant    %v", patterns, text, got, want)
+		}
+		want := leftmostLongest(slices.Clone(all))
+		if got := trie.Compile(LeftmostLongest()).FindAll(text); !slices.Equal(got, want) {
+			t.Fatalf("patterns %v, text %q:\nlongest = %v\nwant      %v", patterns, text, got, want)
+		}
+	}
+}
+
+// TestMatcherSnapshot 编译后修改Trie不影响已编译的匹配器
+func TestMatcherSnapshot(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert("bad", "")
+	m := trie.Compile()
+	trie.Insert("worse", "")
+	trie.Delete("bad")
+	got := m.FindAll("bad and worse")
+	if want := []Match[string]{{Pattern: "bad", Start: 0, End: 3}}; !slices.Equal(got, want) {
+		t.Fatalf("FindAll = %v, want %v", got, want)
+	}
+}
+
+// TestMatcherInvalidUTF8 文本中夹杂非法字节时起点仍然正确，text[Start:End] 就是模式
+func TestMatcherInvalidUTF8(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	pieces := []string{"a", "b", "中", "\uFFFD", "\xff", "\xe4\xb8", "\xbd"}
+	patterns := map[string]string{"ab": "1", "中": "2", "b中a": "3", "\uFFFD": "4", "\uFFFDa": "5"}
+	trie := NewTrie[string]()
+	for p, v := range patterns {
+		trie.Insert(p, v)
+	}
+	m := trie.Compile()
+	for round := 0; round < 500; round++ {
+		var b strings.Builder
+		for n := rng.Intn(30); n > 0; n-- {
+			b.WriteString(pieces[rng.Intn(len(pieces))])
+		}
+		text := b.String()
+		got := m.FindAll(text)
+		if want := naiveMatches(patterns, text); !slices.Equal(got, want) {
+			t.Fatalf("text %q:\nall = %v\nwant  %v", text, got, want)
+		}
+		for _, match := range got {
+			if text[match.Start:match.End] != match.Pattern {
+				t.Fatalf("text %q: %+v", text, match)
+			}
+		}
+	}
+}
+
+// keywordDict 生成 n 个随机小写关键词和一段约 size 字节的文本，文本中每隔一段嵌入一个关键词
+func keywordDict(n, size int) ([]string, string) {
+	rng := rand.New(rand.NewSource(7))
+	word := func(l int) string {
+		b := make([]byte, l)
+		for i := range b {
+			b[i] = byte('a' + rng.Intn(26))
+		}
+		return string(b)
+	}
+	words := make([]string, n)
+	for i := range words {
+		words[i] = word(4 + rng.Intn(7))
+	}
+	var text strings.Builder
+	for text.Len() < size {
+		text.WriteString(word(20 + rng.Intn(60)))
+		text.WriteString(words[rng.Intn(n)])
+	}
+	return words, text.String()
+}
+
+func BenchmarkCompile(b *testing.B) {
+	words, _ := keywordDict(100000, 0)
+	trie := NewTrie[string]()
+	for _, w := range words {
+		trie.Insert(w, "")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Compile()
+	}
+}
+
+func BenchmarkFindAll(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		words, text := keywordDict(n, 1<<20)
+		trie := NewTrie[string]()
+		for _, w := range words {
+			trie.Insert(w, "")
+		}
+		for _, mode := range []struct {
+			name string
+			opts []MatchOption
+		}{
+			{"all", nil},
+			{"first", []MatchOption{NonOverlapping()}},
+			{"longest", []MatchOption{LeftmostLongest()}},
+		} {
+			m := trie.Compile(mode.opts...)
+			b.Run(fmt.Sprintf("%s/%d", mode.name, n), func(b *testing.B) {
+				b.SetBytes(int64(len(text)))
+				for i := 0; i < b.N; i++ {
+					m.FindAll(text)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkNaive 对照: 每个关键词在文本中各找一遍
+func BenchmarkNaive(b *testing.B) {
+	words, text := keywordDict(1000, 1<<20)
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		for _, w := range words {
+			for rest := text; ; {
+				j := strings.Index(rest, w)
+				if j < 0 {
+					break
+				}
+				rest = rest[j+1:]
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 词典文件有两种格式，按扩展名区分:
+//
+//	.json  {"word": "value", ...} 对象，或 [{"word": ..., "value": ..., "weight": ...}, ...] 数组
+//	其他   每行 word<TAB>value[<TAB>weight]，只有单词的行值为空串
+//
+// 装载时边读边插入，不把整个词典读进内存
+
+var ErrBadDict = errors.New("invalid dictionary")
+
+// dictEntry JSON 数组格式中的一项
+type dictEntry struct {
+	Word   string  `json:"word"`
+	Value  string  `json:"value"`
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// insertEntry 插入一项，没有给出权重时保留已有单词的权重
+func insertEntry(t *Trie[string], word, value string, weight *float64) {
+	if weight == nil {
+		t.Insert(word, value)
+	} else {
+		t.InsertWeighted(word, value, *weight)
+	}
+}
+
+// LoadTSV 从 r 逐行读取 word<TAB>value[<TAB>weight] 插入 t，返回插入的行数，空行跳过。
+// 出错时之前的行已经插入
+func LoadTSV(t *Trie[string], r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	n := 0
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSuffix(sc.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 3)
+		var value string
+		var weight *float64
+		if len(fields) > 1 {
+			value = fields[1]
+		}
+		if len(fields) > 2 {
+			w, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return n, fmt.Errorf("%w: tsv line %d: invalid weight %q", ErrBadDict, line, fields[2])
+			}
+			weight = &w
+		}
+		insertEntry(t, fields[0], value, weight)
+		n++
+	}
+	return n, sc.Err()
+}
+
+// LoadJSON 从 r 读取 JSON 格式的词典插入 t，返回插入的单词数。
+// 按词条逐个解码，出错时之前的词条已经插入
+func LoadJSON(t *Trie[string], r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrBadDict, err)
+	}
+	n := 0
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return n, fmt.Errorf("%w: %v", ErrBadDict, err)
+			}
+			var value string
+			if err := dec.Decode(&value); err != nil {
+				return n, fmt.Errorf("%w: word %q: %v", ErrBadDict, key, err)
+			}
+			t.Insert(key.(string), value)
+			n++
+		}
+	case json.Delim('['):
+		for dec.More() {
+			// 用指针区分缺少的字段
+			var e struct {
+				Word   *string  `json:"word"`
+				Value  string   `json:"value"`
+				Weight *float64 `json:"weight"`
+			}
+			if err := dec.Decode(&e); err != nil {
+				return n, fmt.Errorf("%w: entry %d: %v", ErrBadDict, n+1, err)
+			}
+			if e.Word == nil {
+				return n, fmt.Errorf("%w: entry %d has no word", ErrBadDict, n+1)
+			}
+			insertEntry(t, *e.Word, e.Value, e.Weight)
+			n++
+		}
+	default:
+		return 0, fmt.Errorf("%w: expected a JSON object or array", ErrBadDict)
+	}
+	if _, err := dec.Token(); err != nil {
+		return n, fmt.Errorf("%w: %v", ErrBadDict, err)
+	}
+	return n, nil
+}
+
+// SaveTSV 按单词排序把 t 写成 TSV，权重为 0 的单词不写权重列。
+// 单词或值含有制表符或换行时无法用 TSV 表示，返回错误
+func SaveTSV(t *Trie[string], w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	n := 0
+	var err error
+	t.walk(t.root, "", func(word string, node *TrieNode[string]) bool {
+		if strings.ContainsAny(word, "\t\r\n") || strings.ContainsAny(node.value, "\t\r\n") {
+			err = fmt.Errorf("%w: %q contains a tab or newline, save as .json instead", ErrBadDict, word)
+			return false
+		}
+		bw.WriteString(word)
+		bw.WriteByte('\t')
+		bw.WriteString(node.value)
+		if node.weight != 0 {
+			bw.WriteByte('\t')
+			bw.WriteString(strconv.FormatFloat(node.weight, 'g', -1, 64))
+		}
+		bw.WriteByte('\n')
+		n++
+		return true
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// SaveJSON 按单词排序把 t 写成 JSON 数组，每个词条一行
+func SaveJSON(t *Trie[string], w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	var line bytes.Buffer
+	enc := json.NewEncoder(&line)
+	enc.SetEscapeHTML(false)
+	n := 0
+	var err error
+	bw.WriteString("[")
+	t.walk(t.root, "", func(word string, node *TrieNode[string]) bool {
+		line.Reset()
+		if err = enc.Encode(dictEntry{word, node.value, node.weight}); err != nil {
+			return false
+		}
+		if n > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString("\n")
+		bw.Write(bytes.TrimSuffix(line.Bytes(), []byte("\n")))
+		n++
+		return true
+	})
+	if err != nil {
+		return n, err
+	}
+	bw.WriteString("\n]\n")
+	return n, bw.Flush()
+}
+
+// isJSONDict 按扩展名判断词典文件是否 JSON 格式
+func isJSONDict(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// loadDict 装载词典文件，- 表示从标准输入读取 TSV
+func loadDict(t *Trie[string], path string) (int, error) {
+	if path == "-" {
+		return LoadTSV(t, os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 1<<16)
+	if isJSONDict(path) {
+		return LoadJSON(t, r)
+	}
+	return LoadTSV(t, r)
+}
+
+// saveDict 把 t 写到词典文件
+func saveDict(t *Trie[string], path string) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	save := SaveTSV
+	if isJSONDict(path) {
+		save = SaveJSON
+	}
+	n, err := save(t, f)
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	return n, f.Close()
+}
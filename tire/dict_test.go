@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// entries 按单词排序列出全部单词、值和权重
+func entries(t *Trie[string]) []dictEntry {
+	var all []dictEntry
+	t.walk(t.root, "", func(word string, node *TrieNode[string]) bool {
+		all = append(all, dictEntry{word, node.value, node.weight})
+		return true
+	})
+	return all
+}
+
+func TestDictRoundTrip(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.InsertWeighted("中华", "China", 1.5)
+	trie.InsertWeighted("apple", "苹果 <red>", 10)
+	trie.Insert("a", "")
+	trie.Insert("b", `quote " and \ backslash`)
+	want := entries(trie)
+
+	dir := t.TempDir()
+	for _, name := range []string{"dict.tsv", "dict.json"} {
+		path := filepath.Join(dir, name)
+		if n, err := saveDict(trie, path); err != nil || n != len(want) {
+			t.Fatalf("save %s: %d, %v", name, n, err)
+		}
+		loaded := NewTrie[string]()
+		if n, err := loadDict(loaded, path); err != nil || n != len(want) {
+			t.Fatalf("load %s: %d, %v", name, n, err)
+		}
+		if got := entries(loaded); !slices.Equal(got, want) {
+			t.Fatalf("%s round trip = %v, want %v", name, got, want)
+		}
+		if loaded.Len() != trie.Len() {
+			t.Fatalf("%s: Len = %d, want %d", name, loaded.Len(), trie.Len())
+		}
+	}
+
+	// TSV 不能表示含有制表符的值，JSON 可以
+	trie.Insert("tab", "a\tb")
+	if _, err := saveDict(trie, filepath.Join(dir, "tab.tsv")); !errors.Is(err, ErrBadDict) {
+		t.Fatalf("saving a tab in TSV: %v", err)
+	}
+	if _, err := saveDict(trie, filepath.Join(dir, "tab.json")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadJSONErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`"word"`,
+		`{"a": 1}`,
+		`[{"value": "no word"}]`,
+		`[{"word": "a"}`,
+		`{"a": "x",}`,
+	} {
+		if _, err := LoadJSON(NewTrie[string](), strings.NewReader(src)); !errors.Is(err, ErrBadDict) {
+			t.Errorf("LoadJSON(%q) = %v, want ErrBadDict", src, err)
+		}
+	}
+}
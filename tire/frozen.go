@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"unsafe"
+)
+
+// 冻结的Trie: 只读的双数组Trie。
+//
+// 按 UTF-8 字节而不是字符建树，前缀可以停在字符中间；
+// Trie 把无效的 UTF-8 字节都当作 U+FFFD，冻结后这些单词按 U+FFFD 的编码存放。
+// 每个节点占双数组中的一个槽位 s:
+// 经字节 c 到达的子节点在槽位 t = base[s]+c，且 check[t] == s。
+// 双数组本身只能按字节试探子节点，遍历时逐个试 256 个字节太慢，
+// 因此每个槽位另记第一个子节点的字节(child)和下一个兄弟节点的字节(sibling)，都加一存放，0 表示没有。
+// value[s] 为单词在值表中的序号加一，值编码后依次存放在 data 中，offsets 记录各自的起止位置。
+//
+// 文件格式(小端):
+//
+//	header: magic[8] slots:u32 values:u32 dataLen:u64 crc:u32 reserved:u32
+//	base:i32[slots] check:i32[slots] value:u32[slots] offsets:u32[values+1]
+//	child:u16[slots] sibling:u16[slots] data[dataLen]
+//
+// crc 覆盖头部之后的全部内容。各数组都按自身大小对齐，
+// 在小端机器上打开时直接引用映射进内存的文件，不做复制
+
+var (
+	ErrBadFrozen   = errors.New("tire: not a frozen trie file")
+	ErrCorruptTrie = errors.New("tire: corrupt frozen trie")
+)
+
+var frozenMagic = [8]byte{'T', 'I', 'R', 'E', 'D', 'A', 'T', 1}
+
+const frozenHeaderSize = 32
+
+// Codec 把值编码成冻结的Trie中的字节。每个值单独记录长度，
+// 因此 Decode 收到的 src 恰好是一次 Encode 的结果
+type Codec[T any] interface {
+	Size(v T) int                 // 编码后的字节数
+	Encode(dst []byte, v T)       // 编码到 dst[:Size(v)]
+	Decode(src []byte) (T, error) // 解码，src 可能是映射的文件，不能保留
+}
+
+// StringCodec 原样编码字符串
+type StringCodec struct{}
+
+func (StringCodec) Size(v string) int { return len(v) }
+
+func (StringCodec) Encode(dst []byte, v string) { copy(dst, v) }
+
+func (StringCodec) Decode(src []byte) (string, error) { return string(src), nil }
+
+// FrozenTrie 只读的双数组Trie，由 Trie.Freeze 生成或用 OpenFrozen 从文件打开。
+// 可以被多个 goroutine 同时读取
+type FrozenTrie[V any] struct {
+	base    []int32
+	check   []int32
+	value   []uint32
+	offsets []uint32
+	child   []uint16
+	sibling []uint16
+	data    []byte
+	codec   Codec[V]
+
+	release func() error // 解除文件映射
+}
+
+// Freeze 把Trie中当前的单词转换成冻结的Trie，之后修改Trie不影响它
+func (t *Trie[V]) Freeze(codec Codec[V]) *FrozenTrie[V] {
+	var words []string
+	var data []byte
+	offsets := []uint32{0}
+	t.WalkPrefix("", func(word string, value V) bool {
+		words = append(words, word)
+		n := codec.Size(value)
+		data = append(data, make([]byte, n)...)
+		codec.Encode(data[len(data)-n:], value)
+		offsets = append(offsets, uint32(len(data)))
+		return true
+	})
+
+	b := &daBuilder{words: words, size: 1}
+	b.grow(256)
+	b.used[0] = true
+	b.build(0, 0, len(words), 0)
+
+	f := &FrozenTrie[V]{
+		base:    b.base[:b.size],
+		check:   b.check[:b.size],
+		value:   b.value[:b.size],
+		offsets: offsets,
+		child:   b.child[:b.size],
+		sibling: b.sibling[:b.size],
+		data:    data,
+		codec:   codec,
+	}
+	f.check[0] = -1
+	return f
+}
+
+// daBuilder 由按字节序排好的单词构建双数组
+type daBuilder struct {
+	words          []string
+	base, check    []int32
+	value          []uint32
+	child, sibling []uint16
+	used           []bool
+	size           int // 用到的最大槽位加一
+	nextCheck      int // 找空槽的起点，之前的槽位都已占用或几乎占满
+}
+
+func (b *daBuilder) grow(n int) {
+	for len(b.used) < n {
+		b.base = append(b.base, 0)
+		b.check = append(b.check, -1)
+		b.value = append(b.value, 0)
+		b.child = append(b.child, 0)
+		b.sibling = append(b.sibling, 0)
+		b.used = append(b.used, false)
+	}
+}
+
+// build 为槽位 s 上的节点安排子节点。words[lo:hi] 是以该节点为前缀的单词，前缀长 depth 字节
+func (b *daBuilder) build(s int32, lo, hi, depth int) {
+	if lo < hi && len(b.words[lo]) == depth {
+		// 排序后恰好等于前缀的单词在最前面
+		b.value[s] = uint32(lo + 1)
+		lo++
+	}
+	if lo == hi {
+		return
+	}
+
+	type group struct {
+		label  byte
+		lo, hi int
+	}
+	var groups []group
+	for i := lo; i < hi; {
+		c := b.words[i][depth]
+		j := i + 1
+		for j < hi && b.words[j][depth] == c {
+			j++
+		}
+		groups = append(groups, group{c, i, j})
+		i = j
+	}
+
+	base := b.findBase(groups[0].label, func(base int) bool {
+		for _, g := range groups[1:] {
+			if b.used[base+int(g.label)] {
+				return false
+			}
+		}
+		return true
+	})
+	b.base[s] = int32(base)
+	b.child[s] = uint16(groups[0].label) + 1
+	for i, g := range groups {
+		t := base + int(g.label)
+		b.used[t] = true
+		b.check[t] = s
+		b.size = max(b.size, t+1)
+		if i+1 < len(groups) {
+			b.sibling[t] = uint16(groups[i+1].label) + 1
+		}
+	}
+	for _, g := range groups {
+		b.build(int32(base+int(g.label)), g.lo, g.hi, depth+1)
+	}
+}
+
+// findBase 找一个 base，使 base+first 空闲且 fits(base) 成立。base 至少为 1，子节点不会落在根的槽位上
+func (b *daBuilder) findBase(first byte, fits func(base int) bool) int {
+	start := max(b.nextCheck, int(first)+1)
+	occupied, firstFree := 0, -1
+	pos := start
+	for ; ; pos++ {
+		b.grow(pos - int(first) + 257)
+		if b.used[pos] {
+			occupied++
+			continue
+		}
+		if firstFree < 0 {
+			firstFree = pos
+		}
+		if fits(pos - int(first)) {
+			break
+		}
+	}
+	// 跳过找到的第一个空槽之前全部占用的槽位；扫过的区域几乎占满时整段跳过
+	switch {
+	case occupied*20 >= (pos-start+1)*19:
+		b.nextCheck = pos
+	case firstFree > b.nextCheck:
+		b.nextCheck = firstFree
+	}
+	return pos - int(first)
+}
+
+// next 从槽位 s 经字节 c 转移，没有这个子节点时返回 -1
+func (f *FrozenTrie[V]) next(s int32, c byte) int32 {
+	t := int(f.base[s]) + int(c)
+	if f.base[s] == 0 || t >= len(f.check) || f.check[t] != s {
+		return -1
+	}
+	return int32(t)
+}
+
+// find 返回 key 对应的槽位，没有时返回 -1
+func (f *FrozenTrie[V]) find(key string) int32 {
+	s := int32(0)
+	for i := 0; i < len(key) && s >= 0; i++ {
+		s = f.next(s, key[i])
+	}
+	return s
+}
+
+// valueAt 解码第 i 个值
+func (f *FrozenTrie[V]) valueAt(i uint32) V {
+	v, err := f.codec.Decode(f.data[f.offsets[i]:f.offsets[i+1]])
+	if err != nil {
+		// 文件已经校验过，解码失败说明打开时用错了 Codec
+		panic(fmt.Errorf("%w: value %d: %v", ErrCorruptTrie, i, err))
+	}
+	return v
+}
+
+// Len 单词数
+func (f *FrozenTrie[V]) Len() int {
+	return len(f.offsets) - 1
+}
+
+// Search 精确查找单词
+func (f *FrozenTrie[V]) Search(word string) (V, bool) {
+	if s := f.find(word); s >= 0 && f.value[s] != 0 {
+		return f.valueAt(f.value[s] - 1), true
+	}
+	var zero V
+	return zero, false
+}
+
+// StartsWith 查找前缀匹配的所有单词，按单词排序
+func (f *FrozenTrie[V]) StartsWith(prefix string) []string {
+	var results []string
+	f.WalkPrefix(prefix, func(word string, value V) bool {
+		results = append(results, fmt.Sprintf("%s -> %v", word, value))
+		return true
+	})
+	return results
+}
+
+// WalkPrefix 按字典序对以 prefix 开头的每个单词调用 fn，fn 返回 false 时停止
+func (f *FrozenTrie[V]) WalkPrefix(prefix string, fn func(word string, value V) bool) {
+	if s := f.find(prefix); s >= 0 {
+		f.walk(s, []byte(prefix), fn)
+	}
+}
+
+// walk 先序遍历槽位 s 下的子树，子节点按字节升序，即单词按字典序
+func (f *FrozenTrie[V]) walk(s int32, word []byte, fn func(word string, value V) bool) bool {
+	if v := f.value[s]; v != 0 && !fn(string(word), f.valueAt(v-1)) {
+		return false
+	}
+	base := f.base[s]
+	for label := f.child[s]; label != 0; {
+		t := base + int32(label-1)
+		if !f.walk(t, append(word, byte(label-1)), fn) {
+			return false
+		}
+		label = f.sibling[t]
+	}
+	return true
+}
+
+// Size 编码后的字节数，即写到文件中的大小
+func (f *FrozenTrie[V]) Size() int {
+	return frozenHeaderSize + 12*len(f.base) + 4*len(f.offsets) + 4*len(f.child) + len(f.data)
+}
+
+// WriteTo 按文件格式把冻结的Trie写到 w
+func (f *FrozenTrie[V]) WriteTo(w io.Writer) (int64, error) {
+	if len(f.data) > math.MaxUint32 {
+		return 0, fmt.Errorf("tire: %d bytes of values exceed the 4GiB limit", len(f.data))
+	}
+	crc := crc32.NewIEEE()
+	body := func(w io.Writer) error {
+		for _, part := range []any{f.base, f.check, f.value, f.offsets, f.child, f.sibling} {
+			if err := binary.Write(w, binary.LittleEndian, part); err != nil {
+				return err
+			}
+		}
+		_, err := w.Write(f.data)
+		return err
+	}
+	if err := body(crc); err != nil {
+		return 0, err
+	}
+
+	var header [frozenHeaderSize]byte
+	copy(header[:8], frozenMagic[:])
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(f.base)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(f.offsets)-1))
+	binary.LittleEndian.PutUint64(header[16:], uint64(len(f.data)))
+	binary.LittleEndian.PutUint32(header[24:], crc.Sum32())
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header[:])
+	if err := body(bw); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(f.Size()), nil
+}
+
+// Save 把冻结的Trie写到文件 path
+func (f *FrozenTrie[V]) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// OpenFrozen 把文件 path 映射进内存并打开其中冻结的Trie。
+// 打开时校验整个文件，之后的读取直接访问映射的内存，用完后调用 Close
+func OpenFrozen[V any](path string, codec Codec[V]) (*FrozenTrie[V], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < frozenHeaderSize || info.Size() > math.MaxInt {
+		return nil, fmt.Errorf("%w: %s", ErrBadFrozen, path)
+	}
+	data, release, err := mapFile(file, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	f, err := LoadFrozen(data, codec)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.release = release
+	return f, nil
+}
+
+// LoadFrozen 从 WriteTo 写出的字节中打开冻结的Trie，在小端机器上直接引用 data
+func LoadFrozen[V any](data []byte, codec Codec[V]) (*FrozenTrie[V], error) {
+	if len(data) < frozenHeaderSize || [8]byte(data[:8]) != frozenMagic {
+		return nil, ErrBadFrozen
+	}
+	slots := uint64(binary.LittleEndian.Uint32(data[8:]))
+	values := uint64(binary.LittleEndian.Uint32(data[12:]))
+	dataLen := binary.LittleEndian.Uint64(data[16:])
+	body := data[frozenHeaderSize:]
+	if slots == 0 || uint64(len(body)) != 16*slots+4*(values+1)+dataLen {
+		return nil, fmt.Errorf("%w: size mismatch", ErrCorruptTrie)
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[24:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptTrie)
+	}
+
+	take := func(n uint64) []byte {
+		part := body[:n]
+		body = body[n:]
+		return part
+	}
+	f := &FrozenTrie[V]{
+		base:    castSlice[int32](take(4 * slots)),
+		check:   castSlice[int32](take(4 * slots)),
+		value:   castSlice[uint32](take(4 * slots)),
+		offsets: castSlice[uint32](take(4 * (values + 1))),
+		child:   castSlice[uint16](take(2 * slots)),
+		sibling: castSlice[uint16](take(2 * slots)),
+		data:    body,
+		codec:   codec,
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// validate 检查下标都在范围内、节点构成以槽位0为根的树，损坏的文件不会让读取越界或遍历不停
+func (f *FrozenTrie[V]) validate() error {
+	n := len(f.base)
+	for s := 0; s < n; s++ {
+		if f.check[s] >= int32(n) || f.base[s] < 0 || int(f.base[s]) >= n && f.child[s] != 0 ||
+			f.value[s] > uint32(f.Len()) || f.child[s] > 256 || f.sibling[s] > 256 {
+			return fmt.Errorf("%w: slot %d", ErrCorruptTrie, s)
+		}
+		if f.child[s] != 0 && (int(f.base[s])+int(f.child[s]-1) >= n || f.check[int(f.base[s])+int(f.child[s]-1)] != int32(s)) {
+			return fmt.Errorf("%w: slot %d", ErrCorruptTrie, s)
+		}
+		if p := f.check[s]; p >= 0 && f.sibling[s] != 0 {
+			if t := int(f.base[p]) + int(f.sibling[s]-1); t <= s || t >= n || f.check[t] != p {
+				return fmt.Errorf("%w: slot %d", ErrCorruptTrie, s)
+			}
+		}
+	}
+	// 根没有父节点；从根广度优先遍历，每个槽位只能经一条边到达，成环的文件会让 walk 无限递归
+	if f.check[0] != -1 {
+		return fmt.Errorf("%w: root slot", ErrCorruptTrie)
+	}
+	visited := make([]bool, n)
+	visited[0] = true
+	for queue := []int32{0}; len(queue) > 0; queue = queue[1:] {
+		s := queue[0]
+		for label := f.child[s]; label != 0; {
+			t := f.base[s] + int32(label-1)
+			if visited[t] {
+				return fmt.Errorf("%w: slot %d reached twice", ErrCorruptTrie, t)
+			}
+			visited[t] = true
+			queue = append(queue, t)
+			label = f.sibling[t]
+		}
+	}
+	for i := 1; i < len(f.offsets); i++ {
+		if f.offsets[i] < f.offsets[i-1] || int(f.offsets[i]) > len(f.data) {
+			return fmt.Errorf("%w: value %d", ErrCorruptTrie, i-1)
+		}
+	}
+	return nil
+}
+
+// Close 解除文件映射，之后不能再使用 f
+func (f *FrozenTrie[V]) Close() error {
+	if f.release == nil {
+		return nil
+	}
+	release := f.release
+	f.release = nil
+	return release()
+}
+
+// littleEndian 本机是否小端，是时文件中的数组可以直接引用
+var littleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// castSlice 把小端编码的字节解释成 T 的切片，能直接引用时不复制
+func castSlice[T int32 | uint32 | uint16](b []byte) []T {
+	size := int(unsafe.Sizeof(T(0)))
+	n := len(b) / size
+	if n == 0 {
+		return []T{}
+	}
+	if littleEndian && uintptr(unsafe.Pointer(&b[0]))%uintptr(size) == 0 {
+		return unsafe.Slice((*T)(unsafe.Pointer(&b[0])), n)
+	}
+	s := make([]T, n)
+	for i := range s {
+		switch size {
+		case 4:
+			s[i] = T(binary.LittleEndian.Uint32(b[4*i:]))
+		default:
+			s[i] = T(binary.LittleEndian.Uint16(b[2*i:]))
+		}
+	}
+	return s
+}
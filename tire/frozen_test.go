@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// walkAll 收集 WalkPrefix 给出的单词和值
+func walkAll[V any](walk func(prefix string, fn func(string, V) bool), prefix string) []string {
+	var got []string
+	walk(prefix, func(word string, value V) bool {
+		got = append(got, fmt.Sprintf("%s=%v", word, value))
+		return true
+	})
+	return got
+}
+
+// checkFrozen 冻结的Trie与原来的Trie对同样的查询给出同样的结果
+func checkFrozen(t *testing.T, trie *Trie[string], f *FrozenTrie[string], queries []string) {
+	t.Helper()
+	all := walkAll(trie.WalkPrefix, "")
+	if f.Len() != len(all) {
+		t.Fatalf("Len = %d, want %d", f.Len(), len(all))
+	}
+	if got := walkAll(f.WalkPrefix, ""); !slices.Equal(got, all) {
+		t.Fatalf("WalkPrefix(\"\") = %q, want %q", got, all)
+	}
+	for _, q := range queries {
+		want, wantOK := trie.Search(q)
+		if got, ok := f.Search(q); got != want || ok != wantOK {
+			t.Fatalf("Search(%q) = %q, %v; want %q, %v", q, got, ok, want, wantOK)
+		}
+		if got, want := f.StartsWith(q), trie.StartsWith(q); !slices.Equal(got, want) {
+			t.Fatalf("StartsWith(%q) = %q, want %q", q, got, want)
+		}
+	}
+}
+
+func TestFreezeRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pieces := []string{"a", "b", "z", "中", "中国", "é", "🙂", "\x00"}
+	word := func() string {
+		var b strings.Builder
+		for n := rng.Intn(6); n > 0; n-- {
+			b.WriteString(pieces[rng.Intn(len(pieces))])
+		}
+		return b.String()
+	}
+	dir := t.TempDir()
+	for round := 0; round < 50; round++ {
+		trie := NewTrie[string]()
+		for n := rng.Intn(300); n > 0; n-- {
+			trie.Insert(word(), word())
+		}
+		queries := []string{""}
+		for n := 0; n < 100; n++ {
+			queries = append(queries, word())
+		}
+
+		f := trie.Freeze(StringCodec{})
+		checkFrozen(t, trie, f, queries)
+		// 冻结的Trie按字节查找，前缀可以停在字符中间
+		if got, want := walkAll(f.WalkPrefix, "中"[:1]), walkAll(trie.WalkPrefix, "中"); !slices.Equal(got, want) {
+			t.Fatalf("WalkPrefix(\\xe4) = %q, want %q", got, want)
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%d.da", round))
+		if err := f.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() != int64(f.Size()) {
+			t.Fatalf("file size %v, %v; want %d", info.Size(), err, f.Size())
+		}
+		opened, err := OpenFrozen(path, StringCodec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFrozen(t, trie, opened, queries)
+		if err := opened.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestFreezeSnapshot 冻结后修改Trie不影响冻结的Trie
+func TestFreezeSnapshot(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert("中华", "a")
+	f := trie.Freeze(StringCodec{})
+	trie.Insert("中华人民共和国", "b")
+	trie.Delete("中华")
+	if v, ok := f.Search("中华"); !ok || v != "a" {
+		t.Fatalf("Search(中华) = %q, %v", v, ok)
+	}
+	if _, ok := f.Search("中华人民共和国"); ok {
+		t.Fatal("word inserted after Freeze is visible")
+	}
+	empty := NewTrie[string]().Freeze(StringCodec{})
+	if empty.Len() != 0 || empty.StartsWith("") != nil {
+		t.Fatal("empty frozen trie has words")
+	}
+}
+
+func TestLoadFrozenCorrupt(t *testing.T) {
+	trie := NewTrie[string]()
+	for _, w := range []string{"he", "she", "his", "hers"} {
+		trie.Insert(w, "v"+w)
+	}
+	var buf strings.Builder
+	if _, err := trie.Freeze(StringCodec{}).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	good := []byte(buf.String())
+	if _, err := LoadFrozen(good, StringCodec{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFrozen(good[:20], StringCodec{}); !errors.Is(err, ErrBadFrozen) {
+		t.Errorf("short file: %v", err)
+	}
+	if _, err := LoadFrozen(good[:len(good)-1], StringCodec{}); !errors.Is(err, ErrCorruptTrie) {
+		t.Errorf("truncated file: %v", err)
+	}
+	for _, i := range []int{0, frozenHeaderSize + 5, len(good) - 1} {
+		bad := slices.Clone(good)
+		bad[i] ^= 0x40
+		if _, err := LoadFrozen(bad, StringCodec{}); err == nil {
+			t.Errorf("byte %d flipped: no error", i)
+		}
+	}
+}
+
+// TestLoadFrozenCycle 校验和正确但节点成环的文件，打开时报错而不是让遍历无限递归
+func TestLoadFrozenCycle(t *testing.T) {
+	trie := NewTrie[string]()
+	for _, w := range []string{"he", "she"} {
+		trie.Insert(w, "v"+w)
+	}
+	for _, corrupt := range []func(f *FrozenTrie[string]){
+		// 根的第一个子节点是根自己
+		func(f *FrozenTrie[string]) { f.base[0], f.child[0], f.check[0] = 0, 1, 0 },
+		// 根挂在另一个节点下
+		func(f *FrozenTrie[string]) { f.check[0] = f.base[0] + int32(f.child[0]-1) },
+	} {
+		f := trie.Freeze(StringCodec{})
+		corrupt(f)
+		var buf strings.Builder
+		if _, err := f.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFrozen([]byte(buf.String()), StringCodec{}); !errors.Is(err, ErrCorruptTrie) {
+			t.Errorf("cyclic trie: %v, want ErrCorruptTrie", err)
+		}
+	}
+}
+
+// frozenWords 生成 n 个中英文混合的单词，模拟分词词典
+func frozenWords(n int) []string {
+	rng := rand.New(rand.NewSource(3))
+	common := []rune("的一是在不了有和人这中大为上个国我以要他时来用们生到作地于出就分对成会可主发年动同工也能下过子说产种面而方后多定行学法所民得经十三之进着等部度家电力里如水化高自二理起小物现实加量都两体制机当使点从业本去把性好应开它合还因由其些然前外天政四日那社义事平形相全表间样与关各重新线内数正心反你明看原又么利比或但质气第向道命此变条只没结解问意建月公无系军很情者最立代想已通并提直题党程展五果料象员革位入常文总次品式活设及管特件长求老头基资边流路级少图山统接知较将组见计别她手角期根论运农指几九区强放决西被干做必战先回则任取据处理")
+	seen := make(map[string]bool, n)
+	words := make([]string, 0, n)
+	for len(words) < n {
+		var b strings.Builder
+		if rng.Intn(2) == 0 {
+			for l := 2 + rng.Intn(3); l > 0; l-- {
+				b.WriteRune(common[rng.Intn(len(common))])
+			}
+		} else {
+			for l := 3 + rng.Intn(8); l > 0; l-- {
+				b.WriteByte(byte('a' + rng.Intn(26)))
+			}
+		}
+		if w := b.String(); !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+var frozenBench = sync.OnceValues(func() ([]string, *Trie[string]) {
+	words := frozenWords(500000)
+	trie := NewTrie[string]()
+	for _, w := range words {
+		trie.Insert(w, w)
+	}
+	return words, trie
+})
+
+// heapSize 强制回收后的堆大小
+func heapSize() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// BenchmarkSize 报告同一词典在两种表示下的大小: 指针Trie的堆占用和冻结后的文件大小
+func BenchmarkSize(b *testing.B) {
+	words := frozenWords(500000)
+	for i := 0; i < b.N; i++ {
+		before := heapSize()
+		trie := NewTrie[string]()
+		for _, w := range words {
+			trie.Insert(w, w)
+		}
+		b.ReportMetric(float64(heapSize()-before)/float64(len(words)), "trie-B/word")
+		f := trie.Freeze(StringCodec{})
+		b.ReportMetric(float64(f.Size())/float64(len(words)), "frozen-B/word")
+		runtime.KeepAlive(trie)
+	}
+}
+
+func BenchmarkFreeze(b *testing.B) {
+	_, trie := frozenBench()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Freeze(StringCodec{})
+	}
+}
+
+func BenchmarkFrozenSearch(b *testing.B) {
+	words, trie := frozenBench()
+	f := trie.Freeze(StringCodec{})
+	path := filepath.Join(b.TempDir(), "dict.da")
+	if err := f.Save(path); err != nil {
+		b.Fatal(err)
+	}
+	mapped, err := OpenFrozen(path, StringCodec{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer mapped.Close()
+	for _, c := range []struct {
+		name   string
+		search func(string) (string, bool)
+	}{{"trie", trie.Search}, {"frozen", f.Search}, {"mmap", mapped.Search}} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, ok := c.search(words[i%len(words)]); !ok {
+					b.Fatal("missing word")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFrozenWalkPrefix(b *testing.B) {
+	words, trie := frozenBench()
+	f := trie.Freeze(StringCodec{})
+	for _, c := range []struct {
+		name string
+		walk func(string, func(string, string) bool)
+	}{{"trie", trie.WalkPrefix}, {"frozen", f.WalkPrefix}} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				w := words[i%len(words)]
+				c.walk(w[:len(w)/2], func(string, string) bool { return true })
+			}
+		})
+	}
+}
@@ -1,234 +1,420 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"maps"
+	"math"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+
+	"github.com/cg917658910/go-study/lib/repl"
 )
 
 // TrieNode 表示Trie树的节点
-type TrieNode struct {
-	children map[rune]*TrieNode // 子节点
-	isEnd    bool               // 是否单词结束
-	value    string             // 存储的值
+type TrieNode[V any] struct {
+	children map[rune]*TrieNode[V] // 子节点
+	isEnd    bool                  // 是否单词结束
+	value    V                     // 存储的值
+	weight   float64               // 单词的权重(词频或评分)
+	best     float64               // 子树中单词的最大权重，子树中没有单词时为负无穷
 }
 
 // NewTrieNode 创建新的Trie节点
-func NewTrieNode() *TrieNode {
-	return &TrieNode{
-		children: make(map[rune]*TrieNode),
+func NewTrieNode[V any]() *TrieNode[V] {
+	return &TrieNode[V]{
+		children: make(map[rune]*TrieNode[V]),
 		isEnd:    false,
-		value:    "",
+		best:     math.Inf(-1),
 	}
 }
 
-// Trie 表示Trie树结构
-type Trie struct {
-	root *TrieNode
+// Trie 表示Trie树结构，单词对应类型为 V 的值
+type Trie[V any] struct {
+	root *TrieNode[V]
+	size int // 单词数
 }
 
 // NewTrie 创建新的Trie树
-func NewTrie() *Trie {
-	return &Trie{root: NewTrieNode()}
+func NewTrie[V any]() *Trie[V] {
+	return &Trie[V]{root: NewTrieNode[V]()}
+}
+
+// Insert 插入单词和值。已有的单词保留原来的权重，新单词的权重为 0
+func (t *Trie[V]) Insert(word string, value V) {
+	path := t.insertPath(word)
+	node := path[len(path)-1]
+	weight := node.weight
+	if !node.isEnd {
+		weight = 0
+	}
+	t.setWeight(path, value, weight)
+}
+
+// InsertWeighted 插入单词、值和权重，单词已存在时覆盖值和权重
+func (t *Trie[V]) InsertWeighted(word string, value V, weight float64) {
+	t.setWeight(t.insertPath(word), value, weight)
+}
+
+// AddWeight 给已有的单词加上 delta 的权重，比如每被搜索一次加 1
+func (t *Trie[V]) AddWeight(word string, delta float64) bool {
+	path := t.path(word)
+	if path == nil || !path[len(path)-1].isEnd {
+		return false
+	}
+	node := path[len(path)-1]
+	t.setWeight(path, node.value, node.weight+delta)
+	return true
 }
 
-// Insert 插入单词和值
-func (t *Trie) Insert(word string, value string) {
+// insertPath 返回从根到 word 的节点，缺少的节点沿途创建
+func (t *Trie[V]) insertPath(word string) []*TrieNode[V] {
 	node := t.root
+	path := []*TrieNode[V]{node}
 	for _, ch := range word {
 		if _, ok := node.children[ch]; !ok {
-			node.children[ch] = NewTrieNode()
+			node.children[ch] = NewTrieNode[V]()
 		}
 		node = node.children[ch]
+		path = append(path, node)
 	}
-	node.isEnd = true
-	node.value = value
+	return path
 }
 
-// Search 精确查找单词
-func (t *Trie) Search(word string) (string, bool) {
+// path 返回从根到 word 的节点，word 不在树中时返回 nil
+func (t *Trie[V]) path(word string) []*TrieNode[V] {
 	node := t.root
+	path := []*TrieNode[V]{node}
 	for _, ch := range word {
 		if _, ok := node.children[ch]; !ok {
-			return "", false
+			return nil
 		}
 		node = node.children[ch]
+		path = append(path, node)
 	}
-	return node.value, node.isEnd
+	return path
+}
+
+// setWeight 把 path 的最后一个节点标记为单词，并更新沿途的最大权重
+func (t *Trie[V]) setWeight(path []*TrieNode[V], value V, weight float64) {
+	node := path[len(path)-1]
+	if !node.isEnd {
+		t.size++
+	}
+	node.isEnd = true
+	node.value = value
+	node.weight = weight
+	refreshBest(path)
+}
+
+// Len 单词数
+func (t *Trie[V]) Len() int {
+	return t.size
 }
 
-// StartsWith 查找前缀匹配的所有单词
-func (t *Trie) StartsWith(prefix string) []string {
+// refreshBest 自下而上重新计算 path 上节点的子树最大权重，某个节点不变时上面的也不变
+func refreshBest[V any](path []*TrieNode[V]) {
+	for i := len(path) - 1; i >= 0; i-- {
+		node := path[i]
+		best := math.Inf(-1)
+		if node.isEnd {
+			best = node.weight
+		}
+		for _, child := range node.children {
+			best = max(best, child.best)
+		}
+		if best == node.best {
+			return
+		}
+		node.best = best
+	}
+}
+
+// Search 精确查找单词
+func (t *Trie[V]) Search(word string) (V, bool) {
 	node := t.root
-	// 先定位到前缀的最后一个节点
-	for _, ch := range prefix {
+	for _, ch := range word {
 		if _, ok := node.children[ch]; !ok {
-			return nil
+			var zero V
+			return zero, false
 		}
 		node = node.children[ch]
 	}
+	return node.value, node.isEnd
+}
 
-	// 收集所有以该前缀开头的单词
+// StartsWith 查找前缀匹配的所有单词，按单词排序
+func (t *Trie[V]) StartsWith(prefix string) []string {
 	var results []string
-	t.collectWords(node, prefix, &results)
+	t.WalkPrefix(prefix, func(word string, value V) bool {
+		results = append(results, fmt.Sprintf("%s -> %v", word, value))
+		return true
+	})
 	return results
 }
 
-// collectWords 递归收集单词
-func (t *Trie) collectWords(node *TrieNode, prefix string, results *[]string) {
-	if node.isEnd {
-		*results = append(*results, prefix+" -> "+node.value)
-	}
-
-	for ch, child := range node.children {
-		t.collectWords(child, prefix+string(ch), results)
+// WalkPrefix 按字典序对以 prefix 开头的每个单词调用 fn，fn 返回 false 时停止
+func (t *Trie[V]) WalkPrefix(prefix string, fn func(word string, value V) bool) {
+	path := t.path(prefix)
+	if path == nil {
+		return
 	}
+	t.walk(path[len(path)-1], prefix, func(word string, node *TrieNode[V]) bool {
+		return fn(word, node.value)
+	})
 }
 
-// Delete 删除单词
-func (t *Trie) Delete(word string) bool {
-	nodes := make([]*TrieNode, 0, len(word)+1)
-	node := t.root
-	nodes = append(nodes, node)
-
-	// 查找单词路径上的所有节点
-	for _, ch := range word {
-		if _, ok := node.children[ch]; !ok {
-			return false // 单词不存在
+// walk 先序遍历以 node 为根的子树，对每个单词结尾的节点调用 fn。子节点按字符排序，即单词按字典序
+func (t *Trie[V]) walk(node *TrieNode[V], word string, fn func(word string, node *TrieNode[V]) bool) bool {
+	if node.isEnd && !fn(word, node) {
+		return false
+	}
+	for _, ch := range slices.Sorted(maps.Keys(node.children)) {
+		if !t.walk(node.children[ch], word+string(ch), fn) {
+			return false
 		}
-		node = node.children[ch]
-		nodes = append(nodes, node)
 	}
+	return true
+}
 
-	if !node.isEnd {
-		return false // 不是完整单词
+// Delete 删除单词
+func (t *Trie[V]) Delete(word string) bool {
+	// 查找单词路径上的所有节点，nodes[i] 是 nodes[i-1] 经字符 runes[i-1] 到达的子节点
+	nodes := t.path(word)
+	if nodes == nil || !nodes[len(nodes)-1].isEnd {
+		return false // 单词不存在
 	}
+	runes := []rune(word)
 
 	// 标记为非单词结尾
+	node := nodes[len(nodes)-1]
+	var zero V
 	node.isEnd = false
-	node.value = ""
+	node.value = zero
+	node.weight = 0
+	t.size--
+	defer refreshBest(nodes)
 
 	// 从后向前删除无用节点
 	for i := len(nodes) - 1; i > 0; i-- {
 		current := nodes[i]
-		parent := nodes[i-1]
-		ch := rune(word[i-1])
-
-		if len(current.children) == 0 && !current.isEnd {
-			delete(parent.children, ch)
-		} else {
+		if len(current.children) != 0 || current.isEnd {
 			break
 		}
+		delete(nodes[i-1].children, runes[i-1])
 	}
-
 	return true
 }
 
-// Print 打印Trie树结构
-func (t *Trie) Print() {
-	fmt.Println("Trie结构:")
-	t.printNode(t.root, 0)
+// Print 把Trie树结构打印到 w，子节点按字符排序
+func (t *Trie[V]) Print(w io.Writer) {
+	fmt.Fprintln(w, "Trie结构:")
+	t.printNode(w, t.root, 0)
 }
 
 // printNode 递归打印节点
-func (t *Trie) printNode(node *TrieNode, level int) {
+func (t *Trie[V]) printNode(w io.Writer, node *TrieNode[V], level int) {
 	prefix := strings.Repeat("  ", level)
-	for ch, child := range node.children {
+	for _, ch := range slices.Sorted(maps.Keys(node.children)) {
+		child := node.children[ch]
 		endMark := ""
 		if child.isEnd {
 			endMark = "*"
 		}
-		fmt.Printf("%s├─ %c%s\n", prefix, ch, endMark)
-		t.printNode(child, level+1)
+		fmt.Fprintf(w, "%s├─ %c%s\n", prefix, ch, endMark)
+		t.printNode(w, child, level+1)
 	}
 }
 
-func main() {
-	trie := NewTrie()
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Println("Trie树命令行工具")
-	fmt.Println("命令:")
-	fmt.Println("  insert <word> <value> - 插入单词")
-	fmt.Println("  search <word>        - 搜索单词")
-	fmt.Println("  prefix <prefix>      - 前缀搜索")
-	fmt.Println("  delete <word>        - 删除单词")
-	fmt.Println("  print                - 打印Trie结构")
-	fmt.Println("  exit                 - 退出")
-
-	for {
-		fmt.Print("> ")
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		parts := strings.Split(input, " ")
-
-		if len(parts) == 0 {
-			continue
-		}
+// match JSON输出中 search 的结果
+type match struct {
+	Word  string `json:"word"`
+	Value string `json:"value,omitempty"`
+	Found bool   `json:"found"`
+}
 
-		switch parts[0] {
-		case "insert":
-			if len(parts) < 3 {
-				/* fmt.Println("Usage: insert <word> <value>")
-				continue */
-				parts = append(parts, "v"+parts[1])
+// newCLI 创建操作 trie 的命令解释器
+func newCLI(trie *Trie[string]) *repl.Interpreter {
+	return repl.New("Trie树命令行工具",
+		repl.Command{Name: "insert", Usage: "<word> [value]", Help: "插入单词，省略值时为 v<word>", Args: 1, Run: func(c *repl.Context, args []string) error {
+			word, value := args[0], "v"+args[0]
+			if len(args) > 1 {
+				value = strings.Join(args[1:], " ")
 			}
-			word := parts[1]
-			value := strings.Join(parts[2:], " ")
 			trie.Insert(word, value)
-			fmt.Printf("已插入: %s -> %s\n", word, value)
-			trie.Print()
-
-		case "search":
-			if len(parts) < 2 {
-				fmt.Println("Usage: search <word>")
-				continue
-			}
-			word := parts[1]
-			if value, found := trie.Search(word); found {
-				fmt.Printf("找到: %s -> %s\n", word, value)
+			c.Infof("已插入: %s -> %s\n", word, value)
+			return nil
+		}},
+		repl.Command{Name: "search", Usage: "<word>", Help: "搜索单词", Args: 1, Run: func(c *repl.Context, args []string) error {
+			word := args[0]
+			value, found := trie.Search(word)
+			if found {
+				c.Printf("找到: %s -> %s\n", word, value)
 			} else {
-				fmt.Printf("未找到: %s\n", word)
+				c.Printf("未找到: %s\n", word)
 			}
-
-		case "prefix":
-			if len(parts) < 2 {
-				fmt.Println("Usage: prefix <prefix>")
-				continue
-			}
-			prefix := parts[1]
+			c.Result(match{word, value, found})
+			return nil
+		}},
+		repl.Command{Name: "prefix", Usage: "<prefix>", Help: "前缀搜索", Args: 1, Run: func(c *repl.Context, args []string) error {
+			prefix := args[0]
 			results := trie.StartsWith(prefix)
 			if len(results) > 0 {
-				fmt.Printf("前缀匹配 %s:\n", prefix)
+				c.Printf("前缀匹配 %s:\n", prefix)
 				for _, res := range results {
-					fmt.Println("  ", res)
+					c.Println("  ", res)
 				}
 			} else {
-				fmt.Printf("没有找到以 %s 开头的单词\n", prefix)
+				c.Printf("没有找到以 %s 开头的单词\n", prefix)
 			}
-
-		case "delete":
-			if len(parts) < 2 {
-				fmt.Println("Usage: delete <word>")
-				continue
+			c.Result(append([]string{}, results...))
+			return nil
+		}},
+		repl.Command{Name: "weight", Usage: "<word> <weight> [value]", Help: "插入带权重的单词，省略值时为 v<word>", Args: 2, Run: func(c *repl.Context, args []string) error {
+			weight, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				return fmt.Errorf("无效权重: %s", args[1])
+			}
+			word, value := args[0], "v"+args[0]
+			if len(args) > 2 {
+				value = strings.Join(args[2:], " ")
+			}
+			trie.InsertWeighted(word, value, weight)
+			c.Infof("已插入: %s -> %s (权重 %g)\n", word, value, weight)
+			return nil
+		}},
+		repl.Command{Name: "hit", Usage: "<word> [delta]", Help: "给单词加权重，默认加 1", Args: 1, Run: func(c *repl.Context, args []string) error {
+			delta := 1.0
+			if len(args) > 1 {
+				var err error
+				if delta, err = strconv.ParseFloat(args[1], 64); err != nil {
+					return fmt.Errorf("无效权重: %s", args[1])
+				}
+			}
+			if !trie.AddWeight(args[0], delta) {
+				c.Printf("未找到: %s\n", args[0])
+				return nil
+			}
+			c.Infof("已更新权重: %s\n", args[0])
+			return nil
+		}},
+		repl.Command{Name: "topk", Usage: "<prefix> [k]", Help: "按权重补全前缀，默认返回 10 个", Args: 1, Run: func(c *repl.Context, args []string) error {
+			k := 10
+			if len(args) > 1 {
+				var err error
+				if k, err = strconv.Atoi(args[1]); err != nil || k <= 0 {
+					return fmt.Errorf("无效数量: %s", args[1])
+				}
+			}
+			results := trie.TopK(args[0], k)
+			if len(results) == 0 {
+				c.Printf("没有找到以 %s 开头的单词\n", args[0])
+			}
+			for i, s := range results {
+				c.Printf("  %d. %s (%g) -> %s\n", i+1, s.Word, s.Weight, s.Value)
 			}
-			word := parts[1]
+			c.Result(append([]Suggestion[string]{}, results...))
+			return nil
+		}},
+		repl.Command{Name: "fuzzy", Usage: "<word> [maxEdits]", Help: "模糊查找编辑距离不超过 maxEdits 的单词，默认 1", Args: 1, Run: func(c *repl.Context, args []string) error {
+			maxEdits := 1
+			if len(args) > 1 {
+				var err error
+				if maxEdits, err = strconv.Atoi(args[1]); err != nil || maxEdits < 0 {
+					return fmt.Errorf("无效编辑距离: %s", args[1])
+				}
+			}
+			results := trie.Fuzzy(args[0], maxEdits)
+			if len(results) == 0 {
+				c.Printf("没有与 %s 相近的单词\n", args[0])
+			}
+			for _, s := range results {
+				c.Printf("  %s (距离 %d, 权重 %g) -> %s\n", s.Word, s.Distance, s.Weight, s.Value)
+			}
+			c.Result(append([]Suggestion[string]{}, results...))
+			return nil
+		}},
+		repl.Command{Name: "match", Usage: "<text> [all|first|longest]", Help: "以全部单词为模式在文本中多模式匹配，默认报告全部匹配", Args: 1, Run: func(c *repl.Context, args []string) error {
+			var opts []MatchOption
+			if len(args) > 1 {
+				switch args[1] {
+				case "all":
+				case "first":
+					opts = append(opts, NonOverlapping())
+				case "longest":
+					opts = append(opts, LeftmostLongest())
+				default:
+					return fmt.Errorf("未知匹配方式: %s", args[1])
+				}
+			}
+			matches := trie.Compile(opts...).FindAll(args[0])
+			if len(matches) == 0 {
+				c.Println("没有匹配")
+			}
+			for _, m := range matches {
+				c.Printf("  [%d,%d) %s -> %s\n", m.Start, m.End, m.Pattern, m.Value)
+			}
+			c.Result(append([]Match[string]{}, matches...))
+			return nil
+		}},
+		repl.Command{Name: "delete", Usage: "<word>", Help: "删除单词", Args: 1, Run: func(c *repl.Context, args []string) error {
+			word := args[0]
 			if trie.Delete(word) {
-				fmt.Printf("已删除: %s\n", word)
+				c.Infof("已删除: %s\n", word)
 			} else {
-				fmt.Printf("删除失败，未找到: %s\n", word)
+				c.Printf("删除失败，未找到: %s\n", word)
 			}
-			trie.Print()
-		case "print":
-			trie.Print()
-
-		case "exit":
-			fmt.Println("退出...")
-			return
+			return nil
+		}},
+		repl.Command{Name: "load", Usage: "<file>", Help: "装载词典: .json 文件或每行 word<TAB>value[<TAB>weight] 的文本", Args: 1, Run: func(c *repl.Context, args []string) error {
+			n, err := loadDict(trie, args[0])
+			if err != nil {
+				return fmt.Errorf("装载失败(已插入 %d 个): %w", n, err)
+			}
+			c.Infof("已装载 %d 个单词\n", n)
+			return nil
+		}},
+		repl.Command{Name: "save", Usage: "<file>", Help: "按单词排序保存词典，.json 文件保存为JSON，否则为TSV", Args: 1, Run: func(c *repl.Context, args []string) error {
+			n, err := saveDict(trie, args[0])
+			if err != nil {
+				return fmt.Errorf("保存失败: %w", err)
+			}
+			c.Infof("已保存 %d 个单词\n", n)
+			return nil
+		}},
+		repl.Command{Name: "count", Help: "单词数", Run: func(c *repl.Context, _ []string) error {
+			c.Printf("单词数: %d\n", trie.Len())
+			c.Result(trie.Len())
+			return nil
+		}},
+		repl.Command{Name: "print", Help: "打印Trie结构", Run: func(c *repl.Context, _ []string) error {
+			trie.Print(c.Writer())
+			return nil
+		}},
+	)
+}
 
-		default:
-			fmt.Println("未知命令")
+func main() {
+	trie := NewTrie[string]()
+	cli := newCLI(trie)
+	dict := flag.String("dict", "", "启动时装载的词典文件，格式同 load 命令")
+	cli.Flags(flag.CommandLine)
+	flag.Parse()
+	if *dict != "" {
+		n, err := loadDict(trie, *dict)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "装载词典失败:", err)
+			os.Exit(1)
+		}
+		if !cli.Quiet {
+			fmt.Printf("已装载 %d 个单词\n", n)
 		}
 	}
+	if err := cli.Main(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/cg917658910/go-study/lib/repl"
+	"github.com/cg917658910/go-study/lib/repl/repltest"
+)
+
+// TestScripts 执行 testdata 下的命令脚本，与 *.golden 对照输出
+func TestScripts(t *testing.T) {
+	repltest.Golden(t, "testdata", func(t *testing.T) *repl.Interpreter {
+		return newCLI(NewTrie[string]())
+	})
+}
+
+// trieOp 一次随机操作
+type trieOp struct {
+	Delete bool
+	Key    string
+	Value  int
+}
+
+// trieOps 随机操作序列。键由中文、组合字符、emoji 和 ASCII 拼成，短键多，使操作频繁落在同一批键和前缀上
+type trieOps []trieOp
+
+func (trieOps) Generate(rng *rand.Rand, size int) reflect.Value {
+	pieces := []string{"a", "b", "中", "中国", "国", "é", "é", "🙂", "𝄞"}
+	ops := make(trieOps, size*10)
+	for i := range ops {
+		var b strings.Builder
+		for n := rng.Intn(5); n > 0; n-- {
+			b.WriteString(pieces[rng.Intn(len(pieces))])
+		}
+		ops[i] = trieOp{Delete: rng.Intn(3) == 0, Key: b.String(), Value: rng.Intn(1000)}
+	}
+	return reflect.ValueOf(ops)
+}
+
+// checkTrie 校验除根以外的节点都是单词结尾或有子节点，子树最大权重正确，
+// 并返回树中的全部单词和值
+func checkTrie[V any](t *testing.T, trie *Trie[V]) map[string]V {
+	t.Helper()
+	words := make(map[string]V)
+	var walk func(node *TrieNode[V], word string, root bool) float64
+	walk = func(node *TrieNode[V], word string, root bool) float64 {
+		if !root && !node.isEnd && len(node.children) == 0 {
+			t.Fatalf("dead node at %q", word)
+		}
+		best := math.Inf(-1)
+		if node.isEnd {
+			words[word] = node.value
+			best = node.weight
+		}
+		for ch, child := range node.children {
+			best = max(best, walk(child, word+string(ch), false))
+		}
+		if best != node.best {
+			t.Fatalf("node %q: best %v, want %v", word, node.best, best)
+		}
+		return best
+	}
+	walk(trie.root, "", true)
+	return words
+}
+
+// TestTrieProperties 随机操作序列下Trie与 map 的行为一致
+func TestTrieProperties(t *testing.T) {
+	property := func(ops trieOps) bool {
+		trie := NewTrie[int]()
+		model := make(map[string]int)
+		for _, op := range ops {
+			if op.Delete {
+				_, exists := model[op.Key]
+				if trie.Delete(op.Key) != exists {
+					t.Logf("Delete(%q) != %v", op.Key, exists)
+					return false
+				}
+				delete(model, op.Key)
+			} else {
+				trie.Insert(op.Key, op.Value)
+				model[op.Key] = op.Value
+			}
+			got, ok := trie.Search(op.Key)
+			want, wantOK := model[op.Key]
+			if got != want || ok != wantOK {
+				t.Logf("Search(%q) = %v, %v; want %v, %v", op.Key, got, ok, want, wantOK)
+				return false
+			}
+		}
+		if words := checkTrie(t, trie); !maps.Equal(words, model) {
+			t.Logf("trie holds %v, want %v", words, model)
+			return false
+		}
+		for key := range model {
+			if !trie.Delete(key) {
+				return false
+			}
+		}
+		return len(trie.root.children) == 0 && !trie.root.isEnd
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 300, Rand: rand.New(rand.NewSource(1))}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDeleteNonASCII 删除中文单词后不留下无用的节点
+func TestDeleteNonASCII(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert("中华", "")
+	trie.Insert("中华人民共和国", "PRC")
+	if !trie.Delete("中华人民共和国") {
+		t.Fatal("Delete(中华人民共和国) = false")
+	}
+	checkTrie(t, trie)
+	if got := trie.StartsWith("中"); !slices.Equal(got, []string{"中华 -> "}) {
+		t.Fatalf("StartsWith(中) = %q", got)
+	}
+}
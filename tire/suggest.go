@@ -0,0 +1,157 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"maps"
+	"math"
+	"slices"
+)
+
+// Suggestion 补全和模糊查找的结果
+type Suggestion[V any] struct {
+	Word     string  `json:"word"`
+	Value    V       `json:"value"`
+	Weight   float64 `json:"weight"`
+	Distance int     `json:"distance"` // 与查询词的编辑距离，TopK 中为 0
+}
+
+// TopK 返回以 prefix 开头、权重最大的 k 个单词，按权重降序，权重相同时按单词排序。
+//
+// 每个节点记着子树中的最大权重，按它做最佳优先搜索: 堆中既有待展开的节点，也有已确定的单词，
+// 堆顶是单词时，剩下的任何单词都不会比它更好，因此只需展开与结果相关的节点
+func (t *Trie[V]) TopK(prefix string, k int) []Suggestion[V] {
+	path := t.path(prefix)
+	if path == nil || k <= 0 {
+		return nil
+	}
+	start := path[len(path)-1]
+	if math.IsInf(start.best, -1) {
+		// 只有空树的根下面没有单词
+		return nil
+	}
+
+	q := &searchQueue[V]{{node: start, word: prefix, weight: start.best}}
+	var results []Suggestion[V]
+	for q.Len() > 0 && len(results) < k {
+		item := heap.Pop(q).(searchItem[V])
+		node := item.node
+		if item.final {
+			results = append(results, Suggestion[V]{Word: item.word, Value: node.value, Weight: node.weight})
+			continue
+		}
+		if node.isEnd {
+			heap.Push(q, searchItem[V]{node: node, word: item.word, weight: node.weight, final: true})
+		}
+		for ch, child := range node.children {
+			heap.Push(q, searchItem[V]{node: child, word: item.word + string(ch), weight: child.best})
+		}
+	}
+	return results
+}
+
+// searchItem TopK 搜索堆中的一项: 待展开的节点，或者 final 为 true 时节点上的单词
+type searchItem[V any] struct {
+	node   *TrieNode[V]
+	word   string
+	weight float64 // 节点为子树的最大权重，单词为它自己的权重
+	final  bool
+}
+
+// searchQueue 按权重降序、单词升序排列的堆。
+// 未展开的节点排在同权重、字典序更大的单词之前，它的子树里可能有更靠前的单词
+type searchQueue[V any] []searchItem[V]
+
+func (q searchQueue[V]) Len() int { return len(q) }
+func (q searchQueue[V]) Less(i, j int) bool {
+	if q[i].weight != q[j].weight {
+		return q[i].weight > q[j].weight
+	}
+	return q[i].word < q[j].word
+}
+func (q searchQueue[V]) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *searchQueue[V]) Push(x any)   { *q = append(*q, x.(searchItem[V])) }
+func (q *searchQueue[V]) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Fuzzy 返回与 word 的编辑距离(插入、删除、替换一个字符各算一次)不超过 maxEdits 的单词，
+// 按距离升序、权重降序、单词升序排列。
+// 沿Trie向下时让 word 的Levenshtein自动机读入路径上的字符，自动机不可能再接受时剪掉整棵子树
+func (t *Trie[V]) Fuzzy(word string, maxEdits int) []Suggestion[V] {
+	if maxEdits < 0 {
+		return nil
+	}
+	lev := newLevenshtein(word, maxEdits)
+	var results []Suggestion[V]
+	var search func(node *TrieNode[V], prefix []rune, state []int)
+	search = func(node *TrieNode[V], prefix []rune, state []int) {
+		if node.isEnd && lev.isMatch(state) {
+			results = append(results, Suggestion[V]{Word: string(prefix), Value: node.value, Weight: node.weight, Distance: lev.distance(state)})
+		}
+		for _, ch := range slices.Sorted(maps.Keys(node.children)) {
+			if next := lev.step(state, ch); lev.canMatch(next) {
+				search(node.children[ch], append(prefix, ch), next)
+			}
+		}
+	}
+	search(t.root, nil, lev.start())
+
+	slices.SortFunc(results, func(a, b Suggestion[V]) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(b.Weight, a.Weight), cmp.Compare(a.Word, b.Word))
+	})
+	return results
+}
+
+// levenshtein 接受与 word 编辑距离不超过 max 的字符串的自动机。
+// 状态是动态规划表的一行: 第 i 项为 word 的前 i 个字符与已读入的字符串的编辑距离，
+// 超过 max 的值都记为 max+1，因此状态数有限
+type levenshtein struct {
+	word []rune
+	max  int
+}
+
+func newLevenshtein(word string, max int) levenshtein {
+	return levenshtein{word: []rune(word), max: max}
+}
+
+// start 初始状态: 还没有读入字符
+func (l levenshtein) start() []int {
+	state := make([]int, len(l.word)+1)
+	for i := range state {
+		state[i] = min(i, l.max+1)
+	}
+	return state
+}
+
+// step 读入字符 r 后的状态
+func (l levenshtein) step(state []int, r rune) []int {
+	next := make([]int, len(state))
+	next[0] = min(state[0]+1, l.max+1)
+	for i := 1; i < len(state); i++ {
+		cost := 1
+		if l.word[i-1] == r {
+			cost = 0
+		}
+		next[i] = min(state[i-1]+cost, state[i]+1, next[i-1]+1, l.max+1)
+	}
+	return next
+}
+
+// isMatch 已读入的字符串是否被接受
+func (l levenshtein) isMatch(state []int) bool {
+	return state[len(state)-1] <= l.max
+}
+
+// canMatch 再读入一些字符后是否还可能被接受。每项在读入字符后不会变小
+func (l levenshtein) canMatch(state []int) bool {
+	return slices.Min(state) <= l.max
+}
+
+// distance 已读入的字符串与 word 的编辑距离，只在 isMatch 时准确
+func (l levenshtein) distance(state []int) int {
+	return state[len(state)-1]
+}
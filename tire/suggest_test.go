@@ -0,0 +1,115 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// editDistance 朴素的Levenshtein距离，作为对照
+func editDistance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	prev := make([]int, len(y)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		cur := make([]int, len(y)+1)
+		cur[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j-1]+cost, prev[j]+1, cur[j-1]+1)
+		}
+		prev = cur
+	}
+	return prev[len(y)]
+}
+
+// TestSuggestRandom 随机插入、改权重和删除，TopK 和 Fuzzy 与遍历全部单词的结果对照
+func TestSuggestRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	letters := []rune("abc中文")
+	word := func() string {
+		var b strings.Builder
+		for n := rng.Intn(6); n > 0; n-- {
+			b.WriteRune(letters[rng.Intn(len(letters))])
+		}
+		return b.String()
+	}
+	trie := NewTrie[string]()
+	model := make(map[string]Suggestion[string])
+	for i := 0; i < 3000; i++ {
+		w := word()
+		switch rng.Intn(4) {
+		case 0:
+			trie.Delete(w)
+			delete(model, w)
+		case 1:
+			if s, ok := model[w]; ok {
+				s.Weight += 3
+				model[w] = s
+			}
+			trie.AddWeight(w, 3)
+		default:
+			weight := float64(rng.Intn(20))
+			trie.InsertWeighted(w, fmt.Sprint(i), weight)
+			model[w] = Suggestion[string]{Word: w, Value: fmt.Sprint(i), Weight: weight}
+		}
+
+		if i%30 != 0 {
+			continue
+		}
+		query := word()
+		var want []Suggestion[string]
+		for _, s := range model {
+			if strings.HasPrefix(s.Word, query) {
+				want = append(want, s)
+			}
+		}
+		slices.SortFunc(want, func(a, b Suggestion[string]) int {
+			return cmp.Or(cmp.Compare(b.Weight, a.Weight), cmp.Compare(a.Word, b.Word))
+		})
+		k := 1 + rng.Intn(5)
+		want = want[:min(k, len(want))]
+		if got := trie.TopK(query, k); !slices.Equal(got, want) {
+			t.Fatalf("step %d: TopK(%q, %d) = %v, want %v", i, query, k, got, want)
+		}
+
+		maxEdits := rng.Intn(3)
+		want = want[:0]
+		for _, s := range model {
+			if d := editDistance(query, s.Word); d <= maxEdits {
+				s.Distance = d
+				want = append(want, s)
+			}
+		}
+		slices.SortFunc(want, func(a, b Suggestion[string]) int {
+			return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(b.Weight, a.Weight), cmp.Compare(a.Word, b.Word))
+		})
+		if got := trie.Fuzzy(query, maxEdits); !slices.Equal(got, want) {
+			t.Fatalf("step %d: Fuzzy(%q, %d) = %v, want %v", i, query, maxEdits, got, want)
+		}
+	}
+}
+
+// TestInsertKeepsWeight 覆盖值不改变已有单词的权重
+func TestInsertKeepsWeight(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.InsertWeighted("go", "golang", 4)
+	trie.Insert("go", "gopher")
+	trie.Insert("gone", "")
+	got := trie.TopK("go", 2)
+	want := []Suggestion[string]{{Word: "go", Value: "gopher", Weight: 4}, {Word: "gone", Weight: 0}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("TopK = %v, want %v", got, want)
+	}
+	if trie.AddWeight("g", 1) || trie.AddWeight("golang", 1) {
+		t.Fatal("AddWeight on missing word succeeded")
+	}
+}